@@ -0,0 +1,195 @@
+package cache
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.school/proxy/nosql"
+	"sort"
+	"time"
+)
+
+// AssignmentInfo 班级学科的任课安排，End为空表示仍在任
+type AssignmentInfo struct {
+	baseInfo
+	School  string    `json:"school"`
+	Class   string    `json:"class"`
+	Subject string    `json:"subject"`
+	Teacher string    `json:"teacher"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+}
+
+func (mine *AssignmentInfo) initInfo(db *nosql.Assignment) {
+	mine.UID = db.UID.Hex()
+	mine.ID = db.ID
+	mine.UpdateTime = db.UpdatedTime
+	mine.CreateTime = db.CreatedTime
+	mine.Creator = db.Creator
+	mine.Operator = db.Operator
+	mine.School = db.School
+	mine.Class = db.Class
+	mine.Subject = db.Subject
+	mine.Teacher = db.Teacher
+	mine.Start = db.Start
+	mine.End = db.End
+}
+
+// IsActive 判断某天是否在任，结束日期当天不再在任
+func (mine *AssignmentInfo) IsActive(date time.Time) bool {
+	date = switchDay(date)
+	if mine.Start.After(date) {
+		return false
+	}
+	return mine.End.IsZero() || date.Before(mine.End)
+}
+
+// AssignTeacher 安排班级学科的任课老师，同一学科之前在任的安排在开始日期结束
+func (mine *SchoolInfo) AssignTeacher(class *ClassInfo, subject, teacher, operator string, start, end time.Time) (*AssignmentInfo, error) {
+	if class == nil || class.School != mine.UID {
+		return nil, errors.New("not found the class")
+	}
+	if mine.GetSubject(subject) == nil {
+		return nil, errors.New("not found the subject")
+	}
+	if !mine.hadTeacher(teacher) {
+		return nil, errors.New("not found the teacher in the school")
+	}
+	if start.IsZero() {
+		start = time.Now()
+	}
+	start = switchDay(start)
+	if !end.IsZero() {
+		end = switchDay(end)
+		if !end.After(start) {
+			return nil, errors.New("the end date must after the start date")
+		}
+	}
+	olds := make([]*AssignmentInfo, 0, 2)
+	for _, item := range mine.GetClassAssignments(class.UID, time.Time{}) {
+		if item.Subject != subject || (!item.End.IsZero() && !item.End.After(start)) {
+			continue
+		}
+		if !item.Start.Before(start) {
+			return nil, errors.New("the subject had assigned in the date")
+		}
+		olds = append(olds, item)
+	}
+	for _, item := range olds {
+		err := nosql.UpdateAssignmentEnd(item.UID, operator, start)
+		if err != nil {
+			return nil, err
+		}
+	}
+	db := new(nosql.Assignment)
+	db.UID = primitive.NewObjectID()
+	db.ID = nosql.GetAssignmentNextID()
+	db.CreatedTime = time.Now()
+	db.Creator = operator
+	db.School = mine.UID
+	db.Class = class.UID
+	db.Subject = subject
+	db.Teacher = teacher
+	db.Start = start
+	db.End = end
+	err := nosql.CreateAssignment(db)
+	if err != nil {
+		return nil, err
+	}
+	_ = class.AppendTeacher(teacher)
+	info := new(AssignmentInfo)
+	info.initInfo(db)
+	return info, nil
+}
+
+func (mine *SchoolInfo) GetAssignment(uid string) *AssignmentInfo {
+	if uid == "" {
+		return nil
+	}
+	db, err := nosql.GetAssignment(uid)
+	if err != nil || db.School != mine.UID {
+		return nil
+	}
+	info := new(AssignmentInfo)
+	info.initInfo(db)
+	return info
+}
+
+// EndAssignment 结束任课安排，日期为空时为当天
+func (mine *SchoolInfo) EndAssignment(uid, operator string, end time.Time) error {
+	info := mine.GetAssignment(uid)
+	if info == nil {
+		return errors.New("not found the assignment")
+	}
+	if end.IsZero() {
+		end = time.Now()
+	}
+	end = switchDay(end)
+	if !end.After(info.Start) {
+		return errors.New("the end date must after the start date")
+	}
+	return nosql.UpdateAssignmentEnd(uid, operator, end)
+}
+
+func (mine *SchoolInfo) RemoveAssignment(uid, operator string) error {
+	if mine.GetAssignment(uid) == nil {
+		return errors.New("not found the assignment")
+	}
+	return nosql.RemoveAssignment(uid, operator)
+}
+
+// GetClassAssignments 班级某天在任的安排，日期为空时返回所有记录
+func (mine *SchoolInfo) GetClassAssignments(class string, date time.Time) []*AssignmentInfo {
+	return filterAssignments(getAssignments(nosql.GetAssignmentsByClass(class)), date)
+}
+
+// GetClassSubjectTeachers 班级某天各学科的任课老师，学科UID到老师UID列表
+func (mine *SchoolInfo) GetClassSubjectTeachers(class string, date time.Time) map[string][]string {
+	if date.IsZero() {
+		date = time.Now()
+	}
+	dic := make(map[string][]string, 10)
+	for _, item := range mine.GetClassAssignments(class, date) {
+		dic[item.Subject] = append(dic[item.Subject], item.Teacher)
+	}
+	return dic
+}
+
+// GetTeacherAssignments 老师某天在任的班级和学科，日期为空时返回所有记录
+func (mine *SchoolInfo) GetTeacherAssignments(teacher string, date time.Time) []*AssignmentInfo {
+	list := make([]*AssignmentInfo, 0, 5)
+	for _, item := range filterAssignments(getAssignments(nosql.GetAssignmentsByTeacher(teacher)), date) {
+		if item.School == mine.UID {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func filterAssignments(all []*AssignmentInfo, date time.Time) []*AssignmentInfo {
+	if date.IsZero() {
+		return all
+	}
+	list := make([]*AssignmentInfo, 0, len(all))
+	for _, item := range all {
+		if item.IsActive(date) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func getAssignments(dbs []*nosql.Assignment, err error) []*AssignmentInfo {
+	list := make([]*AssignmentInfo, 0, len(dbs))
+	if err != nil {
+		return list
+	}
+	for _, db := range dbs {
+		info := new(AssignmentInfo)
+		info.initInfo(db)
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Start.Before(list[j].Start)
+	})
+	return list
+}
@@ -0,0 +1,356 @@
+package cache
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.school/proxy"
+	"omo.msa.school/proxy/nosql"
+	"sort"
+	"time"
+)
+
+const (
+	AttendPresent AttendStatus = 1 // 出勤
+	AttendAbsent  AttendStatus = 2 // 缺勤
+	AttendLate    AttendStatus = 3 // 迟到
+	AttendExcused AttendStatus = 4 // 请假
+)
+
+type AttendStatus uint8
+
+type AttendanceInfo struct {
+	Status AttendStatus
+	Period uint8
+	Grade  uint8
+	baseInfo
+	School  string
+	Class   string
+	Student string
+	Reason  string
+	Date    time.Time
+}
+
+// AttendanceMark 批量考勤时的例外记录，未列出的学生记为出勤，已请假的学生保持不变
+type AttendanceMark struct {
+	Student string
+	Status  AttendStatus
+	Reason  string
+}
+
+type AttendanceSummary struct {
+	Total   uint32 `json:"total"`
+	Present uint32 `json:"present"`
+	Absent  uint32 `json:"absent"`
+	Late    uint32 `json:"late"`
+	Excused uint32 `json:"excused"`
+}
+
+func (mine *AttendanceInfo) initInfo(db *nosql.Attendance) {
+	mine.UID = db.UID.Hex()
+	mine.ID = db.ID
+	mine.UpdateTime = db.UpdatedTime
+	mine.CreateTime = db.CreatedTime
+	mine.Creator = db.Creator
+	mine.Operator = db.Operator
+	mine.School = db.School
+	mine.Class = db.Class
+	mine.Student = db.Student
+	mine.Grade = db.Grade
+	mine.Date = db.Date
+	mine.Period = db.Period
+	mine.Status = AttendStatus(db.Status)
+	mine.Reason = db.Reason
+}
+
+func (mine *AttendanceInfo) UpdateStatus(st AttendStatus, reason, operator string) error {
+	err := nosql.UpdateAttendanceStatus(mine.UID, operator, reason, uint8(st))
+	if err == nil {
+		mine.Status = st
+		mine.Reason = reason
+		mine.Operator = operator
+		mine.UpdateTime = time.Now()
+	}
+	return err
+}
+
+func (mine *AttendanceSummary) add(st AttendStatus) {
+	mine.Total += 1
+	switch st {
+	case AttendPresent:
+		mine.Present += 1
+	case AttendAbsent:
+		mine.Absent += 1
+	case AttendLate:
+		mine.Late += 1
+	case AttendExcused:
+		mine.Excused += 1
+	}
+}
+
+func checkAttendStatus(st AttendStatus) error {
+	if st < AttendPresent || st > AttendExcused {
+		return errors.New("the attendance status is error")
+	}
+	return nil
+}
+
+// ParseDay 解析"2006/1/2"格式的日期，返回当天零点
+func ParseDay(msg string) (time.Time, error) {
+	date := new(proxy.DateInfo)
+	err := date.Parse(msg)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(int(date.Year), date.Month, int(date.Day), 0, 0, 0, 0, time.Local), nil
+}
+
+func switchDay(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.Local)
+}
+
+func getAttendances(dbs []*nosql.Attendance, err error) []*AttendanceInfo {
+	list := make([]*AttendanceInfo, 0, len(dbs))
+	if err != nil {
+		return list
+	}
+	for _, db := range dbs {
+		info := new(AttendanceInfo)
+		info.initInfo(db)
+		list = append(list, info)
+	}
+	return list
+}
+
+func summaryAttendances(list []*AttendanceInfo) *AttendanceSummary {
+	summary := new(AttendanceSummary)
+	for _, item := range list {
+		summary.add(item.Status)
+	}
+	return summary
+}
+
+// IsManager 判断用户是否是班主任或者副班主任
+func (mine *ClassInfo) IsManager(user string) bool {
+	if user == "" {
+		return false
+	}
+	for _, uid := range []string{mine.Master, mine.Assistant} {
+		if uid == "" {
+			continue
+		}
+		if uid == user {
+			return true
+		}
+		teacher := cacheCtx.GetTeacher(uid)
+		if teacher != nil && teacher.User == user {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPeriod 节次必须在班级当天的课程表中
+func (mine *ClassInfo) checkPeriod(date time.Time, period uint8) error {
+	if period < 1 {
+		return nil
+	}
+	school, _ := cacheCtx.GetSchoolBy(mine.School)
+	if school == nil {
+		return errors.New("not found the school")
+	}
+	for _, year := range []uint32{uint32(date.Year()), uint32(date.Year() - 1)} {
+		table, _ := school.GetTimetable(mine.UID, year)
+		if table == nil {
+			continue
+		}
+		for _, item := range table.Items {
+			if item.Weekday == date.Weekday() && item.Number == period {
+				return nil
+			}
+		}
+	}
+	return errors.New("the period not in the timetable")
+}
+
+// getPeriods 班级某天需要考勤的节次，有课程表时为当天的所有节次（没有课则为空），
+// 没有课程表时工作日为全天(0)，周末不上课
+func (mine *ClassInfo) getPeriods(date time.Time) []uint8 {
+	school, _ := cacheCtx.GetSchoolBy(mine.School)
+	if school != nil {
+		for _, year := range []uint32{uint32(date.Year()), uint32(date.Year() - 1)} {
+			table, _ := school.GetTimetable(mine.UID, year)
+			if table != nil && len(table.Items) > 0 {
+				return periodsOf(table.Items, date.Weekday())
+			}
+		}
+	}
+	if date.Weekday() == time.Saturday || date.Weekday() == time.Sunday {
+		return []uint8{}
+	}
+	return []uint8{0}
+}
+
+func periodsOf(items []proxy.TimetableItem, weekday time.Weekday) []uint8 {
+	list := make([]uint8, 0, 8)
+	for _, item := range items {
+		if item.Weekday != weekday {
+			continue
+		}
+		had := false
+		for _, num := range list {
+			if num == item.Number {
+				had = true
+				break
+			}
+		}
+		if !had {
+			list = append(list, item.Number)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i] < list[j]
+	})
+	return list
+}
+
+func (mine *ClassInfo) MarkAttendance(student string, date time.Time, period uint8, st AttendStatus, reason, operator string) (*AttendanceInfo, error) {
+	if !mine.IsManager(operator) {
+		return nil, errors.New("the operator is not the master of class")
+	}
+	if !mine.HadStudent(student) {
+		return nil, errors.New("the student not in the class")
+	}
+	err := checkAttendStatus(st)
+	if err != nil {
+		return nil, err
+	}
+	date = switchDay(date)
+	err = mine.checkPeriod(date, period)
+	if err != nil {
+		return nil, err
+	}
+	return mine.markAttendance(student, date, period, st, reason, operator)
+}
+
+func getAttendance(student string, date time.Time, period uint8) *AttendanceInfo {
+	db, err := nosql.GetAttendanceBy(student, date, period)
+	if err != nil || db == nil {
+		return nil
+	}
+	info := new(AttendanceInfo)
+	info.initInfo(db)
+	return info
+}
+
+// getExcuse 学生在某天某节次的请假记录，节次没有记录时使用全天的请假
+func getExcuse(student string, date time.Time, period uint8) *AttendanceInfo {
+	info := getAttendance(student, date, period)
+	if info == nil && period > 0 {
+		info = getAttendance(student, date, 0)
+	}
+	if info != nil && info.Status == AttendExcused {
+		return info
+	}
+	return nil
+}
+
+// bulkStatus 批量考勤时学生的状态，已经请假的学生不会被批量修改，返回false表示保持原有记录
+func bulkStatus(excuse *AttendanceInfo, student string, marks []AttendanceMark) (AttendStatus, string, bool) {
+	if excuse != nil && excuse.Status == AttendExcused {
+		return excuse.Status, excuse.Reason, false
+	}
+	for _, mark := range marks {
+		if mark.Student == student {
+			return mark.Status, mark.Reason, true
+		}
+	}
+	return AttendPresent, "", true
+}
+
+func (mine *ClassInfo) markAttendance(student string, date time.Time, period uint8, st AttendStatus, reason, operator string) (*AttendanceInfo, error) {
+	info := getAttendance(student, date, period)
+	if info != nil {
+		if info.Status == st && info.Reason == reason {
+			return info, nil
+		}
+		err := info.UpdateStatus(st, reason, operator)
+		return info, err
+	}
+	db := new(nosql.Attendance)
+	db.UID = primitive.NewObjectID()
+	db.ID = nosql.GetAttendanceNextID()
+	db.CreatedTime = time.Now()
+	db.Creator = operator
+	db.School = mine.School
+	db.Class = mine.UID
+	db.Student = student
+	db.Grade = mine.Grade()
+	db.Date = date
+	db.Period = period
+	db.Status = uint8(st)
+	db.Reason = reason
+	err := nosql.CreateAttendance(db)
+	if err != nil {
+		return nil, err
+	}
+	info = new(AttendanceInfo)
+	info.initInfo(db)
+	return info, nil
+}
+
+// MarkAttendances 班主任按班级批量考勤，marks中未列出的在读学生记为出勤
+func (mine *ClassInfo) MarkAttendances(date time.Time, period uint8, operator string, marks []AttendanceMark) ([]*AttendanceInfo, error) {
+	if !mine.IsManager(operator) {
+		return nil, errors.New("the operator is not the master of class")
+	}
+	for _, mark := range marks {
+		if !mine.HadStudent(mark.Student) {
+			return nil, errors.New("the student not in the class")
+		}
+		err := checkAttendStatus(mark.Status)
+		if err != nil {
+			return nil, err
+		}
+	}
+	date = switchDay(date)
+	err := mine.checkPeriod(date, period)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*AttendanceInfo, 0, len(mine.Members))
+	for _, student := range mine.GetStudentsByStatus(StudentActive) {
+		excuse := getExcuse(student, date, period)
+		st, reason, ok := bulkStatus(excuse, student, marks)
+		if !ok {
+			list = append(list, excuse)
+			continue
+		}
+		info, er := mine.markAttendance(student, date, period, st, reason, operator)
+		if er != nil {
+			err = er
+			continue
+		}
+		list = append(list, info)
+	}
+	return list, err
+}
+
+func (mine *ClassInfo) GetAttendances(date time.Time) []*AttendanceInfo {
+	return getAttendances(nosql.GetAttendancesByClass(mine.UID, switchDay(date)))
+}
+
+func (mine *ClassInfo) GetAttendanceSummary(from, to time.Time) *AttendanceSummary {
+	return summaryAttendances(getAttendances(nosql.GetAttendancesByClassRange(mine.UID, switchDay(from), switchDay(to))))
+}
+
+func (mine *SchoolInfo) GetGradeAttendanceSummary(grade uint8, from, to time.Time) *AttendanceSummary {
+	return summaryAttendances(getAttendances(nosql.GetAttendancesByGradeRange(mine.UID, grade, switchDay(from), switchDay(to))))
+}
+
+func (mine *cacheContext) GetStudentAttendances(student string, from, to time.Time) []*AttendanceInfo {
+	return getAttendances(nosql.GetAttendancesByStudentRange(student, switchDay(from), switchDay(to)))
+}
+
+func (mine *cacheContext) GetStudentAttendanceSummary(student string, from, to time.Time) *AttendanceSummary {
+	return summaryAttendances(mine.GetStudentAttendances(student, from, to))
+}
@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"omo.msa.school/proxy"
+)
+
+func TestBulkStatusKeepsExcused(t *testing.T) {
+	excuse := &AttendanceInfo{Status: AttendExcused, Reason: "sick", Student: "a"}
+	marks := []AttendanceMark{{Student: "a", Status: AttendAbsent}}
+	st, reason, ok := bulkStatus(excuse, "a", marks)
+	if ok || st != AttendExcused || reason != "sick" {
+		t.Fatalf("the excused record was downgraded: %d %s %v", st, reason, ok)
+	}
+	st, _, ok = bulkStatus(excuse, "a", nil)
+	if ok || st != AttendExcused {
+		t.Fatal("the unlisted excused student was marked present")
+	}
+}
+
+func TestBulkStatusMarks(t *testing.T) {
+	marks := []AttendanceMark{{Student: "a", Status: AttendLate, Reason: "bus"}}
+	st, reason, ok := bulkStatus(nil, "a", marks)
+	if !ok || st != AttendLate || reason != "bus" {
+		t.Fatalf("the mark was ignored: %d %s %v", st, reason, ok)
+	}
+	st, reason, ok = bulkStatus(&AttendanceInfo{Status: AttendAbsent}, "b", marks)
+	if !ok || st != AttendPresent || reason != "" {
+		t.Fatalf("the unlisted student must be present: %d %s %v", st, reason, ok)
+	}
+}
+
+func TestMarkAttendanceRequiresManager(t *testing.T) {
+	class := new(ClassInfo)
+	class.UID = "class"
+	_, err := class.MarkAttendance("a", time.Now(), 0, AttendAbsent, "", "teacher")
+	if err == nil {
+		t.Fatal("the operator without master must be refused")
+	}
+	_, err = class.MarkAttendances(time.Now(), 0, "teacher", nil)
+	if err == nil {
+		t.Fatal("the bulk mark without master must be refused")
+	}
+}
+
+func TestPeriodsOfWeekday(t *testing.T) {
+	items := []proxy.TimetableItem{
+		{Weekday: time.Monday, Number: 3},
+		{Weekday: time.Monday, Number: 1},
+		{Weekday: time.Monday, Number: 3},
+		{Weekday: time.Tuesday, Number: 2},
+	}
+	list := periodsOf(items, time.Monday)
+	if len(list) != 2 || list[0] != 1 || list[1] != 3 {
+		t.Fatalf("the periods of monday is error: %v", list)
+	}
+	if len(periodsOf(items, time.Saturday)) != 0 {
+		t.Fatal("saturday must have no periods")
+	}
+}
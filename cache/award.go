@@ -0,0 +1,181 @@
+package cache
+
+import (
+	"errors"
+	pb "github.com/xtech-cloud/omo-msp-school/proto/school"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.school/proxy/nosql"
+	"sort"
+	"time"
+)
+
+type AwardInfo struct {
+	Type uint8 `json:"type"`
+	baseInfo
+	School string    `json:"school"`
+	Honor  string    `json:"honor"`
+	Target string    `json:"target"`
+	Term   string    `json:"term"`
+	Issuer string    `json:"issuer"`
+	Asset  string    `json:"asset"`
+	Remark string    `json:"remark"`
+	Date   time.Time `json:"date"`
+}
+
+// AwardBrief 某个荣誉在一个学期内的获奖情况
+type AwardBrief struct {
+	Honor   string
+	Term    string
+	Targets []string
+}
+
+func (mine *AwardInfo) initInfo(db *nosql.Award) {
+	mine.UID = db.UID.Hex()
+	mine.ID = db.ID
+	mine.UpdateTime = db.UpdatedTime
+	mine.CreateTime = db.CreatedTime
+	mine.Creator = db.Creator
+	mine.Operator = db.Operator
+	mine.School = db.School
+	mine.Honor = db.Honor
+	mine.Target = db.Target
+	mine.Type = db.Type
+	mine.Date = db.Date
+	mine.Term = db.Term
+	mine.Issuer = db.Issuer
+	mine.Asset = db.Asset
+	mine.Remark = db.Remark
+}
+
+func (mine *AwardInfo) UpdateBase(term, issuer, asset, remark, operator string, date time.Time) error {
+	err := nosql.UpdateAwardBase(mine.UID, term, issuer, asset, remark, operator, date)
+	if err == nil {
+		mine.Term = term
+		mine.Issuer = issuer
+		mine.Asset = asset
+		mine.Remark = remark
+		mine.Date = date
+		mine.Operator = operator
+		mine.UpdateTime = time.Now()
+	}
+	return err
+}
+
+// CreateAward 记录学生或者老师获得的荣誉
+func (mine *SchoolInfo) CreateAward(kind pb.TargetType, honor, target, term, issuer, asset, remark, operator string, date time.Time) (*AwardInfo, error) {
+	if kind == pb.TargetType_TStudent {
+		if mine.GetHonor(true, honor) == nil {
+			return nil, errors.New("not found the student honor")
+		}
+		student := mine.GetStudentBy(target)
+		if student == nil {
+			return nil, errors.New("not found the student")
+		}
+		target = student.UID
+	} else if kind == pb.TargetType_TTeacher {
+		if mine.GetHonor(false, honor) == nil {
+			return nil, errors.New("not found the teacher honor")
+		}
+		if !mine.hadTeacher(target) {
+			return nil, errors.New("not found the teacher")
+		}
+	} else {
+		return nil, errors.New("the award target type is error")
+	}
+	db := new(nosql.Award)
+	db.UID = primitive.NewObjectID()
+	db.ID = nosql.GetAwardNextID()
+	db.CreatedTime = time.Now()
+	db.Creator = operator
+	db.School = mine.UID
+	db.Honor = honor
+	db.Target = target
+	db.Type = uint8(kind)
+	db.Date = date
+	db.Term = term
+	db.Issuer = issuer
+	db.Asset = asset
+	db.Remark = remark
+	err := nosql.CreateAward(db)
+	if err != nil {
+		return nil, err
+	}
+	info := new(AwardInfo)
+	info.initInfo(db)
+	return info, nil
+}
+
+func (mine *SchoolInfo) GetAward(uid string) *AwardInfo {
+	if uid == "" {
+		return nil
+	}
+	db, err := nosql.GetAward(uid)
+	if err != nil || db.School != mine.UID {
+		return nil
+	}
+	info := new(AwardInfo)
+	info.initInfo(db)
+	return info
+}
+
+func (mine *SchoolInfo) RemoveAward(uid, operator string) error {
+	if mine.GetAward(uid) == nil {
+		return errors.New("not found the award")
+	}
+	return nosql.RemoveAward(uid, operator)
+}
+
+func (mine *SchoolInfo) GetAwardsByHonor(honor string) []*AwardInfo {
+	return getAwards(nosql.GetAwardsByHonor(mine.UID, honor))
+}
+
+// GetAwardsByTerm 学期为空时返回学校的所有获奖记录
+func (mine *SchoolInfo) GetAwardsByTerm(term string) []*AwardInfo {
+	if term == "" {
+		return getAwards(nosql.GetAwardsBySchool(mine.UID))
+	}
+	return getAwards(nosql.GetAwardsByTerm(mine.UID, term))
+}
+
+// GetAwardBriefs 按荣誉和学期汇总获奖人
+func (mine *SchoolInfo) GetAwardBriefs(term string) []*AwardBrief {
+	list := make([]*AwardBrief, 0, 10)
+	for _, award := range mine.GetAwardsByTerm(term) {
+		var brief *AwardBrief
+		for _, item := range list {
+			if item.Honor == award.Honor && item.Term == award.Term {
+				brief = item
+				break
+			}
+		}
+		if brief == nil {
+			brief = &AwardBrief{Honor: award.Honor, Term: award.Term, Targets: make([]string, 0, 5)}
+			list = append(list, brief)
+		}
+		brief.Targets = append(brief.Targets, award.Target)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Term < list[j].Term
+	})
+	return list
+}
+
+func (mine *cacheContext) GetAwardsByTarget(target string) []*AwardInfo {
+	return getAwards(nosql.GetAwardsByTarget(target))
+}
+
+func getAwards(dbs []*nosql.Award, err error) []*AwardInfo {
+	list := make([]*AwardInfo, 0, len(dbs))
+	if err != nil {
+		return list
+	}
+	for _, db := range dbs {
+		info := new(AwardInfo)
+		info.initInfo(db)
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Date.After(list[j].Date)
+	})
+	return list
+}
@@ -13,6 +13,9 @@ import (
 	"time"
 )
 
+// OperatorSystem 定时任务和数据迁移等没有用户参与的操作者
+const OperatorSystem = "system"
+
 type baseInfo struct {
 	ID         uint64 `json:"-"`
 	UID        string `json:"uid"`
@@ -40,7 +43,23 @@ func InitData() error {
 	cacheCtx.schools = make([]*SchoolInfo, 0, 100)
 	cacheCtx.teachers = make([]*TeacherInfo, 0, 100)
 
-	err := nosql.InitDB(config.Schema.Database.IP, config.Schema.Database.Port, config.Schema.Database.Name, config.Schema.Database.Type)
+	err := checkSignSecret()
+	if nil != err {
+		logger.Warn("the erasure is disabled: " + err.Error())
+	}
+	keys := make(map[uint32]string, len(config.Schema.Secret.Keys))
+	for _, key := range config.Schema.Secret.Keys {
+		keys[key.Version] = key.Secret
+	}
+	err = nosql.SetSecret(config.Schema.Secret.Current, config.Schema.Secret.Index, config.Schema.Secret.OldIndexes, keys)
+	if nil != err {
+		return err
+	}
+	err = nosql.InitDB(config.Schema.Database.IP, config.Schema.Database.Port, config.Schema.Database.Name, config.Schema.Database.Type)
+	if nil != err {
+		return err
+	}
+	err = nosql.CheckSecretVersions()
 	if nil != err {
 		return err
 	}
@@ -0,0 +1,239 @@
+package cache
+
+import (
+	"errors"
+	pb "github.com/xtech-cloud/omo-msp-school/proto/school"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.school/proxy/nosql"
+	"sort"
+	"time"
+)
+
+const (
+	BindActionBind   BindAction = 1 // 绑定
+	BindActionUnbind BindAction = 2 // 解绑
+)
+
+type BindAction uint8
+
+type BindingInfo struct {
+	Action BindAction `json:"action"`
+	Type   uint8      `json:"type"`
+	baseInfo
+	School string `json:"school"`
+	Target string `json:"target"`
+	Entity string `json:"entity"`
+	Remark string `json:"remark"`
+}
+
+// BindingMessage 绑定变化时发布到消息总线的内容
+type BindingMessage struct {
+	School   string     `json:"school"`
+	Target   string     `json:"target"`
+	Type     uint8      `json:"type"`
+	Entity   string     `json:"entity"`
+	Action   BindAction `json:"action"`
+	Operator string     `json:"operator"`
+	Created  int64      `json:"created"`
+}
+
+func (mine *BindingInfo) initInfo(db *nosql.Binding) {
+	mine.UID = db.UID.Hex()
+	mine.ID = db.ID
+	mine.UpdateTime = db.UpdatedTime
+	mine.CreateTime = db.CreatedTime
+	mine.Creator = db.Creator
+	mine.Operator = db.Operator
+	mine.School = db.School
+	mine.Target = db.Target
+	mine.Type = db.Type
+	mine.Entity = db.Entity
+	mine.Action = BindAction(db.Action)
+	mine.Remark = db.Remark
+}
+
+func recordBinding(school, target string, kind pb.TargetType, entity string, action BindAction, remark, operator string) {
+	db := new(nosql.Binding)
+	db.UID = primitive.NewObjectID()
+	db.ID = nosql.GetBindingNextID()
+	db.CreatedTime = time.Now()
+	db.Creator = operator
+	db.School = school
+	db.Target = target
+	db.Type = uint8(kind)
+	db.Entity = entity
+	db.Action = uint8(action)
+	db.Remark = remark
+	_ = nosql.CreateBinding(db)
+	notify(TopicBinding, &BindingMessage{School: school, Target: target, Type: uint8(kind), Entity: entity,
+		Action: action, Operator: operator, Created: db.CreatedTime.Unix()})
+}
+
+// GetBindings 按时间顺序返回学生或者老师的绑定记录
+func (mine *cacheContext) GetBindings(target string) []*BindingInfo {
+	list := make([]*BindingInfo, 0, 5)
+	dbs, err := nosql.GetBindingsByTarget(target)
+	if err != nil {
+		return list
+	}
+	for _, db := range dbs {
+		info := new(BindingInfo)
+		info.initInfo(db)
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// checkEntity 同一个学校中一个实体只能绑定一个在读学生
+func (mine *StudentInfo) checkEntity(entity string) error {
+	dbs, err := nosql.GetStudentsByEntity(entity)
+	if err != nil {
+		return err
+	}
+	for _, db := range dbs {
+		if db.UID.Hex() == mine.UID || db.School != mine.School {
+			continue
+		}
+		st := StudentStatus(db.Status)
+		if st == StudentActive || st == StudentUnknown {
+			return errors.New("the entity had bound to other student")
+		}
+	}
+	return nil
+}
+
+func (mine *StudentInfo) UnbindEntity(operator, remark string) error {
+	if mine.Entity == "" {
+		return errors.New("the student entity is empty")
+	}
+	old := mine.Entity
+	err := nosql.UpdateStudentEntity(mine.UID, "", operator)
+	if err == nil {
+		mine.Entity = ""
+		mine.Operator = operator
+		mine.UpdateTime = time.Now()
+		mine.recordEvent(EventUnbind, mine.currentClass(), old, "", remark, operator)
+		recordBinding(mine.School, mine.UID, pb.TargetType_TStudent, old, BindActionUnbind, remark, operator)
+	}
+	return err
+}
+
+// RebindEntity 替换学生绑定的实体
+func (mine *StudentInfo) RebindEntity(entity, operator, remark string) error {
+	if entity == "" {
+		return errors.New("the entity is empty")
+	}
+	if mine.Entity == entity {
+		return nil
+	}
+	if mine.Entity == "" {
+		return mine.BindEntity(entity, operator)
+	}
+	err := mine.checkEntity(entity)
+	if err != nil {
+		return err
+	}
+	// 一次写入直接替换实体，避免解绑成功而绑定失败时学生没有实体
+	old := mine.Entity
+	err = nosql.UpdateStudentEntity(mine.UID, entity, operator)
+	if err == nil {
+		mine.Entity = entity
+		mine.Operator = operator
+		mine.UpdateTime = time.Now()
+		class := mine.currentClass()
+		mine.recordEvent(EventUnbind, class, old, "", remark, operator)
+		mine.recordEvent(EventBind, class, "", entity, "", operator)
+		recordBinding(mine.School, mine.UID, pb.TargetType_TStudent, old, BindActionUnbind, remark, operator)
+		recordBinding(mine.School, mine.UID, pb.TargetType_TStudent, entity, BindActionBind, "", operator)
+	}
+	return err
+}
+
+func (mine *TeacherInfo) checkEntity(entity string) error {
+	school := cacheCtx.GetSchoolByTeacher(mine.UID)
+	if school == nil {
+		return nil
+	}
+	other := school.GetTeacherByEntity(entity)
+	if other != nil && other.UID != mine.UID {
+		return errors.New("the entity had bound to other teacher")
+	}
+	return nil
+}
+
+func (mine *TeacherInfo) getSchoolUID() string {
+	school := cacheCtx.GetSchoolByTeacher(mine.UID)
+	if school == nil {
+		return ""
+	}
+	return school.UID
+}
+
+func (mine *TeacherInfo) BindEntity(entity, operator string) error {
+	if entity == "" {
+		return errors.New("the entity is empty")
+	}
+	if mine.Entity == entity {
+		return nil
+	}
+	if mine.Entity != "" {
+		return errors.New("the teacher entity had existed")
+	}
+	err := mine.checkEntity(entity)
+	if err != nil {
+		return err
+	}
+	err = nosql.UpdateTeacherEntity(mine.UID, entity, operator)
+	if err == nil {
+		mine.Entity = entity
+		mine.Operator = operator
+		mine.UpdateTime = time.Now()
+		recordBinding(mine.getSchoolUID(), mine.UID, pb.TargetType_TTeacher, entity, BindActionBind, "", operator)
+	}
+	return err
+}
+
+func (mine *TeacherInfo) UnbindEntity(operator, remark string) error {
+	if mine.Entity == "" {
+		return errors.New("the teacher entity is empty")
+	}
+	old := mine.Entity
+	err := nosql.UpdateTeacherEntity(mine.UID, "", operator)
+	if err == nil {
+		mine.Entity = ""
+		mine.Operator = operator
+		mine.UpdateTime = time.Now()
+		recordBinding(mine.getSchoolUID(), mine.UID, pb.TargetType_TTeacher, old, BindActionUnbind, remark, operator)
+	}
+	return err
+}
+
+func (mine *TeacherInfo) RebindEntity(entity, operator, remark string) error {
+	if entity == "" {
+		return errors.New("the entity is empty")
+	}
+	if mine.Entity == entity {
+		return nil
+	}
+	if mine.Entity == "" {
+		return mine.BindEntity(entity, operator)
+	}
+	err := mine.checkEntity(entity)
+	if err != nil {
+		return err
+	}
+	old := mine.Entity
+	err = nosql.UpdateTeacherEntity(mine.UID, entity, operator)
+	if err == nil {
+		mine.Entity = entity
+		mine.Operator = operator
+		mine.UpdateTime = time.Now()
+		school := mine.getSchoolUID()
+		recordBinding(school, mine.UID, pb.TargetType_TTeacher, old, BindActionUnbind, remark, operator)
+		recordBinding(school, mine.UID, pb.TargetType_TTeacher, entity, BindActionBind, "", operator)
+	}
+	return err
+}
@@ -2,7 +2,6 @@ package cache
 
 import (
 	"errors"
-	"fmt"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"omo.msa.school/proxy"
 	"omo.msa.school/proxy/nosql"
@@ -24,6 +23,25 @@ func (mine *cacheContext) GetClass(uid string) *ClassInfo {
 	return nil
 }
 
+// GetHistoryClass 班级，缓存中没有时从数据库查找，用于查询已归档和超出最高年级的班级的历史记录
+func (mine *cacheContext) GetHistoryClass(uid string) *ClassInfo {
+	info := mine.GetClass(uid)
+	if info != nil {
+		return info
+	}
+	db, err := nosql.GetClass(uid)
+	if err != nil || !db.DeleteTime.IsZero() {
+		return nil
+	}
+	school, _ := mine.GetSchoolBy(db.School)
+	if school == nil {
+		return nil
+	}
+	info = new(ClassInfo)
+	info.initInfo(school.MaxGrade(), db)
+	return info
+}
+
 func (mine *cacheContext) GetClassByEnrol(school string, enrol *proxy.DateInfo, num uint16) (*ClassInfo, error) {
 	if num < 1 {
 		return nil, errors.New("the class number is 0")
@@ -34,9 +52,7 @@ func (mine *cacheContext) GetClassByEnrol(school string, enrol *proxy.DateInfo,
 	}
 	tmp := info.GetClassByEnrol(enrol, uint16(num))
 	if tmp == nil {
-		msg := enrol.String()
-		name := fmt.Sprintf("%s-%d", msg, num)
-		tmp, err = info.createClass(name, msg, info.Operator, uint16(num), ClassTypeDef)
+		tmp, err = info.createClass("", enrol.String(), info.Operator, uint16(num), ClassTypeDef)
 	}
 	return tmp, err
 }
@@ -262,6 +278,7 @@ func (mine *cacheContext) createStudent(owner, name, sn, sid, operator string, e
 
 	student := new(StudentInfo)
 	student.initInfo(db)
+	student.recordEvent(EventEnrol, "", "", student.EnrolDate.String(), "", operator)
 	return student, nil
 }
 
@@ -0,0 +1,227 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"github.com/micro/go-micro/v2/logger"
+	"omo.msa.school/proxy"
+	"omo.msa.school/proxy/nosql"
+	"sort"
+	"time"
+)
+
+// ErrClassFull 班级已满，新学生只能进入候补队列
+var ErrClassFull = errors.New("the class is full")
+
+// RemarkClassFull 班级已满进入候补队列时的备注
+const RemarkClassFull = "class full"
+
+// CapacityReport 班级容量情况，Over为超出容量的人数
+type CapacityReport struct {
+	Class    string   `json:"class"`
+	Grade    uint8    `json:"grade"`
+	Capacity uint32   `json:"capacity"`
+	Count    uint32   `json:"count"`
+	Over     uint32   `json:"over"`
+	Waits    []string `json:"waits"`
+}
+
+func (mine *SchoolInfo) GetGradeCapacity(grade uint8) uint32 {
+	for _, item := range mine.Capacities {
+		if item.Grade == grade {
+			return item.Count
+		}
+	}
+	return 0
+}
+
+// UpdateCapacities 设置年级默认容量，容量增加的班级会从候补队列中补位
+func (mine *SchoolInfo) UpdateCapacities(operator string, list []proxy.CapacityInfo) error {
+	for _, item := range list {
+		if item.Grade < 1 || item.Grade > mine.MaxGrade() {
+			return errors.New("the capacity grade is error")
+		}
+	}
+	err := nosql.UpdateSchoolCapacities(mine.UID, operator, list)
+	if err != nil {
+		return err
+	}
+	mine.Capacities = list
+	mine.Operator = operator
+	mine.UpdateTime = time.Now()
+	for _, class := range mine.GetActClasses() {
+		class.fillSeats(operator)
+	}
+	return nil
+}
+
+// GetCapacityReports 超出容量或者有候补学生的班级
+func (mine *SchoolInfo) GetCapacityReports() []*CapacityReport {
+	list := make([]*CapacityReport, 0, 10)
+	for _, class := range mine.GetActClasses() {
+		info := class.GetCapacityReport()
+		if info.Over > 0 || len(info.Waits) > 0 {
+			list = append(list, info)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Over > list[j].Over
+	})
+	return list
+}
+
+// GetCapacity 班级容量，为0表示不限制
+func (mine *ClassInfo) GetCapacity() uint32 {
+	if mine.Capacity > 0 || mine.IsVirtual() {
+		return mine.Capacity
+	}
+	school, _ := cacheCtx.GetSchoolBy(mine.School)
+	if school == nil {
+		return 0
+	}
+	return school.GetGradeCapacity(mine.Grade())
+}
+
+func (mine *ClassInfo) IsFull() bool {
+	capacity := mine.GetCapacity()
+	return capacity > 0 && uint32(len(mine.GetStudentsByStatus(StudentActive))) >= capacity
+}
+
+func (mine *ClassInfo) GetCapacityReport() *CapacityReport {
+	info := &CapacityReport{Class: mine.UID, Capacity: mine.GetCapacity(), Waits: make([]string, 0, len(mine.Waits))}
+	if !mine.IsVirtual() {
+		info.Grade = mine.Grade()
+	}
+	info.Count = uint32(len(mine.GetStudentsByStatus(StudentActive)))
+	if info.Capacity > 0 && info.Count > info.Capacity {
+		info.Over = info.Count - info.Capacity
+	}
+	for _, item := range mine.Waits {
+		info.Waits = append(info.Waits, item.Student)
+	}
+	return info
+}
+
+// UpdateCapacity 设置班级容量，已超出的学生不会被移出，只是不能再加入
+func (mine *ClassInfo) UpdateCapacity(operator string, capacity uint32) error {
+	if mine.Capacity == capacity {
+		return nil
+	}
+	err := nosql.UpdateClassCapacity(mine.UID, operator, capacity)
+	if err != nil {
+		return err
+	}
+	mine.Capacity = capacity
+	mine.Operator = operator
+	mine.UpdateTime = time.Now()
+	mine.fillSeats(operator)
+	return nil
+}
+
+func (mine *ClassInfo) HadWait(student string) bool {
+	for _, item := range mine.Waits {
+		if item.Student == student {
+			return true
+		}
+	}
+	return false
+}
+
+// AppendWait 学生加入候补队列，班级未满时直接补位
+func (mine *ClassInfo) AppendWait(student, remark, operator string) error {
+	info := cacheCtx.GetStudent(student)
+	if info == nil || info.School != mine.School {
+		return errors.New("not found the student")
+	}
+	if mine.HadStudent(student) {
+		return errors.New("the student had in the class")
+	}
+	if mine.HadWait(student) {
+		return nil
+	}
+	tmp := proxy.ClassMember{
+		UID:     fmt.Sprintf("%s-%d", mine.UID, info.ID),
+		Student: student,
+		Status:  uint8(StudentUnknown),
+		Updated: time.Now(),
+		Remark:  remark,
+	}
+	list := make([]proxy.ClassMember, 0, len(mine.Waits)+1)
+	list = append(list, mine.Waits...)
+	list = append(list, tmp)
+	err := mine.updateWaits(operator, list)
+	if err != nil {
+		return err
+	}
+	mine.fillSeats(operator)
+	return nil
+}
+
+// AdmitStudent 学生加入班级，班级已满时进入候补队列，返回是否已经加入班级
+func (mine *ClassInfo) AdmitStudent(info *StudentInfo, remark, operator string) (bool, error) {
+	err := mine.AddStudent(info, operator)
+	if err == nil {
+		return true, nil
+	}
+	if err != ErrClassFull {
+		return false, err
+	}
+	return false, mine.AppendWait(info.UID, remark, operator)
+}
+
+func (mine *ClassInfo) RemoveWait(student, operator string) error {
+	if !mine.HadWait(student) {
+		return nil
+	}
+	list := make([]proxy.ClassMember, 0, len(mine.Waits))
+	for _, item := range mine.Waits {
+		if item.Student != student {
+			list = append(list, item)
+		}
+	}
+	return mine.updateWaits(operator, list)
+}
+
+func (mine *ClassInfo) updateWaits(operator string, list []proxy.ClassMember) error {
+	err := nosql.UpdateClassWaits(mine.UID, operator, list)
+	if err == nil {
+		mine.Waits = list
+		mine.Operator = operator
+		mine.UpdateTime = time.Now()
+	}
+	return err
+}
+
+// fillSeats 有空位时按候补顺序补位，在其他行政班的学生按转班处理；补位成功后才移出候补队列，
+// 失败时保留候补并停止，避免学生既不在班级也不在候补队列中
+func (mine *ClassInfo) fillSeats(operator string) {
+	for len(mine.Waits) > 0 && !mine.IsFull() {
+		wait := mine.Waits[0]
+		info := cacheCtx.GetStudent(wait.Student)
+		if info == nil {
+			logger.Warnf("fill seats of class %s failed: not found the student %s", mine.UID, wait.Student)
+			return
+		}
+		var err error
+		if mine.IsVirtual() {
+			err = mine.JoinGroup(operator, []string{info.UID})
+		} else {
+			school, _ := cacheCtx.GetSchoolBy(mine.School)
+			var from *ClassInfo
+			if school != nil {
+				from = school.GetClassByStudent(info.UID, StudentActive)
+			}
+			err = mine.moveStudent(info, from, "wait class", operator)
+			if err == nil {
+				_ = info.UpdateEnrol(mine.EnrolDate, operator)
+			}
+		}
+		if err != nil {
+			logger.Warnf("fill seats of class %s failed: %s", mine.UID, err.Error())
+			return
+		}
+		if mine.RemoveWait(wait.Student, operator) != nil {
+			return
+		}
+	}
+}
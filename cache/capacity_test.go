@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"testing"
+
+	"omo.msa.school/proxy"
+)
+
+func newFullClass() *ClassInfo {
+	class := new(ClassInfo)
+	class.UID = "class"
+	class.Type = ClassTypeVirtual
+	class.Capacity = 2
+	class.Members = []proxy.ClassMember{
+		{Student: "a", Status: uint8(StudentActive)},
+		{Student: "b", Status: uint8(StudentActive)},
+		{Student: "c", Status: uint8(StudentLeave)},
+	}
+	class.Waits = []proxy.ClassMember{{Student: "d", Status: uint8(StudentUnknown)}}
+	return class
+}
+
+func TestAddStudentToFullClass(t *testing.T) {
+	class := newFullClass()
+	if !class.IsFull() {
+		t.Fatal("the class must be full")
+	}
+	err := class.AddStudent(&StudentInfo{baseInfo: baseInfo{UID: "e"}}, "admin")
+	if err != ErrClassFull {
+		t.Fatalf("add student to full class: %v", err)
+	}
+	if len(class.Members) != 3 {
+		t.Fatal("the members of full class changed")
+	}
+	if err = class.AddStudent(&StudentInfo{baseInfo: baseInfo{UID: "a"}}, "admin"); err != nil {
+		t.Fatalf("the student had in the class: %v", err)
+	}
+}
+
+func TestFillSeatsKeepsWaitsWhenFull(t *testing.T) {
+	class := newFullClass()
+	class.fillSeats("admin")
+	if len(class.Waits) != 1 || class.Waits[0].Student != "d" {
+		t.Fatalf("the waiting student was dropped: %+v", class.Waits)
+	}
+}
+
+func TestCapacityReport(t *testing.T) {
+	class := newFullClass()
+	class.Capacity = 1
+	info := class.GetCapacityReport()
+	if info.Count != 2 || info.Over != 1 {
+		t.Fatalf("the capacity report is error: %+v", info)
+	}
+	if len(info.Waits) != 1 || info.Waits[0] != "d" {
+		t.Fatalf("the waits of report is error: %+v", info.Waits)
+	}
+}
@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.school/proxy/nosql"
+	"sort"
+	"time"
+)
+
+const (
+	ClassRoleMaster    = "master"    // 班主任
+	ClassRoleAssistant = "assistant" // 副班主任
+)
+
+// ClassRoleInfo 班级职务的任职记录，End为空表示仍在任
+type ClassRoleInfo struct {
+	baseInfo
+	School  string    `json:"school"`
+	Class   string    `json:"class"`
+	Role    string    `json:"role"`
+	Teacher string    `json:"teacher"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	// Inferred 补录的旧任职，Start只是推测的时间
+	Inferred bool `json:"inferred"`
+}
+
+func (mine *ClassRoleInfo) initInfo(db *nosql.ClassRole) {
+	mine.UID = db.UID.Hex()
+	mine.ID = db.ID
+	mine.UpdateTime = db.UpdatedTime
+	mine.CreateTime = db.CreatedTime
+	mine.Creator = db.Creator
+	mine.Operator = db.Operator
+	mine.School = db.School
+	mine.Class = db.Class
+	mine.Role = db.Role
+	mine.Teacher = db.Teacher
+	mine.Start = db.Start
+	mine.End = db.End
+	mine.Inferred = db.Inferred
+}
+
+// IsActive 判断某天是否在任，结束日期当天不再在任
+func (mine *ClassRoleInfo) IsActive(date time.Time) bool {
+	date = switchDay(date)
+	if mine.Start.After(date) {
+		return false
+	}
+	return mine.End.IsZero() || date.Before(mine.End)
+}
+
+// SetRole 设置班级职务，班主任和副班主任同时更新班级信息，之前的任职记录自动结束
+func (mine *ClassInfo) SetRole(role, teacher, operator string) error {
+	if role == "" {
+		return errors.New("the class role is empty")
+	}
+	if role == ClassRoleMaster {
+		return mine.UpdateMaster(teacher, operator)
+	}
+	if role == ClassRoleAssistant {
+		return mine.UpdateAssistant(teacher, operator)
+	}
+	old := ""
+	for _, item := range mine.GetRoles(time.Now()) {
+		if item.Role == role {
+			old = item.Teacher
+		}
+	}
+	if old == teacher {
+		return nil
+	}
+	return mine.changeRole(role, old, teacher, operator)
+}
+
+// changeRole 结束当前的任职并开始新的任职，没有记录的旧任职从班级创建时补录并标记为推测
+func (mine *ClassInfo) changeRole(role, old, teacher, operator string) error {
+	now := switchDay(time.Now())
+	opened := false
+	for _, item := range mine.GetRoleHistory(role) {
+		if !item.End.IsZero() {
+			continue
+		}
+		opened = true
+		err := nosql.UpdateClassRoleEnd(item.UID, operator, now)
+		if err != nil {
+			return err
+		}
+	}
+	if !opened && old != "" {
+		err := mine.createRole(role, old, operator, switchDay(mine.CreateTime), now, true)
+		if err != nil {
+			return err
+		}
+	}
+	if teacher == "" {
+		return nil
+	}
+	return mine.createRole(role, teacher, operator, now, time.Time{}, false)
+}
+
+func (mine *ClassInfo) createRole(role, teacher, operator string, start, end time.Time, inferred bool) error {
+	db := new(nosql.ClassRole)
+	db.UID = primitive.NewObjectID()
+	db.ID = nosql.GetClassRoleNextID()
+	db.CreatedTime = time.Now()
+	db.Creator = operator
+	db.School = mine.School
+	db.Class = mine.UID
+	db.Role = role
+	db.Teacher = teacher
+	db.Start = start
+	db.End = end
+	db.Inferred = inferred
+	return nosql.CreateClassRole(db)
+}
+
+// GetRoles 班级某天在任的职务，日期为空时返回所有记录
+func (mine *ClassInfo) GetRoles(date time.Time) []*ClassRoleInfo {
+	all := getClassRoles(nosql.GetClassRolesByClass(mine.UID))
+	if date.IsZero() {
+		return all
+	}
+	list := make([]*ClassRoleInfo, 0, 3)
+	for _, item := range all {
+		if item.IsActive(date) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func (mine *ClassInfo) GetRoleHistory(role string) []*ClassRoleInfo {
+	list := make([]*ClassRoleInfo, 0, 5)
+	for _, item := range getClassRoles(nosql.GetClassRolesByClass(mine.UID)) {
+		if item.Role == role {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func (mine *cacheContext) GetTeacherRoles(teacher string) []*ClassRoleInfo {
+	return getClassRoles(nosql.GetClassRolesByTeacher(teacher))
+}
+
+func getClassRoles(dbs []*nosql.ClassRole, err error) []*ClassRoleInfo {
+	list := make([]*ClassRoleInfo, 0, len(dbs))
+	if err != nil {
+		return list
+	}
+	for _, db := range dbs {
+		info := new(ClassRoleInfo)
+		info.initInfo(db)
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Start.Before(list[j].Start)
+	})
+	return list
+}
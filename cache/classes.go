@@ -16,8 +16,15 @@ const (
 	ClassTypeVirtual ClassType = 1 //虚拟班
 )
 
+const (
+	ClassStatusNormal   ClassStatus = 0 // 正常
+	ClassStatusArchived ClassStatus = 1 // 已归档，毕业后不再加载
+)
+
 type ClassType uint8
 
+type ClassStatus uint8
+
 type ClassInfo struct {
 	maxGrade uint8
 	baseInfo
@@ -27,14 +34,24 @@ type ClassInfo struct {
 	EnrolDate proxy.DateInfo
 	Number    uint16
 	Type      ClassType
+	Status    ClassStatus
+	Track     string // 分科方向，如理科、文科
+	Language  string // 教学语言，如双语
 	Members   []proxy.ClassMember
 	Teachers  []string
+	Capacity  uint32              // 班级容量，为0时使用年级默认值
+	Waits     []proxy.ClassMember // 候补队列，按加入顺序补位
 }
 
 func (mine *ClassInfo) Grade() uint8 {
 	return calculateGrade(mine.EnrolDate)
 }
 
+// IsVirtual 虚拟班(社团、选修课等)不参与年级和班号的编排，学生可以同时加入多个
+func (mine *ClassInfo) IsVirtual() bool {
+	return mine.Type == ClassTypeVirtual
+}
+
 func (mine *ClassInfo) GetStatus() StudentStatus {
 	if mine.Grade() > mine.maxGrade {
 		return StudentFinish
@@ -59,7 +76,15 @@ func (mine *ClassInfo) initInfo(grade uint8, db *nosql.Class) {
 	mine.Assistant = db.Assistant
 	mine.Members = db.Students
 	mine.Type = ClassType(db.Type)
+	mine.Status = ClassStatus(db.Status)
+	mine.Track = db.Track
+	mine.Language = db.Language
 	mine.Teachers = db.Teachers
+	mine.Capacity = db.Capacity
+	mine.Waits = db.Waits
+	if mine.Waits == nil {
+		mine.Waits = make([]proxy.ClassMember, 0, 1)
+	}
 	if mine.Teachers == nil {
 		mine.Teachers = make([]string, 0, 1)
 		_ = nosql.UpdateClassTeachers(mine.UID, mine.Operator, mine.Teachers)
@@ -70,8 +95,24 @@ func (mine *ClassInfo) initInfo(grade uint8, db *nosql.Class) {
 	}
 }
 
+// FullName 按学校的命名模板生成班级名称，虚拟班使用自定义名称
 func (mine *ClassInfo) FullName() string {
-	return fmt.Sprintf("%d年级%d班", mine.Grade(), mine.Number)
+	if mine.IsVirtual() {
+		return mine.Name
+	}
+	school, _ := cacheCtx.GetSchoolBy(mine.School)
+	if school == nil {
+		return defaultNaming().format(mine.Grade(), mine.Number, mine.Track, mine.Language)
+	}
+	return school.FormatClassName(mine.Grade(), mine.Number, mine.Track, mine.Language)
+}
+
+// DisplayName 有自定义名称时使用自定义名称，自动生成的旧名称(入学日期-班号)按模板显示
+func (mine *ClassInfo) DisplayName() string {
+	if mine.Name == "" || mine.Name == fmt.Sprintf("%s-%d", mine.EnrolDate.String(), mine.Number) {
+		return mine.FullName()
+	}
+	return mine.Name
 }
 
 func (mine *ClassInfo) remove(operator string) error {
@@ -89,28 +130,54 @@ func (mine *ClassInfo) UpdateInfo(name, operator string) error {
 	return err
 }
 
-func (mine *ClassInfo) UpdateMaster(master, operator string) error {
-	if mine.Master == master {
+func (mine *ClassInfo) UpdateTrack(track, language, operator string) error {
+	if mine.Track == track && mine.Language == language {
 		return nil
 	}
-	err := nosql.UpdateClassMaster(mine.UID, master, operator)
+	err := nosql.UpdateClassTrack(mine.UID, track, language, operator)
 	if err == nil {
-		mine.Master = master
+		mine.Track = track
+		mine.Language = language
 		mine.Operator = operator
+		mine.UpdateTime = time.Now()
 	}
 	return err
 }
 
+func (mine *ClassInfo) UpdateMaster(master, operator string) error {
+	if mine.Master == master {
+		return nil
+	}
+	// 先写任职记录，记录写入失败时班级保持原来的老师
+	err := mine.changeRole(ClassRoleMaster, mine.Master, master, operator)
+	if err != nil {
+		return err
+	}
+	err = nosql.UpdateClassMaster(mine.UID, master, operator)
+	if err != nil {
+		return err
+	}
+	mine.Master = master
+	mine.Operator = operator
+	return nil
+}
+
 func (mine *ClassInfo) UpdateAssistant(master, operator string) error {
 	if mine.Assistant == master {
 		return nil
 	}
-	err := nosql.UpdateClassAssistant(mine.UID, master, operator)
-	if err == nil {
-		mine.Assistant = master
-		mine.Operator = operator
+	// 先写任职记录，记录写入失败时班级保持原来的老师
+	err := mine.changeRole(ClassRoleAssistant, mine.Assistant, master, operator)
+	if err != nil {
+		return err
 	}
-	return err
+	err = nosql.UpdateClassAssistant(mine.UID, master, operator)
+	if err != nil {
+		return err
+	}
+	mine.Assistant = master
+	mine.Operator = operator
+	return nil
 }
 
 func (mine *ClassInfo) HadTeacher(teacher string) bool {
@@ -153,13 +220,16 @@ func (mine *ClassInfo) SubtractTeacher(teacher string) error {
 	return err
 }
 
-func (mine *ClassInfo) AddStudent(info *StudentInfo) error {
+func (mine *ClassInfo) AddStudent(info *StudentInfo, operator string) error {
 	if info == nil {
 		return errors.New("the student is nil")
 	}
 	if mine.HadStudent(info.UID) {
 		return nil
 	}
+	if mine.IsFull() {
+		return ErrClassFull
+	}
 	uuid := fmt.Sprintf("%s-%d", mine.UID, info.ID)
 	tmp := proxy.ClassMember{
 		UID:     uuid,
@@ -170,10 +240,57 @@ func (mine *ClassInfo) AddStudent(info *StudentInfo) error {
 	err := nosql.AppendClassStudent(mine.UID, tmp)
 	if err == nil {
 		mine.Members = append(mine.Members, tmp)
+		mine.joinMember(info.UID, operator)
+		info.recordEvent(EventClassJoin, mine.UID, "", mine.FullName(), "", operator)
 	}
 	return err
 }
 
+// TransferStudent 学生从原班级转入当前班级
+func (mine *ClassInfo) TransferStudent(info *StudentInfo, from *ClassInfo, operator string) error {
+	if info == nil {
+		return errors.New("the student is nil")
+	}
+	return mine.moveStudent(info, from, "change class", operator)
+}
+
+func (mine *ClassInfo) moveStudent(info *StudentInfo, from *ClassInfo, remark, operator string) error {
+	if from != nil && from.UID == mine.UID {
+		return nil
+	}
+	err := mine.AddStudent(info, operator)
+	if err != nil {
+		return err
+	}
+	if from != nil {
+		err = from.RemoveStudent(info.UID, remark, operator, info.ID, StudentLeave)
+		if err != nil {
+			// 离开原班级失败时撤销加入，避免学生同时在两个班级
+			_ = mine.dropMember(info.UID, operator)
+			return err
+		}
+		info.recordEvent(EventTransfer, mine.UID, from.UID, mine.UID, remark, operator)
+	}
+	_ = info.UpdateClassNumber(mine.Number, operator)
+	return nil
+}
+
+// dropMember 撤销刚加入班级的学生，用于转班失败时回滚
+func (mine *ClassInfo) dropMember(uid, operator string) error {
+	err := nosql.SubtractClassStudent(mine.UID, uid)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(mine.Members); i += 1 {
+		if mine.Members[i].Student == uid {
+			mine.Members = append(mine.Members[:i], mine.Members[i+1:]...)
+			break
+		}
+	}
+	mine.leaveMember(uid, "rollback", operator, time.Now())
+	return nil
+}
+
 func (mine *ClassInfo) GetStudentsNumber() int {
 	return len(mine.Members)
 }
@@ -266,7 +383,7 @@ func (mine *ClassInfo) GetStudent(uid string) *proxy.ClassMember {
 	return nil
 }
 
-func (mine *ClassInfo) RemoveStudent(uid, remark string, id uint64, st StudentStatus) error {
+func (mine *ClassInfo) RemoveStudent(uid, remark, operator string, id uint64, st StudentStatus) error {
 	if !mine.HadStudent(uid) {
 		return nil
 	}
@@ -304,12 +421,27 @@ func (mine *ClassInfo) RemoveStudent(uid, remark string, id uint64, st StudentSt
 		}
 
 	}
+	if err == nil {
+		mine.leaveMember(uid, remark, operator, time.Now())
+		student := cacheCtx.GetStudent(uid)
+		if student != nil {
+			student.recordEvent(EventClassLeave, mine.UID, mine.FullName(), "", remark, operator)
+		}
+		mine.fillSeats(operator)
+	}
 	return err
 }
 
 //region Class Fun
 func (mine *SchoolInfo) CreateClasses(name, enrol, operator string, number uint16, kind ClassType) ([]*ClassInfo, error) {
 	mine.initClasses()
+	if kind == ClassTypeVirtual {
+		info, err := mine.CreateGroup(name, operator, nil)
+		if err != nil {
+			return nil, err
+		}
+		return []*ClassInfo{info}, nil
+	}
 	if number < 0 {
 		return nil, errors.New("the number must not more than -1")
 	}
@@ -395,7 +527,7 @@ func (mine *SchoolInfo) GetClassesByEnrol(year uint16, month time.Month) []*Clas
 	mine.initClasses()
 	list := make([]*ClassInfo, 0, 10)
 	for _, item := range mine.classes {
-		if item.EnrolDate.Equal(year, month) {
+		if !item.IsVirtual() && item.EnrolDate.Equal(year, month) {
 			list = append(list, item)
 		}
 	}
@@ -432,7 +564,7 @@ func (mine *SchoolInfo) GetClassesByGrade(grade uint8) []*ClassInfo {
 	mine.initClasses()
 	list := make([]*ClassInfo, 0, 10)
 	for _, item := range mine.classes {
-		if item.Grade() == grade {
+		if !item.IsVirtual() && item.Grade() == grade {
 			list = append(list, item)
 		}
 	}
@@ -520,7 +652,7 @@ func (mine *SchoolInfo) GetClassByStudent(uid string, st StudentStatus) *ClassIn
 	}
 	mine.initClasses()
 	for _, item := range mine.classes {
-		if item.HadStudentByStatus(uid, st) {
+		if !item.IsVirtual() && item.HadStudentByStatus(uid, st) {
 			return item
 		}
 	}
@@ -619,7 +751,7 @@ func (mine *SchoolInfo) GetClassByNO(grade uint8, number uint16) *ClassInfo {
 	mine.initClasses()
 	for _, item := range mine.classes {
 		g := item.Grade()
-		if g == grade && item.Number == number {
+		if !item.IsVirtual() && g == grade && item.Number == number {
 			return item
 		}
 	}
@@ -630,7 +762,7 @@ func (mine *SchoolInfo) GetClassByEnrol(enrol *proxy.DateInfo, number uint16) *C
 	mine.initClasses()
 	for _, item := range mine.classes {
 		g := item.EnrolDate.Year
-		if g == enrol.Year && item.Number == number {
+		if !item.IsVirtual() && g == enrol.Year && item.Number == number {
 			return item
 		}
 	}
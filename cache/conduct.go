@@ -0,0 +1,298 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.school/proxy"
+	"omo.msa.school/proxy/nosql"
+	"sort"
+	"time"
+)
+
+type ConductInfo struct {
+	Points int32 `json:"points"`
+	baseInfo
+	School   string    `json:"school"`
+	Class    string    `json:"class"`
+	Student  string    `json:"student"`
+	Behavior string    `json:"behavior"`
+	Term     string    `json:"term"`
+	Teacher  string    `json:"teacher"`
+	Note     string    `json:"note"`
+	Date     time.Time `json:"date"`
+}
+
+// ConductRank 排行榜中的一项，目标为学生或者班级
+type ConductRank struct {
+	Target  string `json:"target"`
+	Points  int32  `json:"points"`
+	Commend uint32 `json:"commend"`
+	Warning uint32 `json:"warning"`
+	Rank    uint32 `json:"rank"`
+}
+
+func (mine *ConductInfo) initInfo(db *nosql.Conduct) {
+	mine.UID = db.UID.Hex()
+	mine.ID = db.ID
+	mine.UpdateTime = db.UpdatedTime
+	mine.CreateTime = db.CreatedTime
+	mine.Creator = db.Creator
+	mine.Operator = db.Operator
+	mine.School = db.School
+	mine.Class = db.Class
+	mine.Student = db.Student
+	mine.Behavior = db.Behavior
+	mine.Term = db.Term
+	mine.Points = db.Points
+	mine.Teacher = db.Teacher
+	mine.Note = db.Note
+	mine.Date = db.Date
+}
+
+func (mine *SchoolInfo) GetBehavior(uid string) *proxy.BehaviorInfo {
+	for i := 0; i < len(mine.Behaviors); i += 1 {
+		if mine.Behaviors[i].UID == uid {
+			return &mine.Behaviors[i]
+		}
+	}
+	return nil
+}
+
+func (mine *SchoolInfo) CreateBehavior(name, remark, operator string, points int32) (*proxy.BehaviorInfo, error) {
+	if name == "" {
+		return nil, errors.New("the behavior name is empty")
+	}
+	for _, item := range mine.Behaviors {
+		if item.Name == name {
+			return nil, errors.New("the behavior name had existed")
+		}
+	}
+	uuid := fmt.Sprintf("%s-%d", mine.UID, nosql.GetSchoolBehaviorNextID())
+	info := proxy.BehaviorInfo{
+		UID:    uuid,
+		Name:   name,
+		Points: points,
+		Remark: remark,
+	}
+	err := nosql.AppendSchoolBehavior(mine.UID, info)
+	if err != nil {
+		return nil, err
+	}
+	mine.Behaviors = append(mine.Behaviors, info)
+	mine.Operator = operator
+	return &mine.Behaviors[len(mine.Behaviors)-1], nil
+}
+
+func (mine *SchoolInfo) UpdateBehavior(uid, name, remark, operator string, points int32) error {
+	if mine.GetBehavior(uid) == nil {
+		return errors.New("not found the behavior")
+	}
+	if name == "" {
+		return errors.New("the behavior name is empty")
+	}
+	list := make([]proxy.BehaviorInfo, 0, len(mine.Behaviors))
+	for _, item := range mine.Behaviors {
+		if item.UID == uid {
+			item.Name = name
+			item.Points = points
+			item.Remark = remark
+		} else if item.Name == name {
+			return errors.New("the behavior name had existed")
+		}
+		list = append(list, item)
+	}
+	err := nosql.UpdateSchoolBehaviors(mine.UID, operator, list)
+	if err == nil {
+		mine.Behaviors = list
+		mine.Operator = operator
+		mine.UpdateTime = time.Now()
+	}
+	return err
+}
+
+// RemoveBehavior 删除行为类别，已有的记录保留
+func (mine *SchoolInfo) RemoveBehavior(uid, operator string) error {
+	if mine.GetBehavior(uid) == nil {
+		return errors.New("not found the behavior")
+	}
+	err := nosql.SubtractSchoolBehavior(mine.UID, uid)
+	if err == nil {
+		for i := 0; i < len(mine.Behaviors); i += 1 {
+			if mine.Behaviors[i].UID == uid {
+				mine.Behaviors = append(mine.Behaviors[:i], mine.Behaviors[i+1:]...)
+				break
+			}
+		}
+		mine.Operator = operator
+	}
+	return err
+}
+
+// ResetConductTerm 切换计分学期，之后的记录和排行都从零开始
+func (mine *SchoolInfo) ResetConductTerm(term, operator string) error {
+	if term == "" {
+		return errors.New("the term is empty")
+	}
+	if term == mine.ConductTerm {
+		return nil
+	}
+	err := nosql.UpdateSchoolConductTerm(mine.UID, operator, term)
+	if err == nil {
+		mine.ConductTerm = term
+		mine.Operator = operator
+		mine.UpdateTime = time.Now()
+	}
+	return err
+}
+
+// RecordConduct 任课老师记录学生的行为，分值为0时使用行为类别的默认分值
+func (mine *SchoolInfo) RecordConduct(class *ClassInfo, student, behavior, note, operator string, points int32, date time.Time) (*ConductInfo, error) {
+	if class == nil || !class.HadStudent(student) {
+		return nil, errors.New("the student not in the class")
+	}
+	if !class.IsTeacher(operator) {
+		return nil, errors.New("the operator is not the teacher of class")
+	}
+	info := mine.GetBehavior(behavior)
+	if info == nil {
+		return nil, errors.New("not found the behavior")
+	}
+	if points == 0 {
+		points = info.Points
+	}
+	db := new(nosql.Conduct)
+	db.UID = primitive.NewObjectID()
+	db.ID = nosql.GetConductNextID()
+	db.CreatedTime = time.Now()
+	db.Creator = operator
+	db.School = mine.UID
+	db.Class = class.UID
+	db.Student = student
+	db.Behavior = behavior
+	db.Term = mine.ConductTerm
+	db.Points = points
+	db.Teacher = operator
+	db.Note = note
+	db.Date = date
+	err := nosql.CreateConduct(db)
+	if err != nil {
+		return nil, err
+	}
+	tmp := new(ConductInfo)
+	tmp.initInfo(db)
+	return tmp, nil
+}
+
+func (mine *SchoolInfo) RemoveConduct(uid, operator string) error {
+	db, err := nosql.GetConduct(uid)
+	if err != nil || db.School != mine.UID {
+		return errors.New("not found the conduct")
+	}
+	if db.Teacher != operator {
+		class := mine.GetClass(db.Class)
+		if class == nil || !class.IsManager(operator) {
+			return errors.New("the operator can not remove the conduct")
+		}
+	}
+	return nosql.RemoveConduct(uid, operator)
+}
+
+// GetStudentConducts 学期为空时使用学校当前的计分学期
+func (mine *SchoolInfo) GetStudentConducts(student, term string) []*ConductInfo {
+	if term == "" {
+		term = mine.ConductTerm
+	}
+	return getConducts(nosql.GetConductsByStudent(student, term))
+}
+
+// GetClassConductRanks 班级内学生的排行，没有记录的在读学生积分为0
+func (mine *SchoolInfo) GetClassConductRanks(class *ClassInfo, term string) []*ConductRank {
+	if term == "" {
+		term = mine.ConductTerm
+	}
+	list := make([]*ConductRank, 0, len(class.Members))
+	for _, student := range class.GetStudentsByStatus(StudentActive) {
+		list = append(list, &ConductRank{Target: student})
+	}
+	for _, item := range getConducts(nosql.GetConductsByClass(class.UID, term)) {
+		list = addConductRank(list, item.Student, item.Points)
+	}
+	return rankConducts(list)
+}
+
+// GetGradeConductRanks 年级内班级的排行，年级为0时包含所有在读班级
+func (mine *SchoolInfo) GetGradeConductRanks(grade uint8, term string) []*ConductRank {
+	if term == "" {
+		term = mine.ConductTerm
+	}
+	classes := mine.GetActClasses()
+	list := make([]*ConductRank, 0, len(classes))
+	for _, class := range classes {
+		if class.IsVirtual() || (grade > 0 && class.Grade() != grade) {
+			continue
+		}
+		list = append(list, &ConductRank{Target: class.UID})
+	}
+	for _, item := range getConducts(nosql.GetConductsBySchool(mine.UID, term)) {
+		for _, rank := range list {
+			if rank.Target == item.Class {
+				rank.add(item.Points)
+				break
+			}
+		}
+	}
+	return rankConducts(list)
+}
+
+func (mine *ConductRank) add(points int32) {
+	mine.Points += points
+	if points > 0 {
+		mine.Commend += 1
+	} else if points < 0 {
+		mine.Warning += 1
+	}
+}
+
+func addConductRank(list []*ConductRank, target string, points int32) []*ConductRank {
+	for _, item := range list {
+		if item.Target == target {
+			item.add(points)
+			return list
+		}
+	}
+	rank := &ConductRank{Target: target}
+	rank.add(points)
+	return append(list, rank)
+}
+
+// rankConducts 按积分从高到低排名，同分同名次
+func rankConducts(list []*ConductRank) []*ConductRank {
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Points > list[j].Points
+	})
+	for i, item := range list {
+		if i > 0 && item.Points == list[i-1].Points {
+			item.Rank = list[i-1].Rank
+		} else {
+			item.Rank = uint32(i + 1)
+		}
+	}
+	return list
+}
+
+func getConducts(dbs []*nosql.Conduct, err error) []*ConductInfo {
+	list := make([]*ConductInfo, 0, len(dbs))
+	if err != nil {
+		return list
+	}
+	for _, db := range dbs {
+		info := new(ConductInfo)
+		info.initInfo(db)
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Date.Before(list[j].Date)
+	})
+	return list
+}
@@ -0,0 +1,234 @@
+package cache
+
+import (
+	"errors"
+	"github.com/micro/go-micro/v2/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.school/proxy/nosql"
+	"sort"
+	"time"
+)
+
+// EmploymentInfo 老师在学校的一段任职，Leave为空表示仍在职
+type EmploymentInfo struct {
+	baseInfo
+	School   string    `json:"school"`
+	Teacher  string    `json:"teacher"`
+	Position string    `json:"position"`
+	Join     time.Time `json:"join"`
+	Leave    time.Time `json:"leave"`
+	Remark   string    `json:"remark"`
+	// Inferred 补录的记录，Join和Leave只是推测的时间
+	Inferred bool `json:"inferred"`
+}
+
+func (mine *EmploymentInfo) initInfo(db *nosql.Employment) {
+	mine.UID = db.UID.Hex()
+	mine.ID = db.ID
+	mine.UpdateTime = db.UpdatedTime
+	mine.CreateTime = db.CreatedTime
+	mine.Creator = db.Creator
+	mine.Operator = db.Operator
+	mine.School = db.School
+	mine.Teacher = db.Teacher
+	mine.Position = db.Position
+	mine.Join = db.Join
+	mine.Leave = db.Leave
+	mine.Remark = db.Remark
+	mine.Inferred = db.Inferred
+}
+
+// IsActive 判断某个时间点是否在职，离职的时间点不再在职
+func (mine *EmploymentInfo) IsActive(date time.Time) bool {
+	if mine.Join.After(date) {
+		return false
+	}
+	return mine.Leave.IsZero() || date.Before(mine.Leave)
+}
+
+func (mine *TeacherInfo) createEmployment(school, position, remark, operator string, join, leave time.Time, inferred bool) (*EmploymentInfo, error) {
+	db := new(nosql.Employment)
+	db.UID = primitive.NewObjectID()
+	db.ID = nosql.GetEmploymentNextID()
+	db.CreatedTime = time.Now()
+	db.Creator = operator
+	db.School = school
+	db.Teacher = mine.UID
+	db.Position = position
+	db.Join = join
+	db.Leave = leave
+	db.Remark = remark
+	db.Inferred = inferred
+	err := nosql.CreateEmployment(db)
+	if err != nil {
+		return nil, err
+	}
+	info := new(EmploymentInfo)
+	info.initInfo(db)
+	return info, nil
+}
+
+// leaveSchool 结束老师在学校的任职，没有记录的旧数据补录一条推测的记录
+func (mine *TeacherInfo) leaveSchool(school, remark, operator string, date time.Time) error {
+	dbs, err := nosql.GetOpenEmployments(school, mine.UID)
+	if err != nil {
+		return err
+	}
+	if len(dbs) < 1 {
+		_, err = mine.createEmployment(school, "", remark, operator, mine.CreateTime, date, true)
+		return err
+	}
+	for _, db := range dbs {
+		err = nosql.UpdateEmploymentLeave(db.UID.Hex(), remark, operator, date)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inferEmployments 推测没有任职记录的旧数据，每条离职记录补一段任职，在职的学校补一段未离职的任职；
+// 入职时间取老师创建或者在该学校上次离职的时间
+func (mine *TeacherInfo) inferEmployments(list []*EmploymentInfo, current string) []*EmploymentInfo {
+	had := func(school string) bool {
+		for _, item := range list {
+			if item.Teacher == mine.UID && item.School == school {
+				return true
+			}
+		}
+		return false
+	}
+	arr := make([]*EmploymentInfo, 0, len(mine.Histories)+1)
+	joins := make(map[string]time.Time, len(mine.Histories)+1)
+	joinAt := func(school string) time.Time {
+		if join, ok := joins[school]; ok {
+			return join
+		}
+		return mine.CreateTime
+	}
+	for _, history := range mine.Histories {
+		if history.School == "" || had(history.School) {
+			continue
+		}
+		leave := time.Unix(int64(history.Created), 0)
+		arr = append(arr, &EmploymentInfo{School: history.School, Teacher: mine.UID, Join: joinAt(history.School),
+			Leave: leave, Remark: history.Remark, Inferred: true})
+		joins[history.School] = leave
+	}
+	if current != "" && !had(current) {
+		arr = append(arr, &EmploymentInfo{School: current, Teacher: mine.UID, Join: joinAt(current), Inferred: true})
+	}
+	return arr
+}
+
+// MigrateEmployments 为没有任职记录的老师补录一次，补录的记录标记为推测，返回补录的数量
+func (mine *cacheContext) MigrateEmployments(operator string) (uint32, error) {
+	dbs, err := nosql.GetAllTeachers()
+	if err != nil {
+		return 0, err
+	}
+	var count uint32 = 0
+	for _, db := range dbs {
+		if !db.DeleteTime.IsZero() {
+			continue
+		}
+		teacher := new(TeacherInfo)
+		teacher.initInfo(db)
+		current := ""
+		school := mine.GetSchoolByTeacher(teacher.UID)
+		if school != nil {
+			current = school.UID
+		}
+		list := getEmployments(nosql.GetEmploymentsByTeacher(teacher.UID))
+		for _, item := range teacher.inferEmployments(list, current) {
+			_, er := teacher.createEmployment(item.School, "", item.Remark, operator, item.Join, item.Leave, true)
+			if er != nil {
+				logger.Warnf("migrate employment of teacher %s failed: %s", teacher.UID, er.Error())
+				continue
+			}
+			count += 1
+		}
+	}
+	return count, nil
+}
+
+// GetCareer 老师在各学校的任职经历，按入职时间排序
+func (mine *TeacherInfo) GetCareer() []*EmploymentInfo {
+	list := getEmployments(nosql.GetEmploymentsByTeacher(mine.UID))
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Join.Before(list[j].Join)
+	})
+	return list
+}
+
+// GetEmployment 老师在学校当前的任职
+func (mine *TeacherInfo) GetEmployment(school string) *EmploymentInfo {
+	dbs, err := nosql.GetOpenEmployments(school, mine.UID)
+	if err != nil || len(dbs) < 1 {
+		return nil
+	}
+	info := new(EmploymentInfo)
+	info.initInfo(dbs[len(dbs)-1])
+	return info
+}
+
+// UpdateTeacherPosition 变更老师的职位，原任职在变更日期结束，日期为空时为当前
+func (mine *SchoolInfo) UpdateTeacherPosition(uid, position, operator string, date time.Time) (*EmploymentInfo, error) {
+	if !mine.hadTeacher(uid) {
+		return nil, errors.New("not found the teacher in the school")
+	}
+	teacher := mine.GetTeacher(uid)
+	if teacher == nil {
+		return nil, errors.New("not found the teacher")
+	}
+	if date.IsZero() {
+		date = time.Now()
+	}
+	old := teacher.GetEmployment(mine.UID)
+	if old != nil {
+		if old.Position == position {
+			return old, nil
+		}
+		if !date.After(old.Join) {
+			return nil, errors.New("the date must after the join date")
+		}
+	}
+	err := teacher.leaveSchool(mine.UID, "change position", operator, date)
+	if err != nil {
+		return nil, err
+	}
+	return teacher.createEmployment(mine.UID, position, "", operator, date, time.Time{}, false)
+}
+
+// GetEmployments 学校所有的任职记录，包含已离职的老师
+func (mine *SchoolInfo) GetEmployments() []*EmploymentInfo {
+	list := getEmployments(nosql.GetEmploymentsBySchool(mine.UID))
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Join.Before(list[j].Join)
+	})
+	return list
+}
+
+// GetActiveTeachersAt 某个时间点在职的老师
+func (mine *SchoolInfo) GetActiveTeachersAt(date time.Time) []*EmploymentInfo {
+	list := make([]*EmploymentInfo, 0, len(mine.teacherList))
+	for _, item := range mine.GetEmployments() {
+		if item.IsActive(date) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func getEmployments(dbs []*nosql.Employment, err error) []*EmploymentInfo {
+	list := make([]*EmploymentInfo, 0, len(dbs))
+	if err != nil {
+		return list
+	}
+	for _, db := range dbs {
+		info := new(EmploymentInfo)
+		info.initInfo(db)
+		list = append(list, info)
+	}
+	return list
+}
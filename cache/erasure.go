@@ -0,0 +1,282 @@
+package cache
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.school/config"
+	"omo.msa.school/proxy"
+	"omo.msa.school/proxy/nosql"
+	"omo.msa.school/tool"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	ErasureStudent   ErasureType = 1 // 学生
+	ErasureCustodian ErasureType = 2 // 监护人
+)
+
+const AnonymousName = "已匿名"
+
+type ErasureType uint8
+
+// ErasureInfo 匿名化回执，签名用于证明回执未被篡改
+type ErasureInfo struct {
+	Type ErasureType `json:"type"`
+	baseInfo
+	School    string   `json:"school"`
+	Target    string   `json:"target"`
+	Scopes    []string `json:"scopes"`
+	Signature string   `json:"signature"`
+	Verified  bool     `json:"verified"`
+}
+
+func (mine *ErasureInfo) initInfo(db *nosql.Erasure) {
+	mine.UID = db.UID.Hex()
+	mine.ID = db.ID
+	mine.UpdateTime = db.UpdatedTime
+	mine.CreateTime = db.CreatedTime
+	mine.Creator = db.Creator
+	mine.Operator = db.Operator
+	mine.Type = ErasureType(db.Type)
+	mine.School = db.School
+	mine.Target = db.Target
+	mine.Scopes = db.Scopes
+	mine.Signature = db.Signature
+	mine.Verified = hmac.Equal([]byte(mine.Signature), []byte(signErasure(db)))
+}
+
+func signErasure(db *nosql.Erasure) string {
+	content := fmt.Sprintf("%s|%s|%d|%s|%s|%s|%d", db.UID.Hex(), db.School, db.Type, db.Target,
+		strings.Join(db.Scopes, ","), db.Creator, db.CreatedTime.Unix())
+	return digest(content)
+}
+
+// checkSignSecret 删除回执的签名密钥不能为空，否则任何人都可以伪造回执，没有密钥时不能匿名化
+func checkSignSecret() error {
+	if strings.TrimSpace(config.Schema.Secret.Sign) == "" {
+		return errors.New("the sign secret is empty")
+	}
+	return nil
+}
+
+func digest(content string) string {
+	mac := hmac.New(sha256.New, []byte(config.Schema.Secret.Sign))
+	mac.Write([]byte(content))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (mine *SchoolInfo) createErasure(kind ErasureType, target, operator string, scopes []string) (*ErasureInfo, error) {
+	db := new(nosql.Erasure)
+	db.UID = primitive.NewObjectID()
+	db.ID = nosql.GetErasureNextID()
+	db.CreatedTime = time.Now()
+	db.Creator = operator
+	db.School = mine.UID
+	db.Type = uint8(kind)
+	db.Target = target
+	db.Scopes = scopes
+	db.Signature = signErasure(db)
+	err := nosql.CreateErasure(db)
+	if err != nil {
+		return nil, err
+	}
+	info := new(ErasureInfo)
+	info.initInfo(db)
+	return info, nil
+}
+
+func (mine *SchoolInfo) GetErasure(uid string) *ErasureInfo {
+	if uid == "" {
+		return nil
+	}
+	db, err := nosql.GetErasure(uid)
+	if err != nil || db.School != mine.UID {
+		return nil
+	}
+	info := new(ErasureInfo)
+	info.initInfo(db)
+	return info
+}
+
+func (mine *SchoolInfo) GetErasures() []*ErasureInfo {
+	list := make([]*ErasureInfo, 0, 10)
+	dbs, err := nosql.GetErasuresBySchool(mine.UID)
+	if err != nil {
+		return list
+	}
+	for _, db := range dbs {
+		info := new(ErasureInfo)
+		info.initInfo(db)
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// AnonymizeStudent 清除学生及其监护人的个人信息，年级、性别、入学年份等保留用于统计
+func (mine *SchoolInfo) AnonymizeStudent(uid, operator string) (*ErasureInfo, error) {
+	err := checkSignSecret()
+	if err != nil {
+		return nil, err
+	}
+	info := mine.GetStudentByUID(uid)
+	if info == nil || info.School != mine.UID {
+		return nil, errors.New("not found the student")
+	}
+	classes, err := mine.loadClasses()
+	if err != nil {
+		return nil, err
+	}
+	err = nosql.AnonymizeStudent(info.UID, AnonymousName, operator)
+	if err != nil {
+		return nil, err
+	}
+	scopes := make([]string, 0, 5)
+	scopes = append(scopes, "student")
+	mine.studentIndex.delete(info.UID)
+
+	for _, class := range classes {
+		if class.scrubStudent(info.UID, operator) {
+			if !tool.HasItem(scopes, "classes") {
+				scopes = append(scopes, "classes")
+			}
+		}
+	}
+	users := []string{info.UID}
+	if info.Entity != "" {
+		users = append(users, info.Entity)
+	}
+	for _, user := range users {
+		dbs, _ := nosql.GetSchedulesByUser(user)
+		for _, db := range dbs {
+			if nosql.SubtractScheduleUser(db.UID.Hex(), user) == nil && !tool.HasItem(scopes, "schedules") {
+				scopes = append(scopes, "schedules")
+			}
+		}
+	}
+	family := cacheCtx.GetFamilyByStudent(info.UID)
+	if family != nil && family.RemoveStudent(info.UID, operator) == nil {
+		// 家庭只剩一个学生时监护人手机号和身份证号不再共用，剩余兄弟姐妹的共同监护人保留
+		if len(family.Students) > 1 ||
+			nosql.UpdateFamilyMembers(family.UID, operator, uint8(family.Status), family.Students, []string{}, []string{}) == nil {
+			scopes = append(scopes, "family")
+		}
+	}
+	for _, leave := range cacheCtx.GetLeavesByStudent(info.UID) {
+		if nosql.AnonymizeLeave(leave.UID, operator) == nil && !tool.HasItem(scopes, "leaves") {
+			scopes = append(scopes, "leaves")
+		}
+	}
+	if num, er := nosql.ClearAttendanceReasons(info.UID, operator, time.Time{}, time.Time{}); er == nil && num > 0 {
+		scopes = append(scopes, "attendances")
+	}
+	types := []uint8{uint8(EventBind), uint8(EventUnbind)}
+	if num, er := nosql.AnonymizeStudentEvents(info.UID, operator, types); er == nil && num > 0 {
+		scopes = append(scopes, "events")
+	}
+	if num, er := nosql.AnonymizeBindings(info.UID, operator); er == nil && num > 0 {
+		scopes = append(scopes, "bindings")
+	}
+	return mine.createErasure(ErasureStudent, info.UID, operator, scopes)
+}
+
+// AnonymizeCustodian 从学校所有学生中移除该手机号对应的监护人，回执中只保存手机号的摘要
+func (mine *SchoolInfo) AnonymizeCustodian(phone, operator string) (*ErasureInfo, error) {
+	err := checkSignSecret()
+	if err != nil {
+		return nil, err
+	}
+	if phone == "" {
+		return nil, errors.New("the custodian phone is empty")
+	}
+	dbs, err := nosql.GetStudentsByCustodian(mine.UID, phone)
+	if err != nil {
+		return nil, err
+	}
+	if len(dbs) < 1 {
+		return nil, errors.New("not found the students of custodian")
+	}
+	scopes := make([]string, 0, 4)
+	scopes = append(scopes, "students")
+	cards := make([]string, 0, 2)
+	for _, db := range dbs {
+		arr := make([]proxy.CustodianInfo, 0, len(db.Custodians))
+		for _, custodian := range db.Custodians {
+			if !tool.HasItem(custodian.Phones, phone) {
+				arr = append(arr, custodian)
+			} else if custodian.Identity != "" && !tool.HasItem(cards, custodian.Identity) {
+				cards = append(cards, custodian.Identity)
+			}
+		}
+		er := nosql.UpdateStudentCustodians(db.UID.Hex(), operator, arr)
+		if er != nil {
+			return nil, er
+		}
+		info := new(StudentInfo)
+		info.initInfo(db)
+		info.Custodians = arr
+		mine.indexStudent(info)
+	}
+	families, _ := nosql.GetFamiliesByPhone(phone)
+	for _, family := range families {
+		phones := make([]string, 0, len(family.Phones))
+		for _, item := range family.Phones {
+			if item != phone {
+				phones = append(phones, item)
+			}
+		}
+		arr := make([]string, 0, len(family.Cards))
+		for _, item := range family.Cards {
+			if !tool.HasItem(cards, item) {
+				arr = append(arr, item)
+			}
+		}
+		if nosql.UpdateFamilyMembers(family.UID.Hex(), operator, family.Status, family.Students, phones, arr) == nil &&
+			!tool.HasItem(scopes, "family") {
+			scopes = append(scopes, "family")
+		}
+	}
+	for _, leave := range cacheCtx.GetLeavesByApplicant(phone) {
+		if leave.School != mine.UID {
+			continue
+		}
+		if nosql.AnonymizeLeave(leave.UID, operator) == nil && !tool.HasItem(scopes, "leaves") {
+			scopes = append(scopes, "leaves")
+		}
+		// 请假批准后考勤的原因来自申请人填写的请假原因
+		num, er := nosql.ClearAttendanceReasons(leave.Student, operator, switchDay(leave.From), switchDay(leave.To))
+		if er == nil && num > 0 && !tool.HasItem(scopes, "attendances") {
+			scopes = append(scopes, "attendances")
+		}
+	}
+	return mine.createErasure(ErasureCustodian, digest(phone), operator, scopes)
+}
+
+// scrubStudent 保留班级成员记录用于统计，只清除备注
+func (mine *ClassInfo) scrubStudent(uid, operator string) bool {
+	changed := false
+	for i := 0; i < len(mine.Members); i += 1 {
+		if mine.Members[i].Student == uid && mine.Members[i].Remark != "" {
+			mine.Members[i].Remark = ""
+			changed = true
+		}
+	}
+	if !changed {
+		return mine.HadStudent(uid)
+	}
+	err := nosql.UpdateClassStudents(mine.UID, operator, mine.Members)
+	if err != nil {
+		return false
+	}
+	mine.Operator = operator
+	mine.UpdateTime = time.Now()
+	return true
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.school/config"
+	"omo.msa.school/proxy/nosql"
+)
+
+func setSign(t *testing.T, sign string) {
+	t.Helper()
+	old := config.Schema.Secret.Sign
+	config.Schema.Secret.Sign = sign
+	t.Cleanup(func() {
+		config.Schema.Secret.Sign = old
+	})
+}
+
+func newErasure() *nosql.Erasure {
+	db := new(nosql.Erasure)
+	db.UID = primitive.NewObjectID()
+	db.CreatedTime = time.Now()
+	db.Creator = "admin"
+	db.School = "school"
+	db.Type = uint8(ErasureStudent)
+	db.Target = "student"
+	db.Scopes = []string{"student", "leaves"}
+	return db
+}
+
+func TestCheckSignSecret(t *testing.T) {
+	setSign(t, "")
+	if checkSignSecret() == nil {
+		t.Fatal("the empty sign secret must be refused")
+	}
+	setSign(t, "  ")
+	if checkSignSecret() == nil {
+		t.Fatal("the blank sign secret must be refused")
+	}
+	setSign(t, "sign")
+	if err := checkSignSecret(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAnonymizeWithoutSignSecret(t *testing.T) {
+	setSign(t, "")
+	school := new(SchoolInfo)
+	school.UID = "school"
+	if _, err := school.AnonymizeStudent("student", "admin"); err == nil {
+		t.Fatal("the student erasure must be disabled without sign secret")
+	}
+	if _, err := school.AnonymizeCustodian("13800000000", "admin"); err == nil {
+		t.Fatal("the custodian erasure must be disabled without sign secret")
+	}
+}
+
+func TestErasureSignature(t *testing.T) {
+	setSign(t, "sign")
+	db := newErasure()
+	db.Signature = signErasure(db)
+	info := new(ErasureInfo)
+	info.initInfo(db)
+	if !info.Verified {
+		t.Fatal("the signature must be verified")
+	}
+
+	db.Scopes = append(db.Scopes, "bindings")
+	info.initInfo(db)
+	if info.Verified {
+		t.Fatal("the changed scopes must not be verified")
+	}
+
+	db.Scopes = db.Scopes[:2]
+	setSign(t, "other")
+	info.initInfo(db)
+	if info.Verified {
+		t.Fatal("the signature of other key must not be verified")
+	}
+}
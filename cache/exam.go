@@ -0,0 +1,408 @@
+package cache
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.school/proxy/nosql"
+	"sort"
+	"time"
+)
+
+type ExamInfo struct {
+	Grade uint8 `json:"grade"`
+	baseInfo
+	School  string    `json:"school"`
+	Term    string    `json:"term"`
+	Subject string    `json:"subject"`
+	Full    float32   `json:"full"`
+	Date    time.Time `json:"date"`
+}
+
+type ScoreInfo struct {
+	baseInfo
+	School  string  `json:"school"`
+	Exam    string  `json:"exam"`
+	Class   string  `json:"class"`
+	Student string  `json:"student"`
+	Value   float32 `json:"value"`
+	Remark  string  `json:"remark"`
+}
+
+// ScoreMark 按班级批量录入成绩时的单条记录
+type ScoreMark struct {
+	Student string
+	Value   float32
+	Remark  string
+}
+
+type ScoreRank struct {
+	Student string  `json:"student"`
+	Class   string  `json:"class"`
+	Value   float32 `json:"value"`
+	Rank    uint32  `json:"rank"`
+}
+
+// ScoreBucket 分数段，按满分的百分比划分
+type ScoreBucket struct {
+	Min   uint32 `json:"min"`
+	Max   uint32 `json:"max"`
+	Count uint32 `json:"count"`
+}
+
+type ScoreStatistic struct {
+	Exam         string         `json:"exam"`
+	Count        uint32         `json:"count"`
+	Average      float32        `json:"average"`
+	Max          float32        `json:"max"`
+	Min          float32        `json:"min"`
+	Distribution []*ScoreBucket `json:"distribution"`
+	Ranks        []*ScoreRank   `json:"ranks"`
+}
+
+// StudentScore 学生的历史成绩，附带考试信息
+type StudentScore struct {
+	Exam    string    `json:"exam"`
+	Name    string    `json:"name"`
+	Term    string    `json:"term"`
+	Subject string    `json:"subject"`
+	Full    float32   `json:"full"`
+	Date    time.Time `json:"date"`
+	Class   string    `json:"class"`
+	Value   float32   `json:"value"`
+	Rank    uint32    `json:"rank"`
+}
+
+func (mine *ExamInfo) initInfo(db *nosql.Exam) {
+	mine.UID = db.UID.Hex()
+	mine.ID = db.ID
+	mine.UpdateTime = db.UpdatedTime
+	mine.CreateTime = db.CreatedTime
+	mine.Creator = db.Creator
+	mine.Operator = db.Operator
+	mine.Name = db.Name
+	mine.School = db.School
+	mine.Term = db.Term
+	mine.Grade = db.Grade
+	mine.Subject = db.Subject
+	mine.Full = db.Full
+	mine.Date = db.Date
+}
+
+func (mine *ScoreInfo) initInfo(db *nosql.Score) {
+	mine.UID = db.UID.Hex()
+	mine.ID = db.ID
+	mine.UpdateTime = db.UpdatedTime
+	mine.CreateTime = db.CreatedTime
+	mine.Creator = db.Creator
+	mine.Operator = db.Operator
+	mine.School = db.School
+	mine.Exam = db.Exam
+	mine.Class = db.Class
+	mine.Student = db.Student
+	mine.Value = db.Value
+	mine.Remark = db.Remark
+}
+
+// CreateExam 考试按学期、年级、学科定义，学科必须是学校已有的学科
+func (mine *SchoolInfo) CreateExam(name, term, subject, operator string, grade uint8, full float32, date time.Time) (*ExamInfo, error) {
+	if name == "" {
+		return nil, errors.New("the exam name is empty")
+	}
+	if mine.GetSubject(subject) == nil {
+		return nil, errors.New("not found the subject")
+	}
+	if grade < 1 || grade > mine.MaxGrade() {
+		return nil, errors.New("the exam grade is error")
+	}
+	if full <= 0 {
+		return nil, errors.New("the exam full score is error")
+	}
+	db := new(nosql.Exam)
+	db.UID = primitive.NewObjectID()
+	db.ID = nosql.GetExamNextID()
+	db.CreatedTime = time.Now()
+	db.Creator = operator
+	db.Name = name
+	db.School = mine.UID
+	db.Term = term
+	db.Grade = grade
+	db.Subject = subject
+	db.Full = full
+	db.Date = switchDay(date)
+	err := nosql.CreateExam(db)
+	if err != nil {
+		return nil, err
+	}
+	info := new(ExamInfo)
+	info.initInfo(db)
+	return info, nil
+}
+
+func (mine *SchoolInfo) GetExam(uid string) *ExamInfo {
+	if uid == "" {
+		return nil
+	}
+	db, err := nosql.GetExam(uid)
+	if err != nil || db.School != mine.UID {
+		return nil
+	}
+	info := new(ExamInfo)
+	info.initInfo(db)
+	return info
+}
+
+// GetExams 学期为空时返回学校的所有考试
+func (mine *SchoolInfo) GetExams(term string) []*ExamInfo {
+	var dbs []*nosql.Exam
+	var err error
+	if term == "" {
+		dbs, err = nosql.GetExamsBySchool(mine.UID)
+	} else {
+		dbs, err = nosql.GetExamsByTerm(mine.UID, term)
+	}
+	list := make([]*ExamInfo, 0, len(dbs))
+	if err != nil {
+		return list
+	}
+	for _, db := range dbs {
+		info := new(ExamInfo)
+		info.initInfo(db)
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Date.Before(list[j].Date)
+	})
+	return list
+}
+
+func (mine *SchoolInfo) RemoveExam(uid, operator string) error {
+	if mine.GetExam(uid) == nil {
+		return errors.New("not found the exam")
+	}
+	return nosql.RemoveExam(uid, operator)
+}
+
+func (mine *ExamInfo) UpdateBase(name, term, operator string, full float32, date time.Time) error {
+	if full <= 0 {
+		return errors.New("the exam full score is error")
+	}
+	date = switchDay(date)
+	err := nosql.UpdateExamBase(mine.UID, name, term, operator, full, date)
+	if err == nil {
+		mine.Name = name
+		mine.Term = term
+		mine.Full = full
+		mine.Date = date
+		mine.Operator = operator
+		mine.UpdateTime = time.Now()
+	}
+	return err
+}
+
+// IsTeacher 判断用户是否是班级的任课老师或者班主任
+func (mine *ClassInfo) IsTeacher(user string) bool {
+	if mine.IsManager(user) {
+		return true
+	}
+	for _, uid := range mine.Teachers {
+		if uid == user {
+			return true
+		}
+		teacher := cacheCtx.GetTeacher(uid)
+		if teacher != nil && teacher.User == user {
+			return true
+		}
+	}
+	return false
+}
+
+// EnterScores 任课老师按班级批量录入成绩，已有的成绩会被覆盖
+func (mine *ClassInfo) EnterScores(exam *ExamInfo, operator string, marks []ScoreMark) ([]*ScoreInfo, error) {
+	if exam == nil || exam.School != mine.School {
+		return nil, errors.New("not found the exam")
+	}
+	if exam.Grade != mine.Grade() {
+		return nil, errors.New("the exam grade not match the class")
+	}
+	if !mine.IsTeacher(operator) {
+		return nil, errors.New("the operator is not the teacher of class")
+	}
+	for _, mark := range marks {
+		if !mine.HadStudent(mark.Student) {
+			return nil, errors.New("the student not in the class")
+		}
+		if mark.Value < 0 || mark.Value > exam.Full {
+			return nil, errors.New("the score is out of range")
+		}
+	}
+	var err error
+	list := make([]*ScoreInfo, 0, len(marks))
+	for _, mark := range marks {
+		info, er := mine.enterScore(exam, mark, operator)
+		if er != nil {
+			err = er
+			continue
+		}
+		list = append(list, info)
+	}
+	return list, err
+}
+
+func (mine *ClassInfo) enterScore(exam *ExamInfo, mark ScoreMark, operator string) (*ScoreInfo, error) {
+	old, _ := nosql.GetScoreBy(exam.UID, mark.Student)
+	if old != nil {
+		info := new(ScoreInfo)
+		info.initInfo(old)
+		if info.Value == mark.Value && info.Remark == mark.Remark && info.Class == mine.UID {
+			return info, nil
+		}
+		err := nosql.UpdateScoreValue(info.UID, mine.UID, mark.Remark, operator, mark.Value)
+		if err == nil {
+			info.Class = mine.UID
+			info.Value = mark.Value
+			info.Remark = mark.Remark
+			info.Operator = operator
+			info.UpdateTime = time.Now()
+		}
+		return info, err
+	}
+	db := new(nosql.Score)
+	db.UID = primitive.NewObjectID()
+	db.ID = nosql.GetScoreNextID()
+	db.CreatedTime = time.Now()
+	db.Creator = operator
+	db.School = mine.School
+	db.Exam = exam.UID
+	db.Class = mine.UID
+	db.Student = mark.Student
+	db.Value = mark.Value
+	db.Remark = mark.Remark
+	err := nosql.CreateScore(db)
+	if err != nil {
+		return nil, err
+	}
+	info := new(ScoreInfo)
+	info.initInfo(db)
+	return info, nil
+}
+
+func (mine *ExamInfo) GetScores(class string) []*ScoreInfo {
+	if class == "" {
+		return getScores(nosql.GetScoresByExam(mine.UID))
+	}
+	return getScores(nosql.GetScoresByClass(mine.UID, class))
+}
+
+// GetStatistic 班级为空时统计整个年级
+func (mine *ExamInfo) GetStatistic(class string) *ScoreStatistic {
+	return mine.statistic(mine.GetScores(class))
+}
+
+func (mine *ExamInfo) statistic(list []*ScoreInfo) *ScoreStatistic {
+	info := new(ScoreStatistic)
+	info.Exam = mine.UID
+	info.Distribution = []*ScoreBucket{{Min: 0, Max: 60}, {Min: 60, Max: 70}, {Min: 70, Max: 80},
+		{Min: 80, Max: 90}, {Min: 90, Max: 100}}
+	info.Ranks = rankScores(list)
+	info.Count = uint32(len(list))
+	if info.Count < 1 {
+		return info
+	}
+	var sum float32 = 0
+	info.Max = list[0].Value
+	info.Min = list[0].Value
+	for _, item := range list {
+		sum += item.Value
+		if item.Value > info.Max {
+			info.Max = item.Value
+		}
+		if item.Value < info.Min {
+			info.Min = item.Value
+		}
+		percent := uint32(item.Value * 100 / mine.Full)
+		for i, bucket := range info.Distribution {
+			if percent < bucket.Max || i == len(info.Distribution)-1 {
+				bucket.Count += 1
+				break
+			}
+		}
+	}
+	info.Average = sum / float32(info.Count)
+	return info
+}
+
+// rankScores 按分数从高到低排名，同分同名次
+func rankScores(list []*ScoreInfo) []*ScoreRank {
+	ranks := make([]*ScoreRank, 0, len(list))
+	for _, item := range list {
+		ranks = append(ranks, &ScoreRank{Student: item.Student, Class: item.Class, Value: item.Value})
+	}
+	sort.SliceStable(ranks, func(i, j int) bool {
+		return ranks[i].Value > ranks[j].Value
+	})
+	for i, item := range ranks {
+		if i > 0 && item.Value == ranks[i-1].Value {
+			item.Rank = ranks[i-1].Rank
+		} else {
+			item.Rank = uint32(i + 1)
+		}
+	}
+	return ranks
+}
+
+// GetStudentScores 学生的历史成绩，名次为年级排名，已删除的考试不返回；考试和各考试的成绩都一次查询
+func (mine *cacheContext) GetStudentScores(student string) []*StudentScore {
+	list := make([]*StudentScore, 0, 10)
+	scores := getScores(nosql.GetScoresByStudent(student))
+	if len(scores) < 1 {
+		return list
+	}
+	uids := make([]string, 0, len(scores))
+	for _, score := range scores {
+		uids = append(uids, score.Exam)
+	}
+	exams, err := nosql.GetExamsByList(uids)
+	if err != nil {
+		return list
+	}
+	dic := make(map[string]*nosql.Exam, len(exams))
+	for _, db := range exams {
+		dic[db.UID.Hex()] = db
+	}
+	groups := make(map[string][]*ScoreInfo, len(exams))
+	for _, item := range getScores(nosql.GetScoresByExams(uids)) {
+		groups[item.Exam] = append(groups[item.Exam], item)
+	}
+	for _, score := range scores {
+		db, ok := dic[score.Exam]
+		if !ok {
+			continue
+		}
+		item := &StudentScore{Exam: db.UID.Hex(), Name: db.Name, Term: db.Term, Subject: db.Subject, Full: db.Full,
+			Date: db.Date, Class: score.Class, Value: score.Value}
+		for _, rank := range rankScores(groups[score.Exam]) {
+			if rank.Student == student {
+				item.Rank = rank.Rank
+				break
+			}
+		}
+		list = append(list, item)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Date.Before(list[j].Date)
+	})
+	return list
+}
+
+func getScores(dbs []*nosql.Score, err error) []*ScoreInfo {
+	list := make([]*ScoreInfo, 0, len(dbs))
+	if err != nil {
+		return list
+	}
+	for _, db := range dbs {
+		info := new(ScoreInfo)
+		info.initInfo(db)
+		list = append(list, info)
+	}
+	return list
+}
@@ -0,0 +1,344 @@
+package cache
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.school/proxy/nosql"
+	"omo.msa.school/tool"
+	"time"
+)
+
+const (
+	FamilyPending   FamilyStatus = 0 // 系统推断，待管理员确认
+	FamilyConfirmed FamilyStatus = 1 // 已确认
+	FamilyRefused   FamilyStatus = 2 // 已拒绝
+)
+
+type FamilyStatus uint8
+
+type FamilyInfo struct {
+	Status FamilyStatus
+	baseInfo
+	Students []string
+	Phones   []string
+	Cards    []string
+	Removed  []string
+}
+
+func (mine *FamilyInfo) initInfo(db *nosql.Family) {
+	mine.UID = db.UID.Hex()
+	mine.ID = db.ID
+	mine.UpdateTime = db.UpdatedTime
+	mine.CreateTime = db.CreatedTime
+	mine.Creator = db.Creator
+	mine.Operator = db.Operator
+	mine.Name = db.Name
+	mine.Status = FamilyStatus(db.Status)
+	mine.Students = db.Students
+	mine.Phones = db.Phones
+	mine.Cards = db.Cards
+	mine.Removed = db.Removed
+	if mine.Removed == nil {
+		mine.Removed = make([]string, 0, 1)
+	}
+	if mine.Students == nil {
+		mine.Students = make([]string, 0, 1)
+	}
+	if mine.Phones == nil {
+		mine.Phones = make([]string, 0, 1)
+	}
+	if mine.Cards == nil {
+		mine.Cards = make([]string, 0, 1)
+	}
+}
+
+func (mine *cacheContext) GetFamily(uid string) *FamilyInfo {
+	if uid == "" {
+		return nil
+	}
+	db, err := nosql.GetFamily(uid)
+	if err == nil {
+		info := new(FamilyInfo)
+		info.initInfo(db)
+		return info
+	}
+	return nil
+}
+
+func (mine *cacheContext) GetFamilyByStudent(student string) *FamilyInfo {
+	if student == "" {
+		return nil
+	}
+	db, err := nosql.GetFamilyByStudent(student)
+	if err == nil {
+		info := new(FamilyInfo)
+		info.initInfo(db)
+		return info
+	}
+	return nil
+}
+
+func (mine *cacheContext) GetFamiliesByStatus(st FamilyStatus) []*FamilyInfo {
+	list := make([]*FamilyInfo, 0, 10)
+	dbs, err := nosql.GetFamiliesByStatus(uint8(st))
+	if err != nil {
+		return list
+	}
+	for _, db := range dbs {
+		info := new(FamilyInfo)
+		info.initInfo(db)
+		list = append(list, info)
+	}
+	return list
+}
+
+// CheckFamily 根据共同的监护人手机号或者身份证号推断学生所属的家庭，新发现的成员需要管理员重新确认；
+// 管理员拒绝的家庭以及移出的学生保持不变
+func (mine *cacheContext) CheckFamily(student *StudentInfo, operator string) (*FamilyInfo, error) {
+	if student == nil {
+		return nil, errors.New("the student is nil")
+	}
+	students := make([]string, 0, 4)
+	phones := make([]string, 0, 4)
+	cards := make([]string, 0, 2)
+	students = append(students, student.UID)
+	for _, custodian := range student.Custodians {
+		for _, phone := range custodian.Phones {
+			if phone == "" || tool.HasItem(phones, phone) {
+				continue
+			}
+			dbs, _ := nosql.GetStudentsByCustodian2(phone)
+			for _, db := range dbs {
+				if db.UID.Hex() == student.UID {
+					continue
+				}
+				if !tool.HasItem(phones, phone) {
+					phones = append(phones, phone)
+				}
+				if !tool.HasItem(students, db.UID.Hex()) {
+					students = append(students, db.UID.Hex())
+				}
+			}
+		}
+	}
+	for _, custodian := range student.Custodians {
+		card := custodian.Identity
+		if card == "" || tool.HasItem(cards, card) {
+			continue
+		}
+		dbs, _ := nosql.GetStudentsByCustodianCard(card)
+		for _, db := range dbs {
+			if db.UID.Hex() == student.UID {
+				continue
+			}
+			if !tool.HasItem(cards, card) {
+				cards = append(cards, card)
+			}
+			if !tool.HasItem(students, db.UID.Hex()) {
+				students = append(students, db.UID.Hex())
+			}
+		}
+	}
+
+	// 先找出所有相关的家庭，有被拒绝的家庭时不合并其他家庭
+	families := make([]*FamilyInfo, 0, 2)
+	for _, uid := range students {
+		tmp := mine.GetFamilyByStudent(uid)
+		if tmp == nil || hadFamily(families, tmp.UID) {
+			continue
+		}
+		if tmp.Status == FamilyRefused {
+			return tmp, nil
+		}
+		families = append(families, tmp)
+	}
+	var family *FamilyInfo
+	for _, tmp := range families {
+		if family == nil {
+			family = tmp
+			continue
+		}
+		err := family.merge(tmp, operator)
+		if err != nil {
+			return family, err
+		}
+	}
+	if len(students) < 2 && family == nil {
+		return nil, nil
+	}
+	if family == nil {
+		return mine.createFamily(student.Name, operator, students, phones, cards)
+	}
+	err := family.appendMembers(operator, students, phones, cards)
+	return family, err
+}
+
+func hadFamily(list []*FamilyInfo, uid string) bool {
+	for _, item := range list {
+		if item.UID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+func (mine *cacheContext) createFamily(name, operator string, students, phones, cards []string) (*FamilyInfo, error) {
+	db := new(nosql.Family)
+	db.UID = primitive.NewObjectID()
+	db.ID = nosql.GetFamilyNextID()
+	db.CreatedTime = time.Now()
+	db.Creator = operator
+	db.Name = name
+	db.Status = uint8(FamilyPending)
+	db.Students = students
+	db.Phones = phones
+	db.Cards = cards
+	err := nosql.CreateFamily(db)
+	if err != nil {
+		return nil, err
+	}
+	info := new(FamilyInfo)
+	info.initInfo(db)
+	return info, nil
+}
+
+func (mine *FamilyInfo) HadStudent(uid string) bool {
+	return tool.HasItem(mine.Students, uid)
+}
+
+func (mine *FamilyInfo) IsConfirmed() bool {
+	return mine.Status == FamilyConfirmed
+}
+
+func (mine *FamilyInfo) GetStudents() []*StudentInfo {
+	return cacheCtx.GetStudents(mine.Students)
+}
+
+// GetSiblings 获取同一个家庭中的其他学生
+func (mine *FamilyInfo) GetSiblings(student string) []*StudentInfo {
+	list := make([]*StudentInfo, 0, len(mine.Students))
+	for _, uid := range mine.Students {
+		if uid == student {
+			continue
+		}
+		info := cacheCtx.GetStudent(uid)
+		if info != nil {
+			list = append(list, info)
+		}
+	}
+	return list
+}
+
+func (mine *FamilyInfo) UpdateStatus(st FamilyStatus, operator string) error {
+	if mine.Status == st {
+		return nil
+	}
+	err := nosql.UpdateFamilyStatus(mine.UID, operator, uint8(st))
+	if err == nil {
+		mine.Status = st
+		mine.Operator = operator
+		mine.UpdateTime = time.Now()
+	}
+	return err
+}
+
+func (mine *FamilyInfo) appendMembers(operator string, students, phones, cards []string) error {
+	arr := make([]string, 0, len(mine.Students)+len(students))
+	arr = append(arr, mine.Students...)
+	changed := false
+	for _, uid := range students {
+		if !tool.HasItem(arr, uid) && !tool.HasItem(mine.Removed, uid) {
+			arr = append(arr, uid)
+			changed = true
+		}
+	}
+	pArr := make([]string, 0, len(mine.Phones)+len(phones))
+	pArr = append(pArr, mine.Phones...)
+	for _, phone := range phones {
+		if !tool.HasItem(pArr, phone) {
+			pArr = append(pArr, phone)
+		}
+	}
+	cArr := make([]string, 0, len(mine.Cards)+len(cards))
+	cArr = append(cArr, mine.Cards...)
+	for _, card := range cards {
+		if !tool.HasItem(cArr, card) {
+			cArr = append(cArr, card)
+		}
+	}
+	if !changed && len(pArr) == len(mine.Phones) && len(cArr) == len(mine.Cards) {
+		return nil
+	}
+	st := mine.Status
+	if changed {
+		st = FamilyPending
+	}
+	err := nosql.UpdateFamilyMembers(mine.UID, operator, uint8(st), arr, pArr, cArr)
+	if err == nil {
+		mine.Status = st
+		mine.Students = arr
+		mine.Phones = pArr
+		mine.Cards = cArr
+		mine.Operator = operator
+		mine.UpdateTime = time.Now()
+	}
+	return err
+}
+
+// merge 合并另一个家庭，被移出的学生也一起合并，避免重新加入
+func (mine *FamilyInfo) merge(other *FamilyInfo, operator string) error {
+	removed := make([]string, 0, len(mine.Removed)+len(other.Removed))
+	removed = append(removed, mine.Removed...)
+	for _, uid := range other.Removed {
+		if !tool.HasItem(removed, uid) {
+			removed = append(removed, uid)
+		}
+	}
+	if len(removed) > len(mine.Removed) {
+		err := nosql.UpdateFamilyRemoved(mine.UID, operator, removed)
+		if err != nil {
+			return err
+		}
+		mine.Removed = removed
+	}
+	err := mine.appendMembers(operator, other.Students, other.Phones, other.Cards)
+	if err != nil {
+		return err
+	}
+	return nosql.RemoveFamily(other.UID, operator)
+}
+
+// RemoveStudent 管理员解除错误推断的家庭关系
+func (mine *FamilyInfo) RemoveStudent(uid, operator string) error {
+	if !mine.HadStudent(uid) {
+		return errors.New("the student not in the family")
+	}
+	// 家庭保留被移出的学生，避免重新推断时再次加入
+	err := nosql.SubtractFamilyStudent(mine.UID, uid)
+	if err == nil {
+		for i := 0; i < len(mine.Students); i += 1 {
+			if mine.Students[i] == uid {
+				mine.Students = append(mine.Students[:i], mine.Students[i+1:]...)
+				break
+			}
+		}
+		mine.Removed = append(mine.Removed, uid)
+		mine.Operator = operator
+	}
+	return err
+}
+
+// UpdateCustodian 将监护人的修改同步到家庭中的所有兄弟姐妹
+func (mine *FamilyInfo) UpdateCustodian(student, name, phones, identify string) error {
+	if !mine.IsConfirmed() {
+		return errors.New("the family is not confirmed")
+	}
+	var err error
+	for _, sibling := range mine.GetSiblings(student) {
+		er := sibling.updateCustodian(name, phones, identify, false)
+		if er != nil {
+			err = er
+		}
+	}
+	return err
+}
@@ -0,0 +1,177 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"omo.msa.school/proxy"
+	"omo.msa.school/proxy/nosql"
+	"omo.msa.school/tool"
+	"time"
+)
+
+// CreateGroup 创建虚拟班(社团、选修课、兴趣小组)，不占用年级和班号，课表和行政班一样按班级UID关联
+func (mine *SchoolInfo) CreateGroup(name, operator string, teachers []string) (*ClassInfo, error) {
+	if name == "" {
+		return nil, errors.New("the group name is empty")
+	}
+	for _, item := range mine.GetGroups() {
+		if item.Name == name {
+			return nil, errors.New("the group name had existed")
+		}
+	}
+	now := time.Now()
+	enrol := fmt.Sprintf("%d/%d/%d", now.Year(), now.Month(), now.Day())
+	info, err := mine.createClass(name, enrol, operator, 0, ClassTypeVirtual)
+	if err != nil {
+		return nil, err
+	}
+	for _, teacher := range teachers {
+		_ = info.AppendTeacher(teacher)
+	}
+	return info, nil
+}
+
+func (mine *SchoolInfo) GetGroups() []*ClassInfo {
+	mine.initClasses()
+	list := make([]*ClassInfo, 0, 10)
+	for _, item := range mine.classes {
+		if item.IsVirtual() {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// GetGroupsByStudent 学生当前加入的所有虚拟班，不包含行政班
+func (mine *SchoolInfo) GetGroupsByStudent(uid string) []*ClassInfo {
+	list := make([]*ClassInfo, 0, 3)
+	if uid == "" {
+		return list
+	}
+	for _, item := range mine.GetGroups() {
+		if item.HadStudent(uid) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func (mine *SchoolInfo) GetGroupsByTeacher(teacher string) []*ClassInfo {
+	list := make([]*ClassInfo, 0, 3)
+	if teacher == "" {
+		return list
+	}
+	for _, item := range mine.GetGroups() {
+		if item.Master == teacher || tool.HasItem(item.Teachers, teacher) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func (mine *cacheContext) GetGroupsByStudent(uid string) []*ClassInfo {
+	list := make([]*ClassInfo, 0, 3)
+	for _, item := range mine.schools {
+		list = append(list, item.GetGroupsByStudent(uid)...)
+	}
+	return list
+}
+
+// JoinGroup 学生加入虚拟班，不影响学生的行政班和班号，退出过的学生重新加入时恢复原记录
+func (mine *ClassInfo) JoinGroup(operator string, students []string) error {
+	if !mine.IsVirtual() {
+		return errors.New("the class is not virtual")
+	}
+	members := make([]proxy.ClassMember, 0, len(mine.Members)+len(students))
+	members = append(members, mine.Members...)
+	joined := make([]string, 0, len(students))
+	for _, uid := range students {
+		info := cacheCtx.GetStudent(uid)
+		if info == nil || info.School != mine.School {
+			return errors.New("not found the student")
+		}
+		had := false
+		for i := 0; i < len(members); i += 1 {
+			if members[i].Student == uid {
+				had = true
+				if members[i].Status != uint8(StudentActive) {
+					members[i].Status = uint8(StudentActive)
+					members[i].Remark = ""
+					members[i].Updated = time.Now()
+					joined = append(joined, uid)
+				}
+				break
+			}
+		}
+		if !had {
+			members = append(members, proxy.ClassMember{
+				UID:     fmt.Sprintf("%s-%d", mine.UID, info.ID),
+				Student: uid,
+				Status:  uint8(StudentActive),
+				Updated: time.Now(),
+			})
+			joined = append(joined, uid)
+		}
+	}
+	if len(joined) < 1 {
+		return nil
+	}
+	capacity := mine.GetCapacity()
+	if capacity > 0 {
+		var count uint32 = 0
+		for _, item := range members {
+			if item.Status == uint8(StudentActive) {
+				count += 1
+			}
+		}
+		if count > capacity {
+			return ErrClassFull
+		}
+	}
+	err := mine.updateMembers(operator, members)
+	if err == nil {
+		for _, uid := range joined {
+			mine.joinMember(uid, operator)
+		}
+	}
+	return err
+}
+
+// LeaveGroup 学生退出虚拟班，成员记录保留为离开状态
+func (mine *ClassInfo) LeaveGroup(operator, remark string, students []string) error {
+	if !mine.IsVirtual() {
+		return errors.New("the class is not virtual")
+	}
+	members := make([]proxy.ClassMember, 0, len(mine.Members))
+	members = append(members, mine.Members...)
+	left := make([]string, 0, len(students))
+	for i := 0; i < len(members); i += 1 {
+		if tool.HasItem(students, members[i].Student) && members[i].Status == uint8(StudentActive) {
+			members[i].Status = uint8(StudentLeave)
+			members[i].Remark = remark
+			members[i].Updated = time.Now()
+			left = append(left, members[i].Student)
+		}
+	}
+	if len(left) < 1 {
+		return nil
+	}
+	err := mine.updateMembers(operator, members)
+	if err == nil {
+		for _, uid := range left {
+			mine.leaveMember(uid, remark, operator, time.Now())
+		}
+		mine.fillSeats(operator)
+	}
+	return err
+}
+
+func (mine *ClassInfo) updateMembers(operator string, members []proxy.ClassMember) error {
+	err := nosql.UpdateClassStudents(mine.UID, operator, members)
+	if err == nil {
+		mine.Members = members
+		mine.Operator = operator
+		mine.UpdateTime = time.Now()
+	}
+	return err
+}
@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.school/proxy"
+	"omo.msa.school/proxy/nosql"
+	"time"
+)
+
+const (
+	LeavePending   LeaveStatus = 0 // 待审批
+	LeaveApproved  LeaveStatus = 1 // 已批准
+	LeaveRejected  LeaveStatus = 2 // 已驳回
+	LeaveCancelled LeaveStatus = 3 // 申请人撤销
+)
+
+type LeaveStatus uint8
+
+type LeaveInfo struct {
+	Status LeaveStatus `json:"status"`
+	baseInfo
+	School    string                `json:"school"`
+	Class     string                `json:"class"`
+	Student   string                `json:"student"`
+	Applicant string                `json:"applicant"`
+	Reason    string                `json:"reason"`
+	Approver  string                `json:"approver"`
+	From      time.Time             `json:"from"`
+	To        time.Time             `json:"to"`
+	Histories []proxy.StatusHistory `json:"histories"`
+}
+
+func (mine *LeaveInfo) initInfo(db *nosql.Leave) {
+	mine.UID = db.UID.Hex()
+	mine.ID = db.ID
+	mine.UpdateTime = db.UpdatedTime
+	mine.CreateTime = db.CreatedTime
+	mine.Creator = db.Creator
+	mine.Operator = db.Operator
+	mine.School = db.School
+	mine.Class = db.Class
+	mine.Student = db.Student
+	mine.Applicant = db.Applicant
+	mine.Reason = db.Reason
+	mine.Approver = db.Approver
+	mine.From = db.From
+	mine.To = db.To
+	mine.Status = LeaveStatus(db.Status)
+	mine.Histories = db.Histories
+	if mine.Histories == nil {
+		mine.Histories = make([]proxy.StatusHistory, 0, 1)
+	}
+}
+
+// SubmitLeave 监护人通过手机号或者实体为学生提交请假申请
+func (mine *SchoolInfo) SubmitLeave(student, applicant, reason string, from, to time.Time) (*LeaveInfo, error) {
+	if applicant == "" {
+		return nil, errors.New("the applicant is empty")
+	}
+	class, info := mine.GetClassAndStudent(student)
+	if info == nil {
+		return nil, errors.New("not found the student")
+	}
+	if class == nil {
+		return nil, errors.New("not found the class of student")
+	}
+	if !info.HadCustodian(applicant) && info.Entity != applicant {
+		return nil, errors.New("the applicant is not the custodian of student")
+	}
+	from = switchDay(from)
+	to = switchDay(to)
+	if to.Before(from) {
+		return nil, errors.New("the leave date range is error")
+	}
+	db := new(nosql.Leave)
+	db.UID = primitive.NewObjectID()
+	db.ID = nosql.GetLeaveNextID()
+	db.CreatedTime = time.Now()
+	db.Creator = applicant
+	db.School = mine.UID
+	db.Class = class.UID
+	db.Student = info.UID
+	db.Applicant = applicant
+	db.Reason = reason
+	db.From = from
+	db.To = to
+	db.Status = uint8(LeavePending)
+	db.Histories = []proxy.StatusHistory{{Status: uint8(LeavePending), Operator: applicant, Remark: reason, Created: uint64(time.Now().Unix())}}
+	err := nosql.CreateLeave(db)
+	if err != nil {
+		return nil, err
+	}
+	tmp := new(LeaveInfo)
+	tmp.initInfo(db)
+	return tmp, nil
+}
+
+func (mine *cacheContext) GetLeave(uid string) *LeaveInfo {
+	if uid == "" {
+		return nil
+	}
+	db, err := nosql.GetLeave(uid)
+	if err == nil {
+		info := new(LeaveInfo)
+		info.initInfo(db)
+		return info
+	}
+	return nil
+}
+
+func (mine *cacheContext) GetLeavesByStudent(student string) []*LeaveInfo {
+	return getLeaves(nosql.GetLeavesByStudent(student))
+}
+
+func (mine *cacheContext) GetLeavesByApplicant(applicant string) []*LeaveInfo {
+	return getLeaves(nosql.GetLeavesByApplicant(applicant))
+}
+
+func (mine *ClassInfo) GetLeaves(st LeaveStatus, all bool) []*LeaveInfo {
+	if all {
+		return getLeaves(nosql.GetLeavesByClass(mine.UID))
+	}
+	return getLeaves(nosql.GetLeavesByClassStatus(mine.UID, uint8(st)))
+}
+
+func getLeaves(dbs []*nosql.Leave, err error) []*LeaveInfo {
+	list := make([]*LeaveInfo, 0, len(dbs))
+	if err != nil {
+		return list
+	}
+	for _, db := range dbs {
+		info := new(LeaveInfo)
+		info.initInfo(db)
+		list = append(list, info)
+	}
+	return list
+}
+
+// Approve 班主任或者副班主任批准请假，请假期间每天课程表中的节次自动记为请假，不上课的日子跳过
+func (mine *LeaveInfo) Approve(operator, remark string) error {
+	class, err := mine.checkApprover(operator)
+	if err != nil {
+		return err
+	}
+	err = mine.updateStatus(LeaveApproved, operator, remark)
+	if err != nil {
+		return err
+	}
+	for day := switchDay(mine.From); !day.After(mine.To); day = day.AddDate(0, 0, 1) {
+		if !class.HadStudent(mine.Student) {
+			break
+		}
+		for _, period := range class.getPeriods(day) {
+			_, er := class.markAttendance(mine.Student, day, period, AttendExcused, mine.Reason, operator)
+			if er != nil {
+				err = er
+			}
+		}
+	}
+	return err
+}
+
+func (mine *LeaveInfo) Reject(operator, remark string) error {
+	_, err := mine.checkApprover(operator)
+	if err != nil {
+		return err
+	}
+	return mine.updateStatus(LeaveRejected, operator, remark)
+}
+
+// Cancel 申请人撤销还未审批的请假
+func (mine *LeaveInfo) Cancel(applicant, remark string) error {
+	if mine.Applicant != applicant {
+		return errors.New("the operator is not the applicant")
+	}
+	if mine.Status != LeavePending {
+		return errors.New("the leave had been handled")
+	}
+	return mine.updateStatus(LeaveCancelled, applicant, remark)
+}
+
+func (mine *LeaveInfo) checkApprover(operator string) (*ClassInfo, error) {
+	if mine.Status != LeavePending {
+		return nil, errors.New("the leave had been handled")
+	}
+	class := cacheCtx.GetClass(mine.Class)
+	if class == nil {
+		return nil, errors.New("not found the class")
+	}
+	if !class.IsManager(operator) {
+		return nil, errors.New("the operator is not the master of class")
+	}
+	return class, nil
+}
+
+func (mine *LeaveInfo) updateStatus(st LeaveStatus, operator, remark string) error {
+	approver := mine.Approver
+	if st == LeaveApproved || st == LeaveRejected {
+		approver = operator
+	}
+	err := nosql.UpdateLeaveStatus(mine.UID, operator, approver, uint8(st))
+	if err != nil {
+		return err
+	}
+	mine.Status = st
+	mine.Approver = approver
+	mine.Operator = operator
+	mine.UpdateTime = time.Now()
+	history := proxy.StatusHistory{Status: uint8(st), Operator: operator, Remark: remark, Created: uint64(time.Now().Unix())}
+	err = nosql.AppendLeaveHistory(mine.UID, &history)
+	if err == nil {
+		mine.Histories = append(mine.Histories, history)
+	}
+	return err
+}
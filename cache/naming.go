@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"errors"
+	"omo.msa.school/proxy"
+	"omo.msa.school/proxy/nosql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	NumeralDigit   = ""   // 阿拉伯数字
+	NumeralChinese = "zh" // 中文数字
+)
+
+const (
+	DefaultClassTemplate = "{grade}年级{number}班"
+	DefaultGradeTemplate = "{grade}年级"
+)
+
+type classNaming proxy.NamingInfo
+
+func defaultNaming() *classNaming {
+	return &classNaming{Template: DefaultClassTemplate, Grade: DefaultGradeTemplate}
+}
+
+// format 替换模板中的占位符，年级加上偏移后显示，如初中一年级偏移6显示为7
+func (mine *classNaming) format(grade uint8, number uint16, track, language string) string {
+	template := mine.Template
+	if template == "" {
+		template = DefaultClassTemplate
+	}
+	if number < 1 {
+		template = mine.Grade
+		if template == "" {
+			template = DefaultGradeTemplate
+		}
+	}
+	replacer := strings.NewReplacer(
+		"{stage}", mine.Stage,
+		"{grade}", mine.formatGrade(grade),
+		"{number}", mine.formatNumber(number),
+		"{track}", track,
+		"{language}", language)
+	return strings.TrimSpace(replacer.Replace(template))
+}
+
+func (mine *classNaming) formatGrade(grade uint8) string {
+	num := int(grade) + int(mine.Offset)
+	if mine.Numeral == NumeralChinese {
+		return chineseNumber(num)
+	}
+	return strconv.Itoa(num)
+}
+
+func (mine *classNaming) formatNumber(number uint16) string {
+	if mine.Letter && number > 0 && number <= 26 {
+		return string(rune('A' + number - 1))
+	}
+	return strconv.Itoa(int(number))
+}
+
+// chineseNumber 两位以内的中文数字
+func chineseNumber(num int) string {
+	digits := []string{"零", "一", "二", "三", "四", "五", "六", "七", "八", "九"}
+	if num < 0 || num > 99 {
+		return strconv.Itoa(num)
+	}
+	if num < 10 {
+		return digits[num]
+	}
+	msg := ""
+	if num/10 > 1 {
+		msg = digits[num/10]
+	}
+	msg += "十"
+	if num%10 > 0 {
+		msg += digits[num%10]
+	}
+	return msg
+}
+
+func (mine *SchoolInfo) FormatClassName(grade uint8, number uint16, track, language string) string {
+	naming := classNaming(mine.Naming)
+	return naming.format(grade, number, track, language)
+}
+
+func (mine *SchoolInfo) FormatGradeName(grade uint8) string {
+	return mine.FormatClassName(grade, 0, "", "")
+}
+
+// UpdateNaming 模板为空时恢复默认的命名
+func (mine *SchoolInfo) UpdateNaming(operator string, info proxy.NamingInfo) error {
+	if info.Numeral != NumeralDigit && info.Numeral != NumeralChinese {
+		return errors.New("the naming numeral is error")
+	}
+	if info.Template != "" && !strings.Contains(info.Template, "{number}") {
+		return errors.New("the naming template must contain the number")
+	}
+	err := nosql.UpdateSchoolNaming(mine.UID, operator, info)
+	if err == nil {
+		mine.Naming = info
+		mine.Operator = operator
+		mine.UpdateTime = time.Now()
+	}
+	return err
+}
@@ -0,0 +1,19 @@
+package cache
+
+const TopicBinding = "omo.msa.school.binding"
+
+// NotifyHandler 由服务启动时注入，用于向消息总线发布事件
+type NotifyHandler func(topic string, msg interface{})
+
+var notifyHandler NotifyHandler
+
+func SetNotifyHandler(handler NotifyHandler) {
+	notifyHandler = handler
+}
+
+func notify(topic string, msg interface{}) {
+	if notifyHandler == nil {
+		return
+	}
+	go notifyHandler(topic, msg)
+}
@@ -0,0 +1,357 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"math/rand"
+	"omo.msa.school/proxy"
+	"omo.msa.school/proxy/nosql"
+	"omo.msa.school/tool"
+	"sort"
+	"time"
+)
+
+const (
+	DutyRuleOrder   = "order"   // 按班级成员顺序轮换
+	DutyRuleShuffle = "shuffle" // 打乱顺序后轮换
+)
+
+// ClassOfficerInfo 学生在某学期担任的班干部
+type ClassOfficerInfo struct {
+	baseInfo
+	School  string `json:"school"`
+	Class   string `json:"class"`
+	Student string `json:"student"`
+	Kind    string `json:"kind"`
+	Term    string `json:"term"`
+}
+
+type DutyInfo struct {
+	baseInfo
+	School   string    `json:"school"`
+	Class    string    `json:"class"`
+	Term     string    `json:"term"`
+	Date     time.Time `json:"date"`
+	Students []string  `json:"students"`
+}
+
+// DutyRule 值日排班规则，Size为每天的人数，Weekdays为空时为周一到周五
+type DutyRule struct {
+	Rule     string
+	Size     int
+	Weekdays []time.Weekday
+}
+
+func (mine *ClassOfficerInfo) initInfo(db *nosql.Officer) {
+	mine.UID = db.UID.Hex()
+	mine.ID = db.ID
+	mine.UpdateTime = db.UpdatedTime
+	mine.CreateTime = db.CreatedTime
+	mine.Creator = db.Creator
+	mine.Operator = db.Operator
+	mine.School = db.School
+	mine.Class = db.Class
+	mine.Student = db.Student
+	mine.Kind = db.Kind
+	mine.Term = db.Term
+}
+
+func (mine *DutyInfo) initInfo(db *nosql.Duty) {
+	mine.UID = db.UID.Hex()
+	mine.ID = db.ID
+	mine.UpdateTime = db.UpdatedTime
+	mine.CreateTime = db.CreatedTime
+	mine.Creator = db.Creator
+	mine.Operator = db.Operator
+	mine.School = db.School
+	mine.Class = db.Class
+	mine.Term = db.Term
+	mine.Date = db.Date
+	mine.Students = db.Students
+}
+
+func (mine *SchoolInfo) GetOfficerType(uid string) *proxy.OfficerInfo {
+	for i := 0; i < len(mine.Officers); i += 1 {
+		if mine.Officers[i].UID == uid {
+			return &mine.Officers[i]
+		}
+	}
+	return nil
+}
+
+func (mine *SchoolInfo) CreateOfficerType(name, remark, operator string, limit uint32) (*proxy.OfficerInfo, error) {
+	if name == "" {
+		return nil, errors.New("the officer name is empty")
+	}
+	for _, item := range mine.Officers {
+		if item.Name == name {
+			return nil, errors.New("the officer name had existed")
+		}
+	}
+	uuid := fmt.Sprintf("%s-%d", mine.UID, nosql.GetSchoolOfficerNextID())
+	info := proxy.OfficerInfo{
+		UID:    uuid,
+		Name:   name,
+		Limit:  limit,
+		Remark: remark,
+	}
+	err := nosql.AppendSchoolOfficer(mine.UID, info)
+	if err != nil {
+		return nil, err
+	}
+	mine.Officers = append(mine.Officers, info)
+	mine.Operator = operator
+	return &mine.Officers[len(mine.Officers)-1], nil
+}
+
+func (mine *SchoolInfo) UpdateOfficerType(uid, name, remark, operator string, limit uint32) error {
+	if mine.GetOfficerType(uid) == nil {
+		return errors.New("not found the officer type")
+	}
+	if name == "" {
+		return errors.New("the officer name is empty")
+	}
+	list := make([]proxy.OfficerInfo, 0, len(mine.Officers))
+	for _, item := range mine.Officers {
+		if item.UID == uid {
+			item.Name = name
+			item.Limit = limit
+			item.Remark = remark
+		} else if item.Name == name {
+			return errors.New("the officer name had existed")
+		}
+		list = append(list, item)
+	}
+	err := nosql.UpdateSchoolOfficers(mine.UID, operator, list)
+	if err == nil {
+		mine.Officers = list
+		mine.Operator = operator
+		mine.UpdateTime = time.Now()
+	}
+	return err
+}
+
+// RemoveOfficerType 删除班干部类别，已有的任职记录保留
+func (mine *SchoolInfo) RemoveOfficerType(uid, operator string) error {
+	if mine.GetOfficerType(uid) == nil {
+		return errors.New("not found the officer type")
+	}
+	err := nosql.SubtractSchoolOfficer(mine.UID, uid)
+	if err == nil {
+		for i := 0; i < len(mine.Officers); i += 1 {
+			if mine.Officers[i].UID == uid {
+				mine.Officers = append(mine.Officers[:i], mine.Officers[i+1:]...)
+				break
+			}
+		}
+		mine.Operator = operator
+	}
+	return err
+}
+
+// SetOfficers 班主任设置某学期某类班干部的学生，不在列表中的原任职记录会被删除
+func (mine *SchoolInfo) SetOfficers(class *ClassInfo, kind, term, operator string, students []string) ([]*ClassOfficerInfo, error) {
+	if class == nil || class.School != mine.UID {
+		return nil, errors.New("not found the class")
+	}
+	if !class.IsManager(operator) {
+		return nil, errors.New("the operator is not the master of class")
+	}
+	if term == "" {
+		return nil, errors.New("the term is empty")
+	}
+	info := mine.GetOfficerType(kind)
+	if info == nil {
+		return nil, errors.New("not found the officer type")
+	}
+	if info.Limit > 0 && uint32(len(students)) > info.Limit {
+		return nil, errors.New("the officer count is over the limit")
+	}
+	for _, student := range students {
+		if !class.HadStudent(student) {
+			return nil, errors.New("the student not in the class")
+		}
+	}
+	list := make([]*ClassOfficerInfo, 0, len(students))
+	had := make([]string, 0, len(students))
+	for _, item := range class.GetOfficers(term) {
+		if item.Kind != kind {
+			continue
+		}
+		if tool.HasItem(students, item.Student) {
+			had = append(had, item.Student)
+			list = append(list, item)
+			continue
+		}
+		err := nosql.RemoveOfficer(item.UID, operator)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, student := range students {
+		if tool.HasItem(had, student) {
+			continue
+		}
+		db := new(nosql.Officer)
+		db.UID = primitive.NewObjectID()
+		db.ID = nosql.GetOfficerNextID()
+		db.CreatedTime = time.Now()
+		db.Creator = operator
+		db.School = mine.UID
+		db.Class = class.UID
+		db.Student = student
+		db.Kind = kind
+		db.Term = term
+		err := nosql.CreateOfficer(db)
+		if err != nil {
+			return list, err
+		}
+		tmp := new(ClassOfficerInfo)
+		tmp.initInfo(db)
+		list = append(list, tmp)
+	}
+	return list, nil
+}
+
+func (mine *SchoolInfo) RemoveOfficer(uid, operator string) error {
+	db, err := nosql.GetOfficer(uid)
+	if err != nil || db.School != mine.UID {
+		return errors.New("not found the officer")
+	}
+	class := mine.GetClass(db.Class)
+	if class == nil || !class.IsManager(operator) {
+		return errors.New("the operator can not remove the officer")
+	}
+	return nosql.RemoveOfficer(uid, operator)
+}
+
+func (mine *ClassInfo) GetOfficers(term string) []*ClassOfficerInfo {
+	list := make([]*ClassOfficerInfo, 0, 10)
+	dbs, err := nosql.GetOfficersByClass(mine.UID, term)
+	if err != nil {
+		return list
+	}
+	for _, db := range dbs {
+		info := new(ClassOfficerInfo)
+		info.initInfo(db)
+		list = append(list, info)
+	}
+	return list
+}
+
+// GenerateDuties 按规则生成日期范围内的值日表，范围内已有的值日会被替换，轮换接着范围之前的最后一次值日继续
+func (mine *ClassInfo) GenerateDuties(term, operator string, from, to time.Time, rule DutyRule) ([]*DutyInfo, error) {
+	if !mine.IsManager(operator) {
+		return nil, errors.New("the operator is not the master of class")
+	}
+	if term == "" {
+		return nil, errors.New("the term is empty")
+	}
+	from = switchDay(from)
+	to = switchDay(to)
+	if to.Before(from) {
+		return nil, errors.New("the date range is error")
+	}
+	students := mine.GetActiveStudents()
+	if len(students) < 1 {
+		return nil, errors.New("the class students is empty")
+	}
+	if rule.Size < 1 || rule.Size > len(students) {
+		return nil, errors.New("the duty size is error")
+	}
+	weekdays := rule.Weekdays
+	if len(weekdays) < 1 {
+		weekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	}
+	next := 0
+	if rule.Rule == DutyRuleShuffle {
+		rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+		rnd.Shuffle(len(students), func(i, j int) {
+			students[i], students[j] = students[j], students[i]
+		})
+	} else if rule.Rule != DutyRuleOrder && rule.Rule != "" {
+		return nil, errors.New("the duty rule is error")
+	}
+	var last *DutyInfo
+	for _, item := range mine.GetDuties(term, time.Time{}, time.Time{}) {
+		if !item.Date.Before(from) && !item.Date.After(to) {
+			err := nosql.RemoveDuty(item.UID, operator)
+			if err != nil {
+				return nil, err
+			}
+		} else if item.Date.Before(from) && rule.Rule != DutyRuleShuffle {
+			last = item
+		}
+	}
+	if last != nil && len(last.Students) > 0 {
+		for i, student := range students {
+			if student == last.Students[len(last.Students)-1] {
+				next = i + 1
+				break
+			}
+		}
+	}
+	list := make([]*DutyInfo, 0, 30)
+	for date := from; !date.After(to); date = date.AddDate(0, 0, 1) {
+		if !hadWeekday(weekdays, date.Weekday()) {
+			continue
+		}
+		arr := make([]string, 0, rule.Size)
+		for i := 0; i < rule.Size; i += 1 {
+			arr = append(arr, students[(next+i)%len(students)])
+		}
+		next = (next + rule.Size) % len(students)
+		db := new(nosql.Duty)
+		db.UID = primitive.NewObjectID()
+		db.ID = nosql.GetDutyNextID()
+		db.CreatedTime = time.Now()
+		db.Creator = operator
+		db.School = mine.School
+		db.Class = mine.UID
+		db.Term = term
+		db.Date = date
+		db.Students = arr
+		err := nosql.CreateDuty(db)
+		if err != nil {
+			return list, err
+		}
+		info := new(DutyInfo)
+		info.initInfo(db)
+		list = append(list, info)
+	}
+	return list, nil
+}
+
+// GetDuties 日期为空时不限制范围
+func (mine *ClassInfo) GetDuties(term string, from, to time.Time) []*DutyInfo {
+	list := make([]*DutyInfo, 0, 30)
+	dbs, err := nosql.GetDutiesByClass(mine.UID, term)
+	if err != nil {
+		return list
+	}
+	for _, db := range dbs {
+		if !from.IsZero() && db.Date.Before(switchDay(from)) {
+			continue
+		}
+		if !to.IsZero() && db.Date.After(switchDay(to)) {
+			continue
+		}
+		info := new(DutyInfo)
+		info.initInfo(db)
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Date.Before(list[j].Date)
+	})
+	return list
+}
+
+func hadWeekday(list []time.Weekday, day time.Weekday) bool {
+	for _, item := range list {
+		if item == day {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,296 @@
+package cache
+
+import (
+	"errors"
+	"omo.msa.school/proxy/nosql"
+	"omo.msa.school/tool"
+	"sort"
+)
+
+const (
+	PlanSplit = "split"
+	PlanMerge = "merge"
+)
+
+// ClassPlanItem 调整后的一个班级，Class为空表示需要新建
+type ClassPlanItem struct {
+	Class    string   `json:"class"`
+	Number   uint16   `json:"number"`
+	Master   string   `json:"master"`
+	Teachers []string `json:"teachers"`
+	Students []string `json:"students"`
+}
+
+// ClassPlan 分班或者合班的方案，执行前可以预览
+type ClassPlan struct {
+	Type    string           `json:"type"`
+	Sources []string         `json:"sources"`
+	Items   []*ClassPlanItem `json:"items"`
+}
+
+// PlanSplitClass 将一个班级拆分为count个班级，原班级保留为第一个班级；
+// assign为学生到班级序号(从1开始)的指定分配，未指定的学生按性别均衡分配
+func (mine *SchoolInfo) PlanSplitClass(uid string, count int, assign map[string]int) (*ClassPlan, error) {
+	class := mine.GetClass(uid)
+	if class == nil {
+		return nil, errors.New("not found the class")
+	}
+	if class.IsVirtual() {
+		return nil, errors.New("the virtual class can not split")
+	}
+	if count < 2 {
+		return nil, errors.New("the split count must more than 1")
+	}
+	plan := &ClassPlan{Type: PlanSplit, Sources: []string{class.UID}, Items: make([]*ClassPlanItem, 0, count)}
+	numbers := mine.nextClassNumbers(class, count-1)
+	for i := 0; i < count; i += 1 {
+		item := &ClassPlanItem{Teachers: class.Teachers, Students: make([]string, 0, len(class.Members)/count+1)}
+		if i == 0 {
+			item.Class = class.UID
+			item.Number = class.Number
+			item.Master = class.Master
+		} else {
+			item.Number = numbers[i-1]
+		}
+		plan.Items = append(plan.Items, item)
+	}
+	students := class.GetStudentsByStatus(StudentActive)
+	rest := make([]*StudentInfo, 0, len(students))
+	for _, student := range students {
+		if part, ok := assign[student]; ok {
+			if part < 1 || part > count {
+				return nil, errors.New("the assigned class index is out of range")
+			}
+			plan.Items[part-1].Students = append(plan.Items[part-1].Students, student)
+			continue
+		}
+		info := cacheCtx.GetStudent(student)
+		if info != nil {
+			rest = append(rest, info)
+		}
+	}
+	for student := range assign {
+		if !tool.HasItem(students, student) {
+			return nil, errors.New("the assigned student not in the class")
+		}
+	}
+	sort.SliceStable(rest, func(i, j int) bool {
+		if rest[i].Sex != rest[j].Sex {
+			return rest[i].Sex < rest[j].Sex
+		}
+		return rest[i].ClassNo < rest[j].ClassNo
+	})
+	for _, info := range rest {
+		// 每次分配给人数最少的班级，保证人数和性别都均衡
+		min := plan.Items[0]
+		for _, item := range plan.Items[1:] {
+			if len(item.Students) < len(min.Students) {
+				min = item
+			}
+		}
+		min.Students = append(min.Students, info.UID)
+	}
+	return plan, nil
+}
+
+// PlanMergeClasses 将多个班级合并到目标班级，只能合并同一年级的班级
+func (mine *SchoolInfo) PlanMergeClasses(target string, sources []string) (*ClassPlan, error) {
+	class := mine.GetClass(target)
+	if class == nil {
+		return nil, errors.New("not found the target class")
+	}
+	if len(sources) < 1 {
+		return nil, errors.New("the source classes is empty")
+	}
+	if class.IsVirtual() {
+		return nil, errors.New("the virtual class can not merge")
+	}
+	item := &ClassPlanItem{Class: class.UID, Number: class.Number, Master: class.Master,
+		Teachers: make([]string, 0, len(class.Teachers)), Students: class.GetStudentsByStatus(StudentActive)}
+	item.Teachers = append(item.Teachers, class.Teachers...)
+	plan := &ClassPlan{Type: PlanMerge, Sources: make([]string, 0, len(sources)), Items: []*ClassPlanItem{item}}
+	for _, uid := range sources {
+		if uid == target || tool.HasItem(plan.Sources, uid) {
+			continue
+		}
+		source := mine.GetClass(uid)
+		if source == nil {
+			return nil, errors.New("not found the source class")
+		}
+		if source.IsVirtual() || source.Grade() != class.Grade() {
+			return nil, errors.New("the source class not in the same grade")
+		}
+		plan.Sources = append(plan.Sources, source.UID)
+		if item.Master == "" {
+			item.Master = source.Master
+		}
+		for _, teacher := range source.Teachers {
+			if !tool.HasItem(item.Teachers, teacher) {
+				item.Teachers = append(item.Teachers, teacher)
+			}
+		}
+		item.Students = append(item.Students, source.GetStudentsByStatus(StudentActive)...)
+	}
+	if len(plan.Sources) < 1 {
+		return nil, errors.New("the source classes is empty")
+	}
+	return plan, nil
+}
+
+// ExecutePlan 执行分班或者合班方案，学生的班级履历通过转班保留，合并后的空班级归档；
+// 执行前检查整个方案，执行中失败时返回已经处理的班级
+func (mine *SchoolInfo) ExecutePlan(plan *ClassPlan, operator string) ([]*ClassInfo, error) {
+	if plan == nil || len(plan.Items) < 1 || len(plan.Sources) < 1 {
+		return nil, errors.New("the class plan is empty")
+	}
+	first := mine.GetClass(plan.Sources[0])
+	if first == nil {
+		return nil, errors.New("not found the source class")
+	}
+	remark := "split class"
+	if plan.Type == PlanMerge {
+		remark = "merge class"
+	}
+	err := mine.checkPlan(plan, first)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*ClassInfo, 0, len(plan.Items))
+	for _, item := range plan.Items {
+		var class *ClassInfo
+		if item.Class == "" {
+			tmp, err := mine.createClass("", first.EnrolDate.String(), operator, item.Number, first.Type)
+			if err != nil {
+				return list, err
+			}
+			class = tmp
+		} else {
+			class = mine.GetClass(item.Class)
+		}
+		list = append(list, class)
+		if class.Master == "" && item.Master != "" {
+			err = class.UpdateMaster(item.Master, operator)
+			if err != nil {
+				return list, err
+			}
+		}
+		for _, teacher := range item.Teachers {
+			err = class.AppendTeacher(teacher)
+			if err != nil {
+				return list, err
+			}
+		}
+		for _, student := range item.Students {
+			if class.HadStudent(student) {
+				continue
+			}
+			info := cacheCtx.GetStudent(student)
+			from := mine.GetClassByStudent(student, StudentActive)
+			err = class.moveStudent(info, from, remark, operator)
+			if err != nil {
+				return list, err
+			}
+		}
+	}
+	if plan.Type == PlanMerge {
+		for _, uid := range plan.Sources {
+			source := mine.GetClass(uid)
+			if source == nil || len(source.GetStudentsByStatus(StudentActive)) > 0 {
+				continue
+			}
+			// 合并后的空班级归档而不是删除，保留学生在原班级的成员和在籍记录
+			err := nosql.UpdateClassStatus(uid, operator, uint8(ClassStatusArchived))
+			if err != nil {
+				return list, err
+			}
+			source.Status = ClassStatusArchived
+			mine.removeCacheClass(uid)
+		}
+	}
+	return list, nil
+}
+
+// checkPlan 执行前检查方案中的班级、容量、老师和学生，避免执行到一半才失败
+func (mine *SchoolInfo) checkPlan(plan *ClassPlan, first *ClassInfo) error {
+	sources := make([]*ClassInfo, 0, len(plan.Sources))
+	for _, uid := range plan.Sources {
+		source := mine.GetClass(uid)
+		if source == nil {
+			return errors.New("not found the source class")
+		}
+		sources = append(sources, source)
+	}
+	numbers := make([]uint16, 0, len(plan.Items))
+	students := make([]string, 0, 50)
+	for _, item := range plan.Items {
+		capacity := mine.GetGradeCapacity(first.Grade())
+		var class *ClassInfo
+		if item.Class == "" {
+			if mine.GetClassByEnrol(&first.EnrolDate, item.Number) != nil {
+				return errors.New("the class number had existed")
+			}
+			for _, num := range numbers {
+				if num == item.Number {
+					return errors.New("the class number is repeated in the plan")
+				}
+			}
+			numbers = append(numbers, item.Number)
+		} else {
+			class = mine.GetClass(item.Class)
+			if class == nil {
+				return errors.New("not found the class")
+			}
+			capacity = class.GetCapacity()
+		}
+		if capacity > 0 && uint32(len(item.Students)) > capacity {
+			return errors.New("the class plan is over capacity")
+		}
+		if item.Master != "" && !mine.hadTeacher(item.Master) {
+			return errors.New("not found the master in the school")
+		}
+		for _, teacher := range item.Teachers {
+			if !mine.hadTeacher(teacher) {
+				return errors.New("not found the teacher in the school")
+			}
+		}
+		for _, student := range item.Students {
+			if tool.HasItem(students, student) {
+				return errors.New("the student is repeated in the plan")
+			}
+			students = append(students, student)
+			if class != nil && class.HadStudent(student) {
+				continue
+			}
+			if cacheCtx.GetStudent(student) == nil {
+				return errors.New("not found the student")
+			}
+			had := false
+			for _, source := range sources {
+				if source.HadStudent(student) {
+					had = true
+					break
+				}
+			}
+			if !had {
+				return errors.New("the student not in the source classes")
+			}
+		}
+	}
+	return nil
+}
+
+// nextClassNumbers 同一入学年份中还未使用的班号
+func (mine *SchoolInfo) nextClassNumbers(class *ClassInfo, count int) []uint16 {
+	list := make([]uint16, 0, count)
+	var max uint16 = 0
+	mine.initClasses()
+	for _, item := range mine.classes {
+		if !item.IsVirtual() && item.EnrolDate.Year == class.EnrolDate.Year && item.Number > max {
+			max = item.Number
+		}
+	}
+	for i := 1; i <= count; i += 1 {
+		list = append(list, max+uint16(i))
+	}
+	return list
+}
@@ -0,0 +1,257 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"github.com/micro/go-micro/v2/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.school/proxy"
+	"omo.msa.school/proxy/nosql"
+	"omo.msa.school/tool"
+	"sort"
+	"time"
+)
+
+const DefaultEnrolMonth = 9
+
+// RolloverClass 升级时新建的班级，预览时UID为空
+type RolloverClass struct {
+	UID    string `json:"uid"`
+	Number uint16 `json:"number"`
+	Enrol  string `json:"enrol"`
+}
+
+// RolloverReport 学年升级报告，预览和执行返回同样的结构
+type RolloverReport struct {
+	UID       string           `json:"uid"`
+	School    string           `json:"school"`
+	Year      uint16           `json:"year"`
+	Preview   bool             `json:"preview"`
+	Created   []*RolloverClass `json:"created"`
+	Archived  []string         `json:"archived"`
+	Graduates []string         `json:"graduates"`
+	Operator  string           `json:"operator"`
+	Date      time.Time        `json:"date"`
+}
+
+// gradeInYear 班级在某学年开学后的年级
+func gradeInYear(enrol proxy.DateInfo, year uint16) uint8 {
+	diff := int(year) - int(enrol.Year)
+	if diff < 1 {
+		return 1
+	}
+	return uint8(diff + 1)
+}
+
+// graduatesIn 行政班在某学年升级时是否毕业
+func (mine *ClassInfo) graduatesIn(year uint16, max uint8) bool {
+	return !mine.IsVirtual() && gradeInYear(mine.EnrolDate, year) > max
+}
+
+// graduateClasses 某学年升级时毕业的行政班，超出最高年级的班级重启后不会加载到缓存，所以从数据库查找
+func (mine *SchoolInfo) graduateClasses(year uint16) []*ClassInfo {
+	list := make([]*ClassInfo, 0, 5)
+	dbs, err := nosql.GetClassesBySchool(mine.UID)
+	if err != nil {
+		logger.Warnf("get the classes of school %s failed: %s", mine.UID, err.Error())
+		return list
+	}
+	for _, db := range dbs {
+		class := mine.GetClass(db.UID.Hex())
+		if class == nil {
+			class = new(ClassInfo)
+			class.initInfo(mine.MaxGrade(), db)
+		}
+		if class.Status == ClassStatusArchived || !class.graduatesIn(year, mine.MaxGrade()) {
+			continue
+		}
+		list = append(list, class)
+	}
+	return list
+}
+
+func (mine *SchoolInfo) UpdateRolloverTemplate(operator string, classes uint16, month uint8) error {
+	if month < 1 || month > 12 {
+		month = DefaultEnrolMonth
+	}
+	info := proxy.RolloverInfo{Classes: classes, Month: month, Year: mine.Rollover.Year}
+	err := nosql.UpdateSchoolRollover(mine.UID, operator, info)
+	if err == nil {
+		mine.Rollover = info
+		mine.Operator = operator
+		mine.UpdateTime = time.Now()
+	}
+	return err
+}
+
+// PreviewRollover 预览某学年的升级结果，不修改任何数据
+func (mine *SchoolInfo) PreviewRollover(year uint16) *RolloverReport {
+	report := mine.planRollover(year)
+	report.Preview = true
+	return report
+}
+
+func (mine *SchoolInfo) planRollover(year uint16) *RolloverReport {
+	report := &RolloverReport{School: mine.UID, Year: year, Date: time.Now(),
+		Created: make([]*RolloverClass, 0, mine.Rollover.Classes), Archived: make([]string, 0, 5), Graduates: make([]string, 0, 50)}
+	month := mine.Rollover.Month
+	if month < 1 {
+		month = DefaultEnrolMonth
+	}
+	enrol := new(proxy.DateInfo)
+	_ = enrol.Parse(fmt.Sprintf("%d/%d/1", year, month))
+	for i := uint16(1); i <= mine.Rollover.Classes; i += 1 {
+		if mine.GetClassByEnrol(enrol, i) == nil {
+			report.Created = append(report.Created, &RolloverClass{Number: i, Enrol: enrol.String()})
+		}
+	}
+	for _, class := range mine.graduateClasses(year) {
+		report.Archived = append(report.Archived, class.UID)
+		report.Graduates = append(report.Graduates, class.GetStudentsByStatus(StudentActive)...)
+	}
+	return report
+}
+
+// ExecuteRollover 创建起始年级的班级，毕业班的学生设为毕业并归档班级，同一学年只能执行一次
+func (mine *SchoolInfo) ExecuteRollover(year uint16, operator string) (*RolloverReport, error) {
+	if year <= mine.Rollover.Year {
+		return nil, errors.New("the school had rollover in the year")
+	}
+	report := mine.planRollover(year)
+	report.Operator = operator
+	for _, item := range report.Created {
+		class, err := mine.createClass("", item.Enrol, operator, item.Number, ClassTypeDef)
+		if err != nil {
+			return nil, err
+		}
+		item.UID = class.UID
+	}
+	for _, class := range mine.graduateClasses(year) {
+		if !tool.HasItem(report.Archived, class.UID) {
+			continue
+		}
+		err := class.archive(operator)
+		if err != nil {
+			return nil, err
+		}
+		mine.removeCacheClass(class.UID)
+	}
+	info := mine.Rollover
+	info.Year = year
+	err := nosql.UpdateSchoolRollover(mine.UID, operator, info)
+	if err != nil {
+		return nil, err
+	}
+	mine.Rollover = info
+
+	db := new(nosql.Rollover)
+	db.UID = primitive.NewObjectID()
+	db.ID = nosql.GetRolloverNextID()
+	db.CreatedTime = report.Date
+	db.Creator = operator
+	db.School = mine.UID
+	db.Year = year
+	db.Created = make([]string, 0, len(report.Created))
+	for _, item := range report.Created {
+		db.Created = append(db.Created, item.UID)
+	}
+	db.Archived = report.Archived
+	db.Graduates = report.Graduates
+	err = nosql.CreateRollover(db)
+	if err != nil {
+		return nil, err
+	}
+	report.UID = db.UID.Hex()
+	return report, nil
+}
+
+func (mine *SchoolInfo) GetRollovers() []*RolloverReport {
+	list := make([]*RolloverReport, 0, 5)
+	dbs, err := nosql.GetRolloversBySchool(mine.UID)
+	if err != nil {
+		return list
+	}
+	for _, db := range dbs {
+		report := &RolloverReport{UID: db.UID.Hex(), School: db.School, Year: db.Year, Archived: db.Archived,
+			Graduates: db.Graduates, Operator: db.Creator, Date: db.CreatedTime}
+		report.Created = make([]*RolloverClass, 0, len(db.Created))
+		for _, uid := range db.Created {
+			report.Created = append(report.Created, &RolloverClass{UID: uid})
+		}
+		list = append(list, report)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Year < list[j].Year
+	})
+	return list
+}
+
+func (mine *SchoolInfo) removeCacheClass(uid string) {
+	for i := 0; i < len(mine.classes); i += 1 {
+		if mine.classes[i].UID == uid {
+			mine.classes = append(mine.classes[:i], mine.classes[i+1:]...)
+			break
+		}
+	}
+}
+
+// archive 在读学生设为毕业后归档班级
+func (mine *ClassInfo) archive(operator string) error {
+	members := make([]proxy.ClassMember, 0, len(mine.Members))
+	members = append(members, mine.Members...)
+	graduates := make([]string, 0, len(members))
+	for i := 0; i < len(members); i += 1 {
+		if members[i].Status != uint8(StudentActive) {
+			continue
+		}
+		graduates = append(graduates, members[i].Student)
+		student := cacheCtx.GetStudent(members[i].Student)
+		if student != nil {
+			_ = student.UpdateStatus(StudentFinish, operator)
+		}
+		members[i].Status = uint8(StudentFinish)
+		members[i].Updated = time.Now()
+	}
+	err := mine.updateMembers(operator, members)
+	if err != nil {
+		return err
+	}
+	for _, uid := range graduates {
+		mine.leaveMember(uid, "graduate", operator, time.Now())
+	}
+	err = nosql.UpdateClassStatus(mine.UID, operator, uint8(ClassStatusArchived))
+	if err == nil {
+		mine.Status = ClassStatusArchived
+	}
+	return err
+}
+
+// rolloverDue 学校已配置模板，到了开学月份并且本学年还没有升级
+func (mine *SchoolInfo) rolloverDue(now time.Time) bool {
+	month := mine.Rollover.Month
+	if month < 1 {
+		month = DefaultEnrolMonth
+	}
+	if mine.Rollover.Classes < 1 || now.Month() < time.Month(month) {
+		return false
+	}
+	return mine.Rollover.Year < uint16(now.Year())
+}
+
+// RolloverSchools 定时任务，已配置模板且本学年未升级的学校自动执行，操作者为系统
+func (mine *cacheContext) RolloverSchools() []*RolloverReport {
+	list := make([]*RolloverReport, 0, len(mine.schools))
+	now := time.Now()
+	for _, school := range mine.schools {
+		if !school.rolloverDue(now) {
+			continue
+		}
+		report, err := school.ExecuteRollover(uint16(now.Year()), OperatorSystem)
+		if err != nil {
+			logger.Warnf("rollover school %s failed: %s", school.UID, err.Error())
+			continue
+		}
+		list = append(list, report)
+	}
+	return list
+}
@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"omo.msa.school/proxy"
+)
+
+func TestGradeInYear(t *testing.T) {
+	enrol := proxy.DateInfo{Year: 2020, Month: time.September, Day: 1}
+	if gradeInYear(enrol, 2020) != 1 || gradeInYear(enrol, 2019) != 1 {
+		t.Fatal("the class must be in the first grade in the enrol year")
+	}
+	if gradeInYear(enrol, 2025) != 6 {
+		t.Fatalf("the grade in 2025 is error: %d", gradeInYear(enrol, 2025))
+	}
+}
+
+func TestGraduatesIn(t *testing.T) {
+	class := new(ClassInfo)
+	class.EnrolDate = proxy.DateInfo{Year: 2020, Month: time.September, Day: 1}
+	if class.graduatesIn(2025, 6) {
+		t.Fatal("the class in the max grade must not graduate")
+	}
+	if !class.graduatesIn(2026, 6) {
+		t.Fatal("the class past the max grade must graduate")
+	}
+	class.Type = ClassTypeVirtual
+	if class.graduatesIn(2026, 6) {
+		t.Fatal("the virtual class never graduates")
+	}
+}
+
+func TestRolloverDue(t *testing.T) {
+	school := new(SchoolInfo)
+	now := time.Date(2026, 9, 2, 3, 0, 0, 0, time.Local)
+	if school.rolloverDue(now) {
+		t.Fatal("the school without template must not rollover")
+	}
+	school.Rollover = proxy.RolloverInfo{Classes: 4, Year: 2025}
+	if !school.rolloverDue(now) {
+		t.Fatal("the school must rollover in the enrol month")
+	}
+	if school.rolloverDue(time.Date(2026, 8, 31, 0, 0, 0, 0, time.Local)) {
+		t.Fatal("the school must not rollover before the enrol month")
+	}
+	school.Rollover.Year = 2026
+	if school.rolloverDue(now) {
+		t.Fatal("the school had rollover in the year")
+	}
+}
@@ -0,0 +1,275 @@
+package cache
+
+import (
+	"errors"
+	"github.com/micro/go-micro/v2/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.school/proxy"
+	"omo.msa.school/proxy/nosql"
+	"omo.msa.school/tool"
+	"sort"
+	"time"
+)
+
+// MembershipInfo 学生在班级的一段在籍时间，Leave为空表示仍在班级
+type MembershipInfo struct {
+	baseInfo
+	School  string    `json:"school"`
+	Class   string    `json:"class"`
+	Student string    `json:"student"`
+	Join    time.Time `json:"join"`
+	Leave   time.Time `json:"leave"`
+	Remark  string    `json:"remark"`
+	// Inferred 补录的记录，Join和Leave只是推测的时间
+	Inferred bool `json:"inferred"`
+}
+
+// SnapshotInfo 学期结束时冻结的花名册
+type SnapshotInfo struct {
+	baseInfo
+	School  string              `json:"school"`
+	Term    string              `json:"term"`
+	Date    time.Time           `json:"date"`
+	Classes []proxy.RosterClass `json:"classes"`
+}
+
+func (mine *MembershipInfo) initInfo(db *nosql.Membership) {
+	mine.UID = db.UID.Hex()
+	mine.ID = db.ID
+	mine.UpdateTime = db.UpdatedTime
+	mine.CreateTime = db.CreatedTime
+	mine.Creator = db.Creator
+	mine.Operator = db.Operator
+	mine.School = db.School
+	mine.Class = db.Class
+	mine.Student = db.Student
+	mine.Join = db.Join
+	mine.Leave = db.Leave
+	mine.Remark = db.Remark
+	mine.Inferred = db.Inferred
+}
+
+func (mine *SnapshotInfo) initInfo(db *nosql.Snapshot) {
+	mine.UID = db.UID.Hex()
+	mine.ID = db.ID
+	mine.UpdateTime = db.UpdatedTime
+	mine.CreateTime = db.CreatedTime
+	mine.Creator = db.Creator
+	mine.Operator = db.Operator
+	mine.School = db.School
+	mine.Term = db.Term
+	mine.Date = db.Date
+	mine.Classes = db.Classes
+}
+
+// IsActive 判断某个时间点是否在班级，离开的时间点不再在班级
+func (mine *MembershipInfo) IsActive(date time.Time) bool {
+	if mine.Join.After(date) {
+		return false
+	}
+	return mine.Leave.IsZero() || date.Before(mine.Leave)
+}
+
+func (mine *ClassInfo) createMembership(student, remark, operator string, join, leave time.Time, inferred bool) error {
+	db := new(nosql.Membership)
+	db.UID = primitive.NewObjectID()
+	db.ID = nosql.GetMembershipNextID()
+	db.CreatedTime = time.Now()
+	db.Creator = operator
+	db.School = mine.School
+	db.Class = mine.UID
+	db.Student = student
+	db.Join = join
+	db.Leave = leave
+	db.Remark = remark
+	db.Inferred = inferred
+	return nosql.CreateMembership(db)
+}
+
+func (mine *ClassInfo) joinMember(student, operator string) {
+	_ = mine.createMembership(student, "", operator, time.Now(), time.Time{}, false)
+}
+
+// leaveMember 结束学生在班级的在籍时间，没有记录的旧数据补录一条推测的记录
+func (mine *ClassInfo) leaveMember(student, remark, operator string, date time.Time) {
+	dbs, err := nosql.GetOpenMemberships(mine.UID, student)
+	if err != nil {
+		return
+	}
+	if len(dbs) < 1 {
+		_ = mine.createMembership(student, remark, operator, mine.CreateTime, date, true)
+		return
+	}
+	for _, db := range dbs {
+		_ = nosql.UpdateMembershipLeave(db.UID.Hex(), remark, operator, date)
+	}
+}
+
+// missingMembers 没有任何在籍记录的班级成员
+func (mine *ClassInfo) missingMembers(list []*MembershipInfo) []proxy.ClassMember {
+	arr := make([]proxy.ClassMember, 0, 5)
+	for _, member := range mine.Members {
+		had := false
+		for _, item := range list {
+			if item.Student == member.Student {
+				had = true
+				break
+			}
+		}
+		if !had {
+			arr = append(arr, member)
+		}
+	}
+	return arr
+}
+
+// inferMembership 推测旧成员的在籍时间，在读的从成员更新时间开始，已离开的从班级创建时开始
+func (mine *ClassInfo) inferMembership(member proxy.ClassMember) (time.Time, time.Time) {
+	join := member.Updated
+	leave := time.Time{}
+	if member.Status != uint8(StudentActive) {
+		join = mine.CreateTime
+		leave = member.Updated
+	}
+	if join.IsZero() || join.Before(mine.CreateTime) {
+		join = mine.CreateTime
+	}
+	return join, leave
+}
+
+// MigrateMemberships 为没有在籍记录的旧班级成员补录一次，补录的记录标记为推测，返回补录的数量
+func (mine *cacheContext) MigrateMemberships(operator string) (uint32, error) {
+	var count uint32 = 0
+	for _, school := range mine.schools {
+		for _, class := range school.GetActClasses() {
+			dbs, err := nosql.GetMembershipsByClass(class.UID)
+			if err != nil {
+				return count, err
+			}
+			for _, member := range class.missingMembers(getMemberships(dbs, nil)) {
+				join, leave := class.inferMembership(member)
+				er := class.createMembership(member.Student, member.Remark, operator, join, leave, true)
+				if er != nil {
+					logger.Warnf("migrate membership of class %s failed: %s", class.UID, er.Error())
+					continue
+				}
+				count += 1
+			}
+		}
+	}
+	return count, nil
+}
+
+// GetMemberships 班级所有的在籍记录
+func (mine *ClassInfo) GetMemberships() []*MembershipInfo {
+	list := getMemberships(nosql.GetMembershipsByClass(mine.UID))
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Join.Before(list[j].Join)
+	})
+	return list
+}
+
+// GetRosterAt 某个时间点在班级的学生
+func (mine *ClassInfo) GetRosterAt(date time.Time) []string {
+	list := make([]string, 0, len(mine.Members))
+	for _, item := range mine.GetMemberships() {
+		if item.IsActive(date) && !tool.HasItem(list, item.Student) {
+			list = append(list, item.Student)
+		}
+	}
+	return list
+}
+
+// GetRosterAt 某个时间点学校各班级的学生，包含已归档的班级
+func (mine *SchoolInfo) GetRosterAt(date time.Time) []proxy.RosterClass {
+	list := make([]proxy.RosterClass, 0, len(mine.classes))
+	for _, item := range getMemberships(nosql.GetMembershipsBySchool(mine.UID)) {
+		if !item.IsActive(date) {
+			continue
+		}
+		index := -1
+		for i := 0; i < len(list); i += 1 {
+			if list[i].Class == item.Class {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			list = append(list, proxy.RosterClass{Class: item.Class, Students: make([]string, 0, 50)})
+			index = len(list) - 1
+		}
+		if !tool.HasItem(list[index].Students, item.Student) {
+			list[index].Students = append(list[index].Students, item.Student)
+		}
+	}
+	return list
+}
+
+// FreezeRoster 冻结学期结束时的花名册，同一学期只能冻结一次
+func (mine *SchoolInfo) FreezeRoster(term, operator string, date time.Time) (*SnapshotInfo, error) {
+	if term == "" {
+		return nil, errors.New("the term is empty")
+	}
+	if mine.GetRosterSnapshot(term) != nil {
+		return nil, errors.New("the roster of the term had frozen")
+	}
+	if date.IsZero() {
+		date = time.Now()
+	}
+	db := new(nosql.Snapshot)
+	db.UID = primitive.NewObjectID()
+	db.ID = nosql.GetSnapshotNextID()
+	db.CreatedTime = time.Now()
+	db.Creator = operator
+	db.School = mine.UID
+	db.Term = term
+	db.Date = date
+	db.Classes = mine.GetRosterAt(date)
+	err := nosql.CreateSnapshot(db)
+	if err != nil {
+		return nil, err
+	}
+	info := new(SnapshotInfo)
+	info.initInfo(db)
+	return info, nil
+}
+
+func (mine *SchoolInfo) GetRosterSnapshot(term string) *SnapshotInfo {
+	db, err := nosql.GetSnapshotBy(mine.UID, term)
+	if err != nil {
+		return nil
+	}
+	info := new(SnapshotInfo)
+	info.initInfo(db)
+	return info
+}
+
+func (mine *SchoolInfo) GetRosterSnapshots() []*SnapshotInfo {
+	list := make([]*SnapshotInfo, 0, 10)
+	dbs, err := nosql.GetSnapshotsBySchool(mine.UID)
+	if err != nil {
+		return list
+	}
+	for _, db := range dbs {
+		info := new(SnapshotInfo)
+		info.initInfo(db)
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Date.Before(list[j].Date)
+	})
+	return list
+}
+
+func getMemberships(dbs []*nosql.Membership, err error) []*MembershipInfo {
+	list := make([]*MembershipInfo, 0, len(dbs))
+	if err != nil {
+		return list
+	}
+	for _, db := range dbs {
+		info := new(MembershipInfo)
+		info.initInfo(db)
+		list = append(list, info)
+	}
+	return list
+}
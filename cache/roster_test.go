@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"omo.msa.school/proxy"
+)
+
+func newRosterClass() *ClassInfo {
+	class := new(ClassInfo)
+	class.UID = "class"
+	class.CreateTime = time.Date(2020, 9, 1, 0, 0, 0, 0, time.Local)
+	class.Members = []proxy.ClassMember{
+		{Student: "a", Status: uint8(StudentActive), Updated: time.Date(2021, 3, 1, 0, 0, 0, 0, time.Local)},
+		{Student: "b", Status: uint8(StudentLeave), Updated: time.Date(2021, 6, 1, 0, 0, 0, 0, time.Local)},
+		{Student: "c", Status: uint8(StudentActive)},
+	}
+	return class
+}
+
+func TestMembershipIsActive(t *testing.T) {
+	join := time.Date(2021, 3, 1, 0, 0, 0, 0, time.Local)
+	leave := time.Date(2021, 6, 1, 0, 0, 0, 0, time.Local)
+	info := &MembershipInfo{Join: join, Leave: leave}
+	if info.IsActive(join.Add(-time.Hour)) {
+		t.Fatal("the student was not in the class before join")
+	}
+	if !info.IsActive(join) || !info.IsActive(leave.Add(-time.Hour)) {
+		t.Fatal("the student was in the class")
+	}
+	if info.IsActive(leave) {
+		t.Fatal("the student left the class at the leave time")
+	}
+	info.Leave = time.Time{}
+	if !info.IsActive(time.Now()) {
+		t.Fatal("the open membership must be active")
+	}
+}
+
+func TestMissingMembers(t *testing.T) {
+	class := newRosterClass()
+	list := []*MembershipInfo{{Student: "a"}}
+	arr := class.missingMembers(list)
+	if len(arr) != 2 || arr[0].Student != "b" || arr[1].Student != "c" {
+		t.Fatalf("the missing members is error: %+v", arr)
+	}
+}
+
+func TestInferMembership(t *testing.T) {
+	class := newRosterClass()
+	join, leave := class.inferMembership(class.Members[0])
+	if !join.Equal(class.Members[0].Updated) || !leave.IsZero() {
+		t.Fatalf("the active member inferred error: %v %v", join, leave)
+	}
+	join, leave = class.inferMembership(class.Members[1])
+	if !join.Equal(class.CreateTime) || !leave.Equal(class.Members[1].Updated) {
+		t.Fatalf("the left member inferred error: %v %v", join, leave)
+	}
+	join, _ = class.inferMembership(class.Members[2])
+	if !join.Equal(class.CreateTime) {
+		t.Fatalf("the member without time must join at class create: %v", join)
+	}
+}
@@ -3,6 +3,7 @@ package cache
 import (
 	"errors"
 	"fmt"
+	"github.com/micro/go-micro/v2/logger"
 	pb "github.com/xtech-cloud/omo-msp-school/proto/school"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"omo.msa.school/proxy"
@@ -25,7 +26,17 @@ type SchoolInfo struct {
 	Honors        []proxy.HonorInfo // 学生荣誉
 	Respects      []proxy.HonorInfo // 教师荣誉
 	Subjects      []proxy.SubjectInfo
+	Tags          []proxy.TagInfo // 标签词汇
+	Behaviors     []proxy.BehaviorInfo // 行为类别
+	ConductTerm   string               // 当前计分学期
+	Capacities    []proxy.CapacityInfo // 年级默认的班级容量
+	Rollover      proxy.RolloverInfo   // 学年升级模板
+	Naming        proxy.NamingInfo     // 班级命名模板
+	Officers      []proxy.OfficerInfo  // 班干部类别
+	Workload      proxy.WorkloadInfo   // 老师每周课时上下限
 	teacherList   []string
+	studentIndex  *searchIndex
+	teacherIndex  *searchIndex
 	classes       []*ClassInfo
 	isInitClasses bool
 }
@@ -44,6 +55,26 @@ func (mine *SchoolInfo) initInfo(db *nosql.School) {
 	mine.Honors = db.Honors
 	mine.Respects = db.Respects
 	mine.Subjects = db.Subjects
+	mine.Tags = db.Tags
+	if mine.Tags == nil {
+		mine.Tags = make([]proxy.TagInfo, 0, 1)
+	}
+	mine.Behaviors = db.Behaviors
+	if mine.Behaviors == nil {
+		mine.Behaviors = make([]proxy.BehaviorInfo, 0, 1)
+	}
+	mine.ConductTerm = db.ConductTerm
+	mine.Capacities = db.Capacities
+	mine.Rollover = db.Rollover
+	mine.Naming = db.Naming
+	mine.Officers = db.Officers
+	mine.Workload = db.Workload
+	if mine.Officers == nil {
+		mine.Officers = make([]proxy.OfficerInfo, 0, 1)
+	}
+	if mine.Capacities == nil {
+		mine.Capacities = make([]proxy.CapacityInfo, 0, 1)
+	}
 	mine.Entity = db.Entity
 	mine.Status = db.Status
 	mine.maxGrade = db.Grade
@@ -52,6 +83,8 @@ func (mine *SchoolInfo) initInfo(db *nosql.School) {
 	}
 	mine.teacherList = db.Teachers
 	mine.isInitClasses = false
+	mine.studentIndex = newSearchIndex()
+	mine.teacherIndex = newSearchIndex()
 	if mine.teacherList == nil {
 		mine.teacherList = make([]string, 0, 1)
 		_ = nosql.UpdateSchoolTeachers(mine.UID, mine.Operator, mine.teacherList)
@@ -68,7 +101,10 @@ func (mine *SchoolInfo) initClasses() {
 		for _, item := range classes {
 			tmp := new(ClassInfo)
 			tmp.initInfo(mine.MaxGrade(), item)
-			if tmp.Grade() <= mine.MaxGrade() {
+			if tmp.Status == ClassStatusArchived {
+				continue
+			}
+			if tmp.IsVirtual() || tmp.Grade() <= mine.MaxGrade() {
 				mine.classes = append(mine.classes, tmp)
 			}
 		}
@@ -78,6 +114,24 @@ func (mine *SchoolInfo) initClasses() {
 	mine.isInitClasses = true
 }
 
+// loadClasses 学校所有的班级，包含缓存中没有的已归档和超出最高年级的班级
+func (mine *SchoolInfo) loadClasses() ([]*ClassInfo, error) {
+	dbs, err := nosql.GetClassesBySchool(mine.UID)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*ClassInfo, 0, len(dbs))
+	for _, db := range dbs {
+		class := mine.GetClass(db.UID.Hex())
+		if class == nil {
+			class = new(ClassInfo)
+			class.initInfo(mine.MaxGrade(), db)
+		}
+		list = append(list, class)
+	}
+	return list, nil
+}
+
 func (mine *SchoolInfo) MaxGrade() uint8 {
 	return mine.maxGrade
 }
@@ -315,13 +369,21 @@ func (mine *SchoolInfo) CreateStudent(data *pb.ReqStudentAdd) (*StudentInfo, *Cl
 	if err != nil {
 		return nil, nil, err
 	}
-	_ = student.UpdateClassNumber(uint16(data.Number), data.Operator)
 	class := mine.GetClass(data.Class)
 	if class != nil {
-		_ = class.AddStudent(student)
-		_ = student.UpdateEnrol(class.EnrolDate, data.Operator)
-		_ = student.UpdateClassNumber(class.Number, data.Operator)
+		// 进入候补队列的学生补位时才设置班号和入学日期
+		joined, er := class.AdmitStudent(student, RemarkClassFull, data.Operator)
+		if er != nil {
+			return student, nil, er
+		}
+		if joined {
+			_ = student.UpdateEnrol(class.EnrolDate, data.Operator)
+			_ = student.UpdateClassNumber(class.Number, data.Operator)
+		} else {
+			class = nil
+		}
 	} else {
+		_ = student.UpdateClassNumber(uint16(data.Number), data.Operator)
 		class, _ = cacheCtx.GetClassByEnrol(mine.UID, enrol, uint16(data.Number))
 		if class != nil {
 			_ = student.UpdateEnrol(class.EnrolDate, data.Operator)
@@ -330,6 +392,8 @@ func (mine *SchoolInfo) CreateStudent(data *pb.ReqStudentAdd) (*StudentInfo, *Cl
 	if len(data.Entity) > 0 {
 		_ = student.BindEntity(data.Entity, data.Operator)
 	}
+	_, _ = cacheCtx.CheckFamily(student, data.Operator)
+	mine.indexStudent(student)
 	return student, class, nil
 }
 
@@ -410,6 +474,9 @@ func (mine *SchoolInfo) GetClassAndStudent(uid string) (*ClassInfo, *StudentInfo
 	}
 	mine.initClasses()
 	for _, class := range mine.classes {
+		if class.IsVirtual() {
+			continue
+		}
 		students := class.GetStudentsByStatus(StudentActive)
 		for _, studentUid := range students {
 			if studentUid == uid {
@@ -572,6 +639,8 @@ func (mine *SchoolInfo) CreateSimpleStudent(name, entity, sn, card, operator str
 
 	student := new(StudentInfo)
 	student.initInfo(db)
+	student.recordEvent(EventEnrol, "", "", enrol.String(), "", operator)
+	mine.indexStudent(student)
 	return student, nil
 }
 
@@ -605,7 +674,10 @@ func (mine *SchoolInfo) appendStudent(student *StudentInfo, operator string, gra
 	}
 	class := mine.checkClass("", operator, date, num, kind)
 	if class != nil {
-		_ = class.AddStudent(student)
+		_, er := class.AdmitStudent(student, RemarkClassFull, operator)
+		if er != nil {
+			logger.Warnf("append student %s to class %s failed: %s", student.UID, class.UID, er.Error())
+		}
 	}
 }
 
@@ -630,8 +702,9 @@ func (mine *SchoolInfo) RemoveStudent(uid, operator string) error {
 		return errors.New("not found the student")
 	}
 	if info.Remove(operator) {
+		mine.studentIndex.delete(uid)
 		if class != nil {
-			_ = class.RemoveStudent(uid, "the admin delete student", info.ID, StudentDelete)
+			_ = class.RemoveStudent(uid, "the admin delete student", operator, info.ID, StudentDelete)
 		}
 	}
 	return nil
@@ -681,6 +754,9 @@ func (mine *SchoolInfo) AllActEntities() []*StudentInfo {
 	mine.initClasses()
 	list := make([]*StudentInfo, 0, 200)
 	for _, class := range mine.classes {
+		if class.IsVirtual() {
+			continue
+		}
 		for _, item := range class.Members {
 			if item.Status == uint8(StudentActive) {
 				student := cacheCtx.GetStudent(item.Student)
@@ -0,0 +1,490 @@
+package cache
+
+import (
+	"github.com/mozillazg/go-pinyin"
+	"omo.msa.school/proxy/nosql"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	WeightName     uint32 = 10
+	WeightSN       uint32 = 9
+	WeightPinyin   uint32 = 8
+	WeightInitials uint32 = 7
+	WeightPhone    uint32 = 6
+)
+
+const PhoneSuffixLength = 4
+
+const DefaultSearchMax = 50
+
+type SearchResult struct {
+	UID   string
+	Score uint32
+}
+
+// searchIndex 倒排索引，词条到文档及字段权重的映射，由缓存的增删改增量维护；
+// runes为词条的字符索引，查询时只比较候选的词条
+type searchIndex struct {
+	lock     sync.RWMutex
+	building sync.Mutex
+	built    bool
+	terms    map[string]map[string]uint32
+	docs     map[string][]string
+	runes    map[rune]map[string]bool
+}
+
+func newSearchIndex() *searchIndex {
+	index := new(searchIndex)
+	index.terms = make(map[string]map[string]uint32, 100)
+	index.docs = make(map[string][]string, 100)
+	index.runes = make(map[rune]map[string]bool, 100)
+	return index
+}
+
+func (mine *searchIndex) isBuilt() bool {
+	mine.lock.RLock()
+	defer mine.lock.RUnlock()
+	return mine.built
+}
+
+// build 全量构建索引，并发的查询会等待同一次构建，加载失败时下次查询重新构建
+func (mine *searchIndex) build(load func() (map[string]map[string]uint32, error)) {
+	mine.building.Lock()
+	defer mine.building.Unlock()
+	if mine.isBuilt() {
+		return
+	}
+	docs, err := load()
+	if err != nil {
+		return
+	}
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	for uid, terms := range docs {
+		mine.insert(uid, terms)
+	}
+	mine.built = true
+}
+
+func (mine *searchIndex) put(uid string, terms map[string]uint32) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	if !mine.built {
+		return
+	}
+	mine.insert(uid, terms)
+}
+
+func (mine *searchIndex) insert(uid string, terms map[string]uint32) {
+	mine.remove(uid)
+	list := make([]string, 0, len(terms))
+	for term, weight := range terms {
+		docs, ok := mine.terms[term]
+		if !ok {
+			docs = make(map[string]uint32, 2)
+			mine.terms[term] = docs
+			mine.addTerm(term)
+		}
+		if docs[uid] < weight {
+			docs[uid] = weight
+		}
+		list = append(list, term)
+	}
+	mine.docs[uid] = list
+}
+
+func (mine *searchIndex) delete(uid string) {
+	mine.lock.Lock()
+	defer mine.lock.Unlock()
+	mine.remove(uid)
+}
+
+func (mine *searchIndex) remove(uid string) {
+	list, ok := mine.docs[uid]
+	if !ok {
+		return
+	}
+	for _, term := range list {
+		docs := mine.terms[term]
+		delete(docs, uid)
+		if len(docs) < 1 {
+			delete(mine.terms, term)
+			mine.removeTerm(term)
+		}
+	}
+	delete(mine.docs, uid)
+}
+
+func (mine *searchIndex) addTerm(term string) {
+	for _, r := range term {
+		set, ok := mine.runes[r]
+		if !ok {
+			set = make(map[string]bool, 10)
+			mine.runes[r] = set
+		}
+		set[term] = true
+	}
+}
+
+func (mine *searchIndex) removeTerm(term string) {
+	for _, r := range term {
+		set := mine.runes[r]
+		delete(set, term)
+		if len(set) < 1 {
+			delete(mine.runes, r)
+		}
+	}
+}
+
+// candidates 可能匹配关键字的词条：包含关键字所有字符的词条（完全匹配、前缀、包含），
+// 以及长度相差不超过编辑距离、缺少的字符也不超过编辑距离的词条
+func (mine *searchIndex) candidates(key string) map[string]bool {
+	list := make(map[string]bool, 20)
+	counts := make(map[string]int, 20)
+	keys := make(map[rune]bool, len(key))
+	for _, r := range key {
+		if keys[r] {
+			continue
+		}
+		keys[r] = true
+		for term := range mine.runes[r] {
+			counts[term] += 1
+		}
+	}
+	length := len([]rune(key))
+	dis := 1
+	if length > 5 {
+		dis = 2
+	}
+	for term, count := range counts {
+		if count == len(keys) {
+			list[term] = true
+			continue
+		}
+		if length < 2 || count < len(keys)-dis {
+			continue
+		}
+		diff := len([]rune(term)) - length
+		if diff >= -dis && diff <= dis {
+			list[term] = true
+		}
+	}
+	return list
+}
+
+// search 按匹配程度排序：完全匹配 > 前缀 > 包含 > 编辑距离相近
+func (mine *searchIndex) search(key string, max int) []SearchResult {
+	keys := searchKeys(key)
+	list := make([]SearchResult, 0, 10)
+	if len(keys) < 1 {
+		return list
+	}
+	mine.lock.RLock()
+	scores := make(map[string]uint32, 10)
+	bests := make(map[string]uint32, 20)
+	for _, k := range keys {
+		for term := range mine.candidates(k) {
+			if score := matchScore(term, k); score > bests[term] {
+				bests[term] = score
+			}
+		}
+	}
+	for term, best := range bests {
+		if best < 1 {
+			continue
+		}
+		for uid, weight := range mine.terms[term] {
+			if s := best * weight; s > scores[uid] {
+				scores[uid] = s
+			}
+		}
+	}
+	mine.lock.RUnlock()
+	for uid, score := range scores {
+		list = append(list, SearchResult{UID: uid, Score: score})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Score == list[j].Score {
+			return list[i].UID < list[j].UID
+		}
+		return list[i].Score > list[j].Score
+	})
+	if max > 0 && len(list) > max {
+		list = list[:max]
+	}
+	return list
+}
+
+func searchKeys(key string) []string {
+	key = strings.ToLower(strings.TrimSpace(key))
+	list := make([]string, 0, 3)
+	if key == "" {
+		return list
+	}
+	list = append(list, key)
+	if hadHan(key) {
+		full, initials := toPinyin(key)
+		if full != "" {
+			list = append(list, full, initials)
+		}
+	}
+	return list
+}
+
+func matchScore(term, key string) uint32 {
+	if term == key {
+		return 100
+	}
+	if strings.HasPrefix(term, key) {
+		return 80
+	}
+	if strings.Contains(term, key) {
+		return 60
+	}
+	length := len([]rune(key))
+	if length < 2 {
+		return 0
+	}
+	dis := editDistance(term, key)
+	if dis == 1 {
+		return 40
+	}
+	if dis == 2 && length > 5 {
+		return 20
+	}
+	return 0
+}
+
+func editDistance(a, b string) int {
+	ra := []rune(a)
+	rb := []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i += 1 {
+		cur[0] = i
+		for j := 1; j <= len(rb); j += 1 {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func hadHan(msg string) bool {
+	for _, r := range msg {
+		if unicode.Is(unicode.Han, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// toPinyin 返回全拼和拼音首字母
+func toPinyin(name string) (string, string) {
+	arr := pinyin.LazyPinyin(name, pinyin.NewArgs())
+	full := strings.Builder{}
+	initials := strings.Builder{}
+	for _, item := range arr {
+		if item == "" {
+			continue
+		}
+		full.WriteString(item)
+		initials.WriteString(item[:1])
+	}
+	return full.String(), initials.String()
+}
+
+func appendNameTerms(terms map[string]uint32, name string) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return
+	}
+	terms[name] = WeightName
+	if hadHan(name) {
+		full, initials := toPinyin(name)
+		if full != "" && terms[full] < WeightPinyin {
+			terms[full] = WeightPinyin
+		}
+		if initials != "" && terms[initials] < WeightInitials {
+			terms[initials] = WeightInitials
+		}
+	}
+}
+
+func appendTerm(terms map[string]uint32, term string, weight uint32) {
+	term = strings.ToLower(strings.TrimSpace(term))
+	if term == "" {
+		return
+	}
+	if terms[term] < weight {
+		terms[term] = weight
+	}
+}
+
+func (mine *StudentInfo) searchTerms() map[string]uint32 {
+	terms := make(map[string]uint32, 8)
+	appendNameTerms(terms, mine.Name)
+	appendTerm(terms, mine.SN, WeightSN)
+	// 学籍号和完整的手机号不放入内存索引，通过数据库的盲索引精确查询
+	for _, custodian := range mine.Custodians {
+		for _, phone := range custodian.Phones {
+			if len(phone) > PhoneSuffixLength {
+				appendTerm(terms, phone[len(phone)-PhoneSuffixLength:], WeightPhone)
+			}
+		}
+	}
+	return terms
+}
+
+func (mine *TeacherInfo) searchTerms() map[string]uint32 {
+	terms := make(map[string]uint32, 3)
+	appendNameTerms(terms, mine.Name)
+	return terms
+}
+
+func (mine *StudentInfo) updateIndex() {
+	school, _ := cacheCtx.GetSchoolBy(mine.School)
+	if school != nil {
+		school.indexStudent(mine)
+	}
+}
+
+func (mine *TeacherInfo) updateIndex() {
+	school := cacheCtx.GetSchoolByTeacher(mine.UID)
+	if school != nil {
+		school.indexTeacher(mine)
+	}
+}
+
+func (mine *SchoolInfo) indexStudent(info *StudentInfo) {
+	if info.Status == StudentDelete {
+		mine.studentIndex.delete(info.UID)
+	} else {
+		mine.studentIndex.put(info.UID, info.searchTerms())
+	}
+}
+
+func (mine *SchoolInfo) indexTeacher(info *TeacherInfo) {
+	mine.teacherIndex.put(info.UID, info.searchTerms())
+}
+
+func (mine *SchoolInfo) initStudentIndex() {
+	mine.studentIndex.build(func() (map[string]map[string]uint32, error) {
+		dbs, err := nosql.GetStudentsBySchool(mine.UID)
+		if err != nil {
+			return nil, err
+		}
+		docs := make(map[string]map[string]uint32, len(dbs))
+		for _, db := range dbs {
+			info := new(StudentInfo)
+			info.initInfo(db)
+			docs[info.UID] = info.searchTerms()
+		}
+		return docs, nil
+	})
+}
+
+func (mine *SchoolInfo) initTeacherIndex() {
+	mine.teacherIndex.build(func() (map[string]map[string]uint32, error) {
+		teachers := mine.AllTeachers()
+		docs := make(map[string]map[string]uint32, len(teachers))
+		for _, info := range teachers {
+			docs[info.UID] = info.searchTerms()
+		}
+		return docs, nil
+	})
+}
+
+// SearchStudentsFuzzy 根据姓名、拼音、拼音首字母、学号或者监护人手机尾号模糊查询学生，
+// 完整的学籍号和监护人手机号精确匹配的学生排在最前面
+func (mine *SchoolInfo) SearchStudentsFuzzy(key string, max int) []*StudentInfo {
+	mine.initStudentIndex()
+	if max < 1 {
+		max = DefaultSearchMax
+	}
+	list := mine.searchStudentsExact(key, max)
+	results := mine.studentIndex.search(key, max)
+	for _, item := range results {
+		if len(list) >= max {
+			break
+		}
+		if hadStudentIn(list, item.UID) {
+			continue
+		}
+		info := cacheCtx.GetStudent(item.UID)
+		if info != nil {
+			list = append(list, info)
+		}
+	}
+	return list
+}
+
+// searchStudentsExact 通过盲索引精确查询学籍号或者监护人手机号
+func (mine *SchoolInfo) searchStudentsExact(key string, max int) []*StudentInfo {
+	key = strings.TrimSpace(key)
+	list := make([]*StudentInfo, 0, 2)
+	if len(key) <= PhoneSuffixLength || hadHan(key) {
+		return list
+	}
+	dbs, _ := nosql.GetStudentsBySID(key)
+	arr, _ := nosql.GetStudentsByCustodian(mine.UID, key)
+	dbs = append(dbs, arr...)
+	for _, db := range dbs {
+		if len(list) >= max {
+			break
+		}
+		if db.School != mine.UID || hadStudentIn(list, db.UID.Hex()) {
+			continue
+		}
+		info := new(StudentInfo)
+		info.initInfo(db)
+		if info.Status != StudentDelete {
+			list = append(list, info)
+		}
+	}
+	return list
+}
+
+func hadStudentIn(list []*StudentInfo, uid string) bool {
+	for _, item := range list {
+		if item.UID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchTeachersFuzzy 根据姓名、拼音或者拼音首字母模糊查询老师
+func (mine *SchoolInfo) SearchTeachersFuzzy(key string, max int) []*TeacherInfo {
+	mine.initTeacherIndex()
+	if max < 1 {
+		max = DefaultSearchMax
+	}
+	results := mine.teacherIndex.search(key, max)
+	list := make([]*TeacherInfo, 0, len(results))
+	for _, item := range results {
+		info := cacheCtx.GetTeacher(item.UID)
+		if info != nil {
+			list = append(list, info)
+		}
+	}
+	return list
+}
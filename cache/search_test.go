@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"testing"
+
+	"omo.msa.school/proxy"
+)
+
+func TestSearchCandidates(t *testing.T) {
+	index := newSearchIndex()
+	index.insert("a", map[string]uint32{"zhangsan": WeightPinyin, "1234": WeightPhone})
+	index.insert("b", map[string]uint32{"zhangsna": WeightPinyin, "5678": WeightPhone})
+	index.insert("c", map[string]uint32{"wulimeng": WeightPinyin})
+	list := index.candidates("zhangsan")
+	if !list["zhangsan"] || !list["zhangsna"] {
+		t.Fatalf("the similar terms must be candidates: %v", list)
+	}
+	if list["wulimeng"] || list["1234"] {
+		t.Fatalf("the terms without shared runes must not be candidates: %v", list)
+	}
+	results := index.search("zhangsan", 10)
+	if len(results) != 2 || results[0].UID != "a" {
+		t.Fatalf("the search results is error: %+v", results)
+	}
+}
+
+func TestStudentSearchTerms(t *testing.T) {
+	info := new(StudentInfo)
+	info.Name = "abc"
+	info.SID = "G110101201001011234"
+	info.Custodians = []proxy.CustodianInfo{{Phones: []string{"13800001234"}}}
+	terms := info.searchTerms()
+	if _, ok := terms["g110101201001011234"]; ok {
+		t.Fatal("the sid must not be indexed")
+	}
+	if _, ok := terms["13800001234"]; ok {
+		t.Fatal("the full phone must not be indexed")
+	}
+	if terms["1234"] != WeightPhone {
+		t.Fatalf("the phone suffix must be indexed: %v", terms)
+	}
+}
@@ -0,0 +1,332 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"math/rand"
+	"omo.msa.school/proxy"
+	"omo.msa.school/proxy/nosql"
+	"omo.msa.school/tool"
+	"sort"
+	"time"
+)
+
+const (
+	SeatByHeight = "height" // 按身高标签从前往后
+	SeatRandom   = "random" // 随机
+	SeatBySex    = "sex"    // 男女交替
+)
+
+// HeightCategory 身高标签的分类，标签在词汇中的顺序即从矮到高的顺序
+const HeightCategory = "height"
+
+// SeatingInfo 班级某学期的座位表，当前学期只包含在读学生的座位
+type SeatingInfo struct {
+	Rows    uint8 `json:"rows"`
+	Columns uint8 `json:"columns"`
+	baseInfo
+	School   string           `json:"school"`
+	Class    string           `json:"class"`
+	Term     string           `json:"term"`
+	Disabled []string         `json:"disabled"`
+	Seats    []proxy.SeatInfo `json:"seats"`
+}
+
+func (mine *SeatingInfo) initInfo(db *nosql.Seating, students []string) {
+	mine.UID = db.UID.Hex()
+	mine.ID = db.ID
+	mine.UpdateTime = db.UpdatedTime
+	mine.CreateTime = db.CreatedTime
+	mine.Creator = db.Creator
+	mine.Operator = db.Operator
+	mine.School = db.School
+	mine.Class = db.Class
+	mine.Term = db.Term
+	mine.Rows = db.Rows
+	mine.Columns = db.Columns
+	mine.Disabled = db.Disabled
+	mine.Seats = make([]proxy.SeatInfo, 0, len(db.Seats))
+	for _, seat := range db.Seats {
+		if students == nil || tool.HasItem(students, seat.Student) {
+			mine.Seats = append(mine.Seats, seat)
+		}
+	}
+}
+
+func (mine *SeatingInfo) isUsable(row, column uint8) bool {
+	if row < 1 || column < 1 || row > mine.Rows || column > mine.Columns {
+		return false
+	}
+	return !tool.HasItem(mine.Disabled, seatKey(row, column))
+}
+
+// positions 可用的座位，从前排到后排
+func (mine *SeatingInfo) positions() []proxy.SeatInfo {
+	list := make([]proxy.SeatInfo, 0, int(mine.Rows)*int(mine.Columns))
+	for r := uint8(1); r <= mine.Rows; r += 1 {
+		for c := uint8(1); c <= mine.Columns; c += 1 {
+			if mine.isUsable(r, c) {
+				list = append(list, proxy.SeatInfo{Row: r, Column: c})
+			}
+		}
+	}
+	return list
+}
+
+func seatKey(row, column uint8) string {
+	return fmt.Sprintf("%d-%d", row, column)
+}
+
+// currentTerm 班级当前的学期，即最新创建的座位表的学期
+func (mine *ClassInfo) currentTerm() string {
+	dbs, err := nosql.GetSeatingsByClass(mine.UID)
+	if err != nil {
+		return ""
+	}
+	term := ""
+	var date time.Time
+	for _, db := range dbs {
+		if term == "" || db.CreatedTime.After(date) {
+			term = db.Term
+			date = db.CreatedTime
+		}
+	}
+	return term
+}
+
+// GetSeating 某学期的座位表，没有时返回nil；当前学期只包含在读学生的座位，历史学期保留原有的座位
+func (mine *ClassInfo) GetSeating(term string) *SeatingInfo {
+	db, err := nosql.GetSeatingBy(mine.UID, term)
+	if err != nil {
+		return nil
+	}
+	var students []string
+	if term == mine.currentTerm() {
+		students = mine.GetActiveStudents()
+	}
+	info := new(SeatingInfo)
+	info.initInfo(db, students)
+	return info
+}
+
+// GetSeatings 各学期的座位表，历史学期保留原有的座位
+func (mine *ClassInfo) GetSeatings() []*SeatingInfo {
+	list := make([]*SeatingInfo, 0, 5)
+	dbs, err := nosql.GetSeatingsByClass(mine.UID)
+	if err != nil {
+		return list
+	}
+	for _, db := range dbs {
+		info := new(SeatingInfo)
+		info.initInfo(db, nil)
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreateTime.Before(list[j].CreateTime)
+	})
+	return list
+}
+
+// UpdateSeatLayout 设置座位的行列和不可用的座位，超出范围的已有座位会被清除
+func (mine *ClassInfo) UpdateSeatLayout(term, operator string, rows, columns uint8, disabled []string) (*SeatingInfo, error) {
+	if !mine.IsManager(operator) {
+		return nil, errors.New("the operator is not the master of class")
+	}
+	if term == "" {
+		return nil, errors.New("the term is empty")
+	}
+	if rows < 1 || columns < 1 {
+		return nil, errors.New("the seat layout is error")
+	}
+	if disabled == nil {
+		disabled = make([]string, 0, 1)
+	}
+	info := mine.GetSeating(term)
+	if info == nil {
+		db := new(nosql.Seating)
+		db.UID = primitive.NewObjectID()
+		db.ID = nosql.GetSeatingNextID()
+		db.CreatedTime = time.Now()
+		db.Creator = operator
+		db.School = mine.School
+		db.Class = mine.UID
+		db.Term = term
+		db.Rows = rows
+		db.Columns = columns
+		db.Disabled = disabled
+		db.Seats = make([]proxy.SeatInfo, 0, 1)
+		err := nosql.CreateSeating(db)
+		if err != nil {
+			return nil, err
+		}
+		info = new(SeatingInfo)
+		info.initInfo(db, nil)
+		return info, nil
+	}
+	info.Rows = rows
+	info.Columns = columns
+	info.Disabled = disabled
+	seats := make([]proxy.SeatInfo, 0, len(info.Seats))
+	for _, seat := range info.Seats {
+		if info.isUsable(seat.Row, seat.Column) {
+			seats = append(seats, seat)
+		}
+	}
+	err := nosql.UpdateSeatingLayout(info.UID, operator, rows, columns, disabled, seats)
+	if err != nil {
+		return nil, err
+	}
+	info.Seats = seats
+	info.Operator = operator
+	return info, nil
+}
+
+// AssignSeats 手动安排座位，学生为空表示清空该座位，学生原来的座位会被清空
+// 历史学期可以安排曾经在班级的学生
+func (mine *ClassInfo) AssignSeats(term, operator string, list []proxy.SeatInfo) (*SeatingInfo, error) {
+	if !mine.IsManager(operator) {
+		return nil, errors.New("the operator is not the master of class")
+	}
+	info := mine.GetSeating(term)
+	if info == nil {
+		return nil, errors.New("not found the seat layout of the term")
+	}
+	current := term == mine.currentTerm()
+	students := mine.GetActiveStudents()
+	seats := info.Seats
+	for _, item := range list {
+		if !info.isUsable(item.Row, item.Column) {
+			return nil, errors.New("the seat is not usable")
+		}
+		if item.Student != "" && current && !tool.HasItem(students, item.Student) {
+			return nil, errors.New("the student not in the class")
+		}
+		if item.Student != "" && !current && !mine.HadStudentByStatus(item.Student, StudentAll) {
+			return nil, errors.New("the student not in the class")
+		}
+		arr := make([]proxy.SeatInfo, 0, len(seats)+1)
+		for _, seat := range seats {
+			if (seat.Row == item.Row && seat.Column == item.Column) || (item.Student != "" && seat.Student == item.Student) {
+				continue
+			}
+			arr = append(arr, seat)
+		}
+		if item.Student != "" {
+			arr = append(arr, item)
+		}
+		seats = arr
+	}
+	return mine.saveSeats(info, operator, seats)
+}
+
+// ArrangeSeats 按策略自动安排所有在读学生的座位，只能安排当前学期
+func (mine *ClassInfo) ArrangeSeats(term, operator, strategy string) (*SeatingInfo, error) {
+	if !mine.IsManager(operator) {
+		return nil, errors.New("the operator is not the master of class")
+	}
+	if term != mine.currentTerm() {
+		return nil, errors.New("only the seats of current term can be arranged")
+	}
+	info := mine.GetSeating(term)
+	if info == nil {
+		return nil, errors.New("not found the seat layout of the term")
+	}
+	positions := info.positions()
+	students := make([]*StudentInfo, 0, len(mine.Members))
+	for _, uid := range mine.GetActiveStudents() {
+		student := cacheCtx.GetStudent(uid)
+		if student != nil {
+			students = append(students, student)
+		}
+	}
+	if len(students) > len(positions) {
+		return nil, errors.New("the seats is not enough")
+	}
+	switch strategy {
+	case SeatByHeight:
+		school, _ := cacheCtx.GetSchoolBy(mine.School)
+		sortByHeight(school, students)
+	case SeatRandom:
+		rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+		rnd.Shuffle(len(students), func(i, j int) {
+			students[i], students[j] = students[j], students[i]
+		})
+	case SeatBySex:
+		students = alternateSex(students)
+	default:
+		return nil, errors.New("the seat strategy is error")
+	}
+	seats := make([]proxy.SeatInfo, 0, len(students))
+	for i, student := range students {
+		seat := positions[i]
+		seat.Student = student.UID
+		seats = append(seats, seat)
+	}
+	return mine.saveSeats(info, operator, seats)
+}
+
+func (mine *ClassInfo) saveSeats(info *SeatingInfo, operator string, seats []proxy.SeatInfo) (*SeatingInfo, error) {
+	err := nosql.UpdateSeatingSeats(info.UID, operator, seats)
+	if err != nil {
+		return nil, err
+	}
+	info.Seats = seats
+	info.Operator = operator
+	info.UpdateTime = time.Now()
+	return info, nil
+}
+
+// heightRank 身高标签在学校词汇中的顺序，没有身高标签的排在最后
+func heightRank(school *SchoolInfo, student *StudentInfo) int {
+	if school == nil {
+		return 0
+	}
+	index := 0
+	for _, tag := range school.Tags {
+		if tag.Category != HeightCategory {
+			continue
+		}
+		if tool.HasItem(student.Tags, tag.Name) {
+			return index
+		}
+		index += 1
+	}
+	return index + 1
+}
+
+// sortByHeight 按身高标签从矮到高排列，身高相同的保持原来的顺序
+func sortByHeight(school *SchoolInfo, students []*StudentInfo) {
+	ranks := make(map[string]int, len(students))
+	for _, student := range students {
+		ranks[student.UID] = heightRank(school, student)
+	}
+	sort.SliceStable(students, func(i, j int) bool {
+		return ranks[students[i].UID] < ranks[students[j].UID]
+	})
+}
+
+// alternateSex 男女交替排列，人数多的一方剩余的排在最后
+func alternateSex(students []*StudentInfo) []*StudentInfo {
+	groups := make(map[uint8][]*StudentInfo, 2)
+	keys := make([]uint8, 0, 2)
+	for _, student := range students {
+		if _, ok := groups[student.Sex]; !ok {
+			keys = append(keys, student.Sex)
+		}
+		groups[student.Sex] = append(groups[student.Sex], student)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i] < keys[j]
+	})
+	list := make([]*StudentInfo, 0, len(students))
+	for len(list) < len(students) {
+		for _, key := range keys {
+			if len(groups[key]) > 0 {
+				list = append(list, groups[key][0])
+				groups[key] = groups[key][1:]
+			}
+		}
+	}
+	return list
+}
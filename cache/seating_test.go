@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"testing"
+
+	"omo.msa.school/proxy"
+)
+
+func newHeightStudent(uid string, tags ...string) *StudentInfo {
+	info := new(StudentInfo)
+	info.UID = uid
+	info.Tags = tags
+	return info
+}
+
+func TestSortByHeight(t *testing.T) {
+	school := new(SchoolInfo)
+	school.Tags = []proxy.TagInfo{
+		{UID: "t1", Name: "矮", Category: HeightCategory},
+		{UID: "t2", Name: "中", Category: HeightCategory},
+		{UID: "t3", Name: "班长", Category: "duty"},
+		{UID: "t4", Name: "高", Category: HeightCategory},
+	}
+	students := []*StudentInfo{
+		newHeightStudent("a", "高"),
+		newHeightStudent("b"),
+		newHeightStudent("c", "班长", "矮"),
+		newHeightStudent("d", "中"),
+	}
+	sortByHeight(school, students)
+	want := []string{"c", "d", "a", "b"}
+	for i, uid := range want {
+		if students[i].UID != uid {
+			t.Fatalf("the students by height is error at %d: %s", i, students[i].UID)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"github.com/micro/go-micro/v2/logger"
+	"omo.msa.school/config"
+	"omo.msa.school/proxy/nosql"
+)
+
+// EncryptSecrets 使用当前密钥重新加密学生、家庭以及请假的敏感字段并重建盲索引，
+// 包括未加密的旧数据以及轮换前旧密钥加密的数据，无法解密的数据保留原有的密文并跳过
+func (mine *cacheContext) EncryptSecrets() (uint32, error) {
+	if !nosql.SecretEnabled() && config.Schema.Secret.Index == "" {
+		return 0, nil
+	}
+	var count uint32 = 0
+	students, err := nosql.GetStudentsBySecret()
+	if err != nil {
+		return 0, err
+	}
+	for _, db := range students {
+		er := nosql.UpdateStudentSecret(db)
+		if er != nil {
+			logger.Warnf("encrypt student %s failed: %s", db.UID.Hex(), er.Error())
+			continue
+		}
+		count += 1
+	}
+	families, err := nosql.GetFamiliesBySecret()
+	if err != nil {
+		return count, err
+	}
+	for _, db := range families {
+		er := nosql.UpdateFamilySecret(db)
+		if er != nil {
+			logger.Warnf("encrypt family %s failed: %s", db.UID.Hex(), er.Error())
+			continue
+		}
+		count += 1
+	}
+	leaves, err := nosql.GetLeavesBySecret()
+	if err != nil {
+		return count, err
+	}
+	for _, db := range leaves {
+		er := nosql.UpdateLeaveSecret(db)
+		if er != nil {
+			logger.Warnf("encrypt leave %s failed: %s", db.UID.Hex(), er.Error())
+			continue
+		}
+		count += 1
+	}
+	logger.Infof("encrypt secrets!!! number = %d", count)
+	return count, nil
+}
@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.school/proxy"
+	"omo.msa.school/proxy/nosql"
+)
+
+func setSecret(t *testing.T, current uint32, keys map[uint32]string) {
+	t.Helper()
+	if err := nosql.SetSecret(current, "index", nil, keys); err != nil {
+		t.Fatalf("set secret failed: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = nosql.SetSecret(0, "", nil, nil)
+	})
+}
+
+func newSecretStudent() *nosql.Student {
+	db := new(nosql.Student)
+	db.UID = primitive.NewObjectID()
+	db.IDCard = "110101201001011234"
+	db.SID = "G110101201001011234"
+	db.Custodians = []proxy.CustodianInfo{{Name: "mother", Identity: "110101198001011234", Phones: []string{"13800000000"}}}
+	return db
+}
+
+func roundTrip(t *testing.T, in, out interface{}) []byte {
+	t.Helper()
+	data, err := bson.Marshal(in)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	if err = bson.Unmarshal(data, out); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	return data
+}
+
+func TestSecretPassthrough(t *testing.T) {
+	setSecret(t, 0, nil)
+	db := newSecretStudent()
+	out := new(nosql.Student)
+	roundTrip(t, db, out)
+	if out.IDCard != db.IDCard || out.SID != db.SID || out.Custodians[0].Phones[0] != "13800000000" {
+		t.Fatalf("plain fields changed: %+v", out)
+	}
+	if out.Locked {
+		t.Fatal("plain student must not be locked")
+	}
+}
+
+func TestSecretRotation(t *testing.T) {
+	setSecret(t, 1, map[uint32]string{1: "first"})
+	db := newSecretStudent()
+	data, err := bson.Marshal(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(db.IDCard)) || bytes.Contains(data, []byte("13800000000")) {
+		t.Fatal("the stored document contains plain text")
+	}
+	setSecret(t, 2, map[uint32]string{1: "first", 2: "second"})
+	out := new(nosql.Student)
+	if err = bson.Unmarshal(data, out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Locked || out.IDCard != db.IDCard || out.Custodians[0].Identity != db.Custodians[0].Identity {
+		t.Fatalf("old version decrypt failed: %+v", out)
+	}
+	again := new(nosql.Student)
+	roundTrip(t, out, again)
+	if again.Secret != 2 || again.IDCard != db.IDCard {
+		t.Fatalf("rewrite with the current key failed: %+v", again)
+	}
+}
+
+func TestSecretUnknownVersionKeepsCipher(t *testing.T) {
+	setSecret(t, 1, map[uint32]string{1: "first"})
+	data, err := bson.Marshal(newSecretStudent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	setSecret(t, 2, map[uint32]string{2: "second"})
+	out := new(nosql.Student)
+	if err = bson.Unmarshal(data, out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Locked {
+		t.Fatal("the student must be locked")
+	}
+	if !strings.HasPrefix(out.IDCard, "enc:1:") || !strings.HasPrefix(out.Custodians[0].Phones[0], "enc:1:") {
+		t.Fatalf("the cipher text was dropped: %+v", out)
+	}
+	if err = nosql.UpdateStudentSecret(out); err != nosql.ErrSecretLocked {
+		t.Fatalf("rewrite locked student: %v", err)
+	}
+	again := new(nosql.Student)
+	roundTrip(t, out, again)
+	if !strings.HasPrefix(again.IDCard, "enc:1:") {
+		t.Fatalf("the cipher text was encrypted twice: %s", again.IDCard)
+	}
+
+	info := new(StudentInfo)
+	info.initInfo(out)
+	if err = info.UpdateSelf("name", "sn", "card", "operator", 1); err != nosql.ErrSecretLocked {
+		t.Fatalf("update locked student: %v", err)
+	}
+}
+
+func TestSecretFamilyAndLeave(t *testing.T) {
+	setSecret(t, 1, map[uint32]string{1: "first"})
+	family := &nosql.Family{UID: primitive.NewObjectID(), Phones: []string{"13800000000"}, Cards: []string{"110101198001011234"}}
+	outFamily := new(nosql.Family)
+	data := roundTrip(t, family, outFamily)
+	if bytes.Contains(data, []byte("13800000000")) || outFamily.Phones[0] != "13800000000" || len(outFamily.PhoneIndex) != 1 {
+		t.Fatalf("family secret failed: %+v", outFamily)
+	}
+	leave := &nosql.Leave{UID: primitive.NewObjectID(), Creator: "13800000000", Operator: "13800000000", Applicant: "13800000000", Reason: "sick",
+		Histories: []proxy.StatusHistory{{Operator: "13800000000", Remark: "sick"}}}
+	outLeave := new(nosql.Leave)
+	data = roundTrip(t, leave, outLeave)
+	if bytes.Contains(data, []byte("13800000000")) || bytes.Contains(data, []byte("sick")) {
+		t.Fatal("the stored leave contains plain text")
+	}
+	if outLeave.Applicant != leave.Applicant || outLeave.Operator != leave.Operator || outLeave.Histories[0].Remark != "sick" || outLeave.Locked {
+		t.Fatalf("leave secret failed: %+v", outLeave)
+	}
+}
+
+func TestSecretWithoutIndex(t *testing.T) {
+	if err := nosql.SetSecret(1, "", nil, map[uint32]string{1: "first"}); err == nil {
+		t.Fatal("the field encryption must not start without the index secret")
+	}
+}
@@ -3,9 +3,11 @@ package cache
 import (
 	"errors"
 	"fmt"
+	pb "github.com/xtech-cloud/omo-msp-school/proto/school"
 	"omo.msa.school/proxy"
 	"omo.msa.school/proxy/nosql"
 	"omo.msa.school/tool"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -35,6 +37,8 @@ type StudentInfo struct {
 	EnrolDate  proxy.DateInfo
 	Tags       []string
 	Custodians []proxy.CustodianInfo
+	// 有无法解密的字段，不能再写入敏感字段
+	locked bool
 }
 
 func (mine *StudentInfo) initInfo(db *nosql.Student) {
@@ -56,7 +60,8 @@ func (mine *StudentInfo) initInfo(db *nosql.Student) {
 	mine.School = db.School
 	mine.Status = StudentStatus(db.Status)
 	mine.Custodians = db.Custodians
-	if mine.Custodians == nil {
+	mine.locked = db.Locked
+	if mine.Custodians == nil && !mine.locked {
 		mine.Custodians = make([]proxy.CustodianInfo, 0, 1)
 		_ = nosql.UpdateStudentCustodians(mine.UID, mine.Operator, mine.Custodians)
 	}
@@ -73,9 +78,17 @@ func (mine *StudentInfo) Birthday() string {
 }
 
 func (mine *StudentInfo) UpdateCustodian(name, phones, identify string) error {
+	return mine.updateCustodian(name, phones, identify, true)
+}
+
+// updateCustodian infer为false时不重新推断家庭，用于同步兄弟姐妹的监护人，避免已确认的家庭被改回待确认
+func (mine *StudentInfo) updateCustodian(name, phones, identify string, infer bool) error {
 	if len(phones) < 1 {
 		return errors.New("the custodian phone is empty")
 	}
+	if mine.locked {
+		return nosql.ErrSecretLocked
+	}
 	if len(name) < 2 {
 		name = "default"
 	}
@@ -87,6 +100,10 @@ func (mine *StudentInfo) UpdateCustodian(name, phones, identify string) error {
 	err := nosql.AppendStudentCustodian(mine.UID, info)
 	if err == nil {
 		mine.Custodians = append(mine.Custodians, info)
+		if infer {
+			_, _ = cacheCtx.CheckFamily(mine, mine.Operator)
+		}
+		mine.updateIndex()
 	}
 	return err
 }
@@ -120,6 +137,9 @@ func (mine *StudentInfo) Grade() uint8 {
 }
 
 func (mine *StudentInfo) UpdateBase(name, sn, card, operator string, sex uint8, arr []proxy.CustodianInfo) error {
+	if mine.locked {
+		return nosql.ErrSecretLocked
+	}
 	var err error
 	var sid = mine.SID
 	if card == "" {
@@ -153,11 +173,15 @@ func (mine *StudentInfo) UpdateBase(name, sn, card, operator string, sex uint8,
 		mine.SID = sid
 		mine.Sex = sex
 		mine.Operator = operator
+		mine.updateIndex()
 	}
 	return err
 }
 
 func (mine *StudentInfo) UpdateSelf(name, sn, card, operator string, sex uint8) error {
+	if mine.locked {
+		return nosql.ErrSecretLocked
+	}
 	var err error
 	err = nosql.UpdateStudentInfo(mine.UID, name, sn, card, operator, sex)
 	if err == nil {
@@ -166,6 +190,7 @@ func (mine *StudentInfo) UpdateSelf(name, sn, card, operator string, sex uint8)
 		mine.Sex = sex
 		mine.SN = sn
 		mine.Operator = operator
+		mine.updateIndex()
 	}
 	return err
 }
@@ -183,6 +208,13 @@ func (mine *StudentInfo) UpdateEnrol(enrol proxy.DateInfo, operator string) erro
 }
 
 func (mine *StudentInfo) UpdateTags(tags []string, operator string) error {
+	school, _ := cacheCtx.GetSchoolBy(mine.School)
+	if school != nil {
+		er := school.CheckTags(tags)
+		if er != nil {
+			return er
+		}
+	}
 	err := nosql.UpdateStudentTags(mine.UID, operator, tags)
 	if err == nil {
 		mine.Tags = tags
@@ -201,11 +233,15 @@ func (mine *StudentInfo) UpdateStatus(st StudentStatus, operator string) error {
 		enrol.Parse(mine.EnrolDate.String())
 		class, _ := cacheCtx.GetClassByEnrol(mine.School, enrol, mine.ClassNo)
 		if class != nil {
-			_ = class.AddStudent(mine)
+			_, er := class.AdmitStudent(mine, RemarkClassFull, operator)
+			if er != nil {
+				return er
+			}
 		}
 	}
 	err := nosql.UpdateStudentState(mine.UID, operator, uint8(st))
 	if err == nil {
+		mine.recordStatus(mine.Status, st, operator)
 		mine.Status = st
 		mine.Operator = operator
 		mine.UpdateTime = time.Now()
@@ -219,6 +255,7 @@ func (mine *StudentInfo) UpdateClassNumber(num uint16, operator string) error {
 	}
 	err := nosql.UpdateStudentNumber(mine.UID, operator, num)
 	if err == nil {
+		mine.recordEvent(EventClassNumber, mine.currentClass(), strconv.Itoa(int(mine.ClassNo)), strconv.Itoa(int(num)), "", operator)
 		mine.ClassNo = num
 		mine.Operator = operator
 		mine.UpdateTime = time.Now()
@@ -236,9 +273,14 @@ func (mine *StudentInfo) BindEntity(entity, operator string) error {
 	if mine.Entity != "" {
 		return errors.New("the student entity had existed")
 	}
-
-	err := nosql.UpdateStudentEntity(mine.UID, entity, operator)
+	err := mine.checkEntity(entity)
+	if err != nil {
+		return err
+	}
+	err = nosql.UpdateStudentEntity(mine.UID, entity, operator)
 	if err == nil {
+		mine.recordEvent(EventBind, mine.currentClass(), "", entity, "", operator)
+		recordBinding(mine.School, mine.UID, pb.TargetType_TStudent, entity, BindActionBind, "", operator)
 		mine.Entity = entity
 		mine.Operator = operator
 		mine.UpdateTime = time.Now()
@@ -273,6 +315,15 @@ func (mine *StudentInfo) appendTag(tag string) error {
 	if mine.hadTag(tag) {
 		return errors.New("the tag had existed")
 	}
+	school, _ := cacheCtx.GetSchoolBy(mine.School)
+	if school != nil {
+		tags := make([]string, 0, len(mine.Tags)+1)
+		tags = append(tags, mine.Tags...)
+		er := school.CheckTags(append(tags, tag))
+		if er != nil {
+			return er
+		}
+	}
 	err := nosql.AppendStudentTag(mine.UID, tag)
 	if err == nil {
 		mine.Tags = append(mine.Tags, tag)
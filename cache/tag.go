@@ -0,0 +1,277 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"omo.msa.school/proxy"
+	"omo.msa.school/proxy/nosql"
+	"time"
+)
+
+type TagUsage struct {
+	proxy.TagInfo
+	Students uint32 `json:"students"`
+	Teachers uint32 `json:"teachers"`
+}
+
+func (mine *SchoolInfo) GetTag(uid string) *proxy.TagInfo {
+	for i := 0; i < len(mine.Tags); i += 1 {
+		if mine.Tags[i].UID == uid {
+			return &mine.Tags[i]
+		}
+	}
+	return nil
+}
+
+func (mine *SchoolInfo) GetTagByName(name string) *proxy.TagInfo {
+	for i := 0; i < len(mine.Tags); i += 1 {
+		if mine.Tags[i].Name == name {
+			return &mine.Tags[i]
+		}
+	}
+	return nil
+}
+
+func (mine *SchoolInfo) CreateTag(name, category, color, group, operator string) (*proxy.TagInfo, error) {
+	if name == "" {
+		return nil, errors.New("the tag name is empty")
+	}
+	if mine.GetTagByName(name) != nil {
+		return nil, errors.New("the tag name had existed")
+	}
+	uuid := fmt.Sprintf("%s-%d", mine.UID, nosql.GetSchoolTagNextID())
+	info := proxy.TagInfo{
+		UID:      uuid,
+		Name:     name,
+		Category: category,
+		Color:    color,
+		Group:    group,
+	}
+	err := nosql.AppendSchoolTag(mine.UID, info)
+	if err != nil {
+		return nil, err
+	}
+	mine.Tags = append(mine.Tags, info)
+	mine.Operator = operator
+	return &mine.Tags[len(mine.Tags)-1], nil
+}
+
+// UpdateTag 修改标签定义，改名时同步更新所有使用该标签的学生和老师，改名或者换组导致互斥时不能修改
+func (mine *SchoolInfo) UpdateTag(uid, name, category, color, group, operator string) error {
+	info := mine.GetTag(uid)
+	if info == nil {
+		return errors.New("not found the tag")
+	}
+	if name == "" {
+		return errors.New("the tag name is empty")
+	}
+	if name != info.Name {
+		if mine.GetTagByName(name) != nil {
+			return errors.New("the tag name had existed")
+		}
+	}
+	list := make([]proxy.TagInfo, 0, len(mine.Tags))
+	for _, item := range mine.Tags {
+		if item.UID == uid {
+			item.Name = name
+			item.Category = category
+			item.Color = color
+			item.Group = group
+		}
+		list = append(list, item)
+	}
+	if name != info.Name || group != info.Group {
+		err := mine.checkTagged(list, info.Name, name)
+		if err != nil {
+			return err
+		}
+	}
+	err := nosql.UpdateSchoolTags(mine.UID, operator, list)
+	if err != nil {
+		return err
+	}
+	old := info.Name
+	mine.Tags = list
+	mine.Operator = operator
+	mine.UpdateTime = time.Now()
+	if old != name {
+		return mine.replaceTagged(old, name, operator)
+	}
+	return nil
+}
+
+// MergeTag 将标签from合并到标签to，使用from的学生和老师改为使用to，合并后互斥时不能合并
+func (mine *SchoolInfo) MergeTag(from, to, operator string) error {
+	if from == to {
+		return errors.New("the tags are the same")
+	}
+	src := mine.GetTag(from)
+	if src == nil {
+		return errors.New("not found the source tag")
+	}
+	dst := mine.GetTag(to)
+	if dst == nil {
+		return errors.New("not found the target tag")
+	}
+	err := mine.checkTagged(mine.Tags, src.Name, dst.Name)
+	if err != nil {
+		return err
+	}
+	err = mine.replaceTagged(src.Name, dst.Name, operator)
+	if err != nil {
+		return err
+	}
+	return mine.subtractTag(from, operator)
+}
+
+// RemoveTag 删除标签定义，同时从学生和老师身上移除该标签
+func (mine *SchoolInfo) RemoveTag(uid, operator string) error {
+	info := mine.GetTag(uid)
+	if info == nil {
+		return errors.New("not found the tag")
+	}
+	err := mine.replaceTagged(info.Name, "", operator)
+	if err != nil {
+		return err
+	}
+	return mine.subtractTag(uid, operator)
+}
+
+func (mine *SchoolInfo) subtractTag(uid, operator string) error {
+	err := nosql.SubtractSchoolTag(mine.UID, uid)
+	if err == nil {
+		for i := 0; i < len(mine.Tags); i += 1 {
+			if mine.Tags[i].UID == uid {
+				mine.Tags = append(mine.Tags[:i], mine.Tags[i+1:]...)
+				break
+			}
+		}
+		mine.Operator = operator
+	}
+	return err
+}
+
+// CheckTags 检查标签是否在词汇表中以及是否违反互斥组，未定义词汇表的学校不做限制
+func (mine *SchoolInfo) CheckTags(tags []string) error {
+	if len(mine.Tags) < 1 {
+		return nil
+	}
+	for _, tag := range tags {
+		if mine.GetTagByName(tag) == nil {
+			return errors.New("the tag of " + tag + " not defined")
+		}
+	}
+	return exclusiveTags(mine.Tags, tags)
+}
+
+// exclusiveTags 检查标签是否违反词汇表的互斥组，词汇表中没有的标签不检查
+func exclusiveTags(vocab []proxy.TagInfo, tags []string) error {
+	groups := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		group := ""
+		for _, item := range vocab {
+			if item.Name == tag {
+				group = item.Group
+				break
+			}
+		}
+		if group == "" {
+			continue
+		}
+		if other, ok := groups[group]; ok && other != tag {
+			return errors.New("the tags of " + other + " and " + tag + " are exclusive")
+		}
+		groups[group] = tag
+	}
+	return nil
+}
+
+// checkTagged 标签old替换为tag后，使用该标签的学生和老师在新的词汇表中是否违反互斥组
+func (mine *SchoolInfo) checkTagged(vocab []proxy.TagInfo, old, tag string) error {
+	dbs, err := nosql.GetStudentsByTag(mine.UID, old)
+	if err != nil {
+		return err
+	}
+	for _, db := range dbs {
+		er := exclusiveTags(vocab, replaceTag(db.Tags, old, tag))
+		if er != nil {
+			return errors.New("the student " + db.UID.Hex() + " conflict: " + er.Error())
+		}
+	}
+	for _, teacher := range mine.AllTeachers() {
+		if !teacher.hadTag(old) {
+			continue
+		}
+		er := exclusiveTags(vocab, replaceTag(teacher.Tags, old, tag))
+		if er != nil {
+			return errors.New("the teacher " + teacher.UID + " conflict: " + er.Error())
+		}
+	}
+	return nil
+}
+
+func (mine *SchoolInfo) GetTagStatistic() []*TagUsage {
+	list := make([]*TagUsage, 0, len(mine.Tags))
+	teachers := mine.AllTeachers()
+	for _, item := range mine.Tags {
+		info := new(TagUsage)
+		info.TagInfo = item
+		info.Students = nosql.GetStudentCountByTag(mine.UID, item.Name)
+		for _, teacher := range teachers {
+			if teacher.hadTag(item.Name) {
+				info.Teachers += 1
+			}
+		}
+		list = append(list, info)
+	}
+	return list
+}
+
+func (mine *SchoolInfo) replaceTagged(old, tag, operator string) error {
+	dbs, err := nosql.GetStudentsByTag(mine.UID, old)
+	if err != nil {
+		return err
+	}
+	for _, db := range dbs {
+		er := nosql.UpdateStudentTags(db.UID.Hex(), operator, replaceTag(db.Tags, old, tag))
+		if er != nil {
+			err = er
+		}
+	}
+	for _, teacher := range mine.AllTeachers() {
+		if !teacher.hadTag(old) {
+			continue
+		}
+		tags := replaceTag(teacher.Tags, old, tag)
+		er := nosql.UpdateTeacherTags(teacher.UID, operator, tags)
+		if er == nil {
+			teacher.Tags = tags
+		} else {
+			err = er
+		}
+	}
+	return err
+}
+
+func replaceTag(tags []string, old, tag string) []string {
+	list := make([]string, 0, len(tags))
+	for _, item := range tags {
+		if item == old {
+			item = tag
+		}
+		if item == "" {
+			continue
+		}
+		had := false
+		for _, s := range list {
+			if s == item {
+				had = true
+				break
+			}
+		}
+		if !had {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -48,27 +48,30 @@ func (mine *TeacherInfo) createHistory(school, remark string) *proxy.HistoryInfo
 	return info
 }
 
-func (mine *TeacherInfo) Remove(school, remark string) error {
+func (mine *TeacherInfo) Remove(school, remark, operator string) error {
 	info := mine.createHistory(school, remark)
 	err := nosql.AppendTeacherHistory(mine.UID, info)
 	if err == nil {
 		mine.Histories = append(mine.Histories, *info)
+		err = mine.leaveSchool(school, remark, operator, time.Now())
 	}
 	return err
 }
 
-func (mine *TeacherInfo) IsActive(school string) bool {
-	//for _, history := range mine.Histories {
-	//	if history.School == school {
-	//		return false
-	//	}
-	//}
-	//return true
-	return true
-}
-
 func (mine *TeacherInfo) UpdateTags(operator string, tags []string) error {
-	var err error
+	school := cacheCtx.GetSchoolByTeacher(mine.UID)
+	if school != nil {
+		er := school.CheckTags(tags)
+		if er != nil {
+			return er
+		}
+	}
+	err := nosql.UpdateTeacherTags(mine.UID, operator, tags)
+	if err == nil {
+		mine.Tags = tags
+		mine.Operator = operator
+		mine.UpdateTime = time.Now()
+	}
 	return err
 }
 
@@ -80,12 +83,16 @@ func (mine *TeacherInfo) UpdateBase(name, operator string, classes, subs []strin
 		mine.Classes = classes
 		mine.Subjects = subs
 		mine.Operator = operator
+		mine.updateIndex()
 	}
 	return err
 }
 
 func (mine *TeacherInfo) HadHonor(honor string) bool {
-	return mine.hadTag(honor)
+	if honor == "" {
+		return false
+	}
+	return nosql.GetAwardCount(mine.UID, honor) > 0
 }
 
 func (mine *TeacherInfo) hadSubject(sub string) bool {
@@ -131,6 +138,15 @@ func (mine *TeacherInfo) appendTag(tag string) error {
 	if mine.hadTag(tag) {
 		return errors.New("the tag had existed")
 	}
+	school := cacheCtx.GetSchoolByTeacher(mine.UID)
+	if school != nil {
+		tags := make([]string, 0, len(mine.Tags)+1)
+		tags = append(tags, mine.Tags...)
+		er := school.CheckTags(append(tags, tag))
+		if er != nil {
+			return er
+		}
+	}
 	err := nosql.AppendTeacherTag(mine.UID, tag)
 	if err == nil {
 		mine.Tags = append(mine.Tags, tag)
@@ -298,18 +314,24 @@ func (mine *SchoolInfo) CreateTeacher(name, entity, user, operator string, class
 	if err != nil {
 		return nil, err
 	}
-	mine.AppendTeacher(teacher)
+	err = mine.AppendTeacher(teacher, operator)
+	if err != nil {
+		return nil, err
+	}
 	return teacher, nil
 }
 
-func (mine *SchoolInfo) AppendTeacher(info *TeacherInfo) error {
+func (mine *SchoolInfo) AppendTeacher(info *TeacherInfo, operator string) error {
 	if mine.hadTeacher(info.UID) {
 		return nil
 	}
 	err := nosql.AppendSchoolTeacher(mine.UID, info.UID)
-	if err == nil {
-		mine.teacherList = append(mine.teacherList, info.UID)
+	if err != nil {
+		return err
 	}
+	mine.teacherList = append(mine.teacherList, info.UID)
+	mine.indexTeacher(info)
+	_, err = info.createEmployment(mine.UID, "", "", operator, time.Now(), time.Time{}, false)
 	return err
 }
 
@@ -335,13 +357,13 @@ func (mine *SchoolInfo) GetTeachersByPage(page, number uint32) (uint32, uint32,
 	return total, maxPage, list
 }
 
-func (mine *SchoolInfo) RemoveTeacher(entity, remark string) error {
+func (mine *SchoolInfo) RemoveTeacher(entity, remark, operator string) error {
 	mine.AllTeachers()
 	info := mine.GetTeacherByEntity(entity)
 	if info == nil {
 		return errors.New("not found the teacher")
 	}
-	_ = info.Remove(mine.UID, remark)
+	_ = info.Remove(mine.UID, remark, operator)
 	err := nosql.SubtractSchoolTeacher(mine.UID, info.UID)
 	if err == nil {
 		mine.removeTeacherUID(info.UID)
@@ -350,6 +372,7 @@ func (mine *SchoolInfo) RemoveTeacher(entity, remark string) error {
 }
 
 func (mine *SchoolInfo) removeTeacherUID(uid string) {
+	mine.teacherIndex.delete(uid)
 	for i := 0; i < len(mine.teacherList); i += 1 {
 		if mine.teacherList[i] == uid {
 			if i == len(mine.teacherList)-1 {
@@ -362,13 +385,13 @@ func (mine *SchoolInfo) removeTeacherUID(uid string) {
 	}
 }
 
-func (mine *SchoolInfo) RemoveTeacherByUID(uid, remark string) error {
+func (mine *SchoolInfo) RemoveTeacherByUID(uid, remark, operator string) error {
 	mine.AllTeachers()
 	info := mine.GetTeacher(uid)
 	if info == nil {
 		return errors.New("not found the teacher")
 	}
-	_ = info.Remove(mine.UID, remark)
+	_ = info.Remove(mine.UID, remark, operator)
 	err := nosql.SubtractSchoolTeacher(mine.UID, info.UID)
 	if err == nil {
 		mine.removeTeacherUID(uid)
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.school/proxy/nosql"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	EventEnrol       EventType = 1 // 入学
+	EventClassJoin   EventType = 2 // 加入班级
+	EventClassLeave  EventType = 3 // 离开班级
+	EventClassNumber EventType = 4 // 班号变更
+	EventStatus      EventType = 5 // 状态变更
+	EventBind        EventType = 6 // 绑定实体
+	EventUnbind      EventType = 7 // 解绑实体
+	EventTransfer    EventType = 8 // 转班
+)
+
+type EventType uint8
+
+type EventInfo struct {
+	Type EventType `json:"type"`
+	baseInfo
+	School  string `json:"school"`
+	Student string `json:"student"`
+	Class   string `json:"class"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Remark  string `json:"remark"`
+}
+
+func (mine *EventInfo) initInfo(db *nosql.StudentEvent) {
+	mine.UID = db.UID.Hex()
+	mine.ID = db.ID
+	mine.UpdateTime = db.UpdatedTime
+	mine.CreateTime = db.CreatedTime
+	mine.Creator = db.Creator
+	mine.Operator = db.Operator
+	mine.Type = EventType(db.Type)
+	mine.School = db.School
+	mine.Student = db.Student
+	mine.Class = db.Class
+	mine.From = db.From
+	mine.To = db.To
+	mine.Remark = db.Remark
+}
+
+// recordEvent 记录学生履历事件，失败不影响主流程
+func (mine *StudentInfo) recordEvent(kind EventType, class, from, to, remark, operator string) {
+	db := new(nosql.StudentEvent)
+	db.UID = primitive.NewObjectID()
+	db.ID = nosql.GetStudentEventNextID()
+	db.CreatedTime = time.Now()
+	db.Creator = operator
+	db.School = mine.School
+	db.Student = mine.UID
+	db.Type = uint8(kind)
+	db.Class = class
+	db.From = from
+	db.To = to
+	db.Remark = remark
+	_ = nosql.CreateStudentEvent(db)
+}
+
+// currentClass 学生当前所在的行政班，StudentInfo.Class不会被赋值，所以需要从班级成员中查找
+func (mine *StudentInfo) currentClass() string {
+	class := cacheCtx.GetClassByStudent(mine.UID)
+	if class == nil {
+		return ""
+	}
+	return class.UID
+}
+
+func (mine *StudentInfo) recordStatus(from, to StudentStatus, operator string) {
+	mine.recordEvent(EventStatus, mine.currentClass(), strconv.Itoa(int(from)), strconv.Itoa(int(to)), "", operator)
+}
+
+// GetTimeline 按时间顺序返回学生的履历
+func (mine *StudentInfo) GetTimeline() []*EventInfo {
+	list := make([]*EventInfo, 0, 10)
+	dbs, err := nosql.GetStudentEvents(mine.UID)
+	if err != nil {
+		return list
+	}
+	for _, db := range dbs {
+		info := new(EventInfo)
+		info.initInfo(db)
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CreateTime.Equal(list[j].CreateTime) {
+			return list[i].ID < list[j].ID
+		}
+		return list[i].CreateTime.Before(list[j].CreateTime)
+	})
+	return list
+}
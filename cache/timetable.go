@@ -36,7 +36,19 @@ func (mine *TimetableInfo) Delete() error {
 	return nosql.RemoveTimetable(mine.UID, "")
 }
 
+// UpdateItems 更新课表，没有指定老师的课时保留原来相同课时的老师
 func (mine *TimetableInfo) UpdateItems(operator string, list []proxy.TimetableItem) error {
+	for i := 0; i < len(list); i += 1 {
+		if list[i].Teacher != "" {
+			continue
+		}
+		for _, item := range mine.Items {
+			if item.Weekday == list[i].Weekday && item.Number == list[i].Number && item.Name == list[i].Name {
+				list[i].Teacher = item.Teacher
+				break
+			}
+		}
+	}
 	err := nosql.UpdateTimetableItems(mine.UID, operator, list)
 	if err == nil {
 		mine.Items = list
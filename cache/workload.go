@@ -0,0 +1,236 @@
+package cache
+
+import (
+	"errors"
+	"omo.msa.school/proxy"
+	"omo.msa.school/proxy/nosql"
+	"sort"
+	"time"
+)
+
+const (
+	WorkloadOver  = "over"  // 超过每周课时上限
+	WorkloadUnder = "under" // 低于每周课时下限
+)
+
+// TeacherWorkload 老师每周的课时，Subjects按学科名称，Classes按班级UID统计
+type TeacherWorkload struct {
+	Teacher  string            `json:"teacher"`
+	Name     string            `json:"name"`
+	Periods  uint32            `json:"periods"`
+	Subjects map[string]uint32 `json:"subjects"`
+	Classes  map[string]uint32 `json:"classes"`
+	Warning  string            `json:"warning"`
+}
+
+// WorkloadReport 学校某学年课表在From到To之间（例如一个学期）的工作量，任课老师按期间的任课安排计算，
+// Unassigned为找不到任课老师的课时
+type WorkloadReport struct {
+	School     string             `json:"school"`
+	Year       uint32             `json:"year"`
+	From       time.Time          `json:"from"`
+	To         time.Time          `json:"to"`
+	Min        uint32             `json:"min"`
+	Max        uint32             `json:"max"`
+	Unassigned uint32             `json:"unassigned"`
+	Teachers   []*TeacherWorkload `json:"teachers"`
+	Overloads  []string           `json:"overloads"`
+	Underloads []string           `json:"underloads"`
+}
+
+func (mine *SchoolInfo) UpdateWorkloadLimit(operator string, min, max uint32) error {
+	if max > 0 && min > max {
+		return errors.New("the min periods must not more than the max")
+	}
+	info := proxy.WorkloadInfo{Min: min, Max: max}
+	err := nosql.UpdateSchoolWorkload(mine.UID, operator, info)
+	if err == nil {
+		mine.Workload = info
+		mine.Operator = operator
+		mine.UpdateTime = time.Now()
+	}
+	return err
+}
+
+// UpdateTimetableTeacher 设置课表中若干课时的任课老师，老师为空表示改回按任课安排
+func (mine *SchoolInfo) UpdateTimetableTeacher(class string, year uint32, teacher, operator string, slots []proxy.TimetableItem) (*TimetableInfo, error) {
+	if teacher != "" && !mine.hadTeacher(teacher) {
+		return nil, errors.New("not found the teacher in the school")
+	}
+	info, err := mine.GetTimetable(class, year)
+	if err != nil {
+		return nil, errors.New("not found the timetable")
+	}
+	list := make([]proxy.TimetableItem, 0, len(info.Items))
+	list = append(list, info.Items...)
+	for _, slot := range slots {
+		had := false
+		for i := 0; i < len(list); i += 1 {
+			if list[i].Weekday == slot.Weekday && list[i].Number == slot.Number {
+				list[i].Teacher = teacher
+				had = true
+			}
+		}
+		if !had {
+			return nil, errors.New("not found the slot in the timetable")
+		}
+	}
+	err = nosql.UpdateTimetableItems(info.UID, operator, list)
+	if err != nil {
+		return nil, err
+	}
+	info.Items = list
+	info.Operator = operator
+	return info, nil
+}
+
+// yearRange 学年的起止时间，从学年开学的月份开始到下一学年开学
+func (mine *SchoolInfo) yearRange(year uint32) (time.Time, time.Time) {
+	month := mine.Rollover.Month
+	if month < 1 || month > 12 {
+		month = DefaultEnrolMonth
+	}
+	from := time.Date(int(year), time.Month(month), 1, 0, 0, 0, 0, time.Local)
+	return from, from.AddDate(1, 0, 0)
+}
+
+// termTeachers 班级各学科在From到To之间的任课老师，期间换过老师的取任课时间最长的
+func termTeachers(list []*AssignmentInfo, from, to time.Time) map[string]string {
+	dic := make(map[string]string, 10)
+	spans := make(map[string]time.Duration, 10)
+	for _, item := range list {
+		begin := item.Start
+		if begin.Before(from) {
+			begin = from
+		}
+		end := item.End
+		if end.IsZero() || end.After(to) {
+			end = to
+		}
+		span := end.Sub(begin)
+		if span <= 0 {
+			continue
+		}
+		if span > spans[item.Subject] {
+			spans[item.Subject] = span
+			dic[item.Subject] = item.Teacher
+		}
+	}
+	return dic
+}
+
+// slotTeacher 课时的任课老师，没有指定时取班级该学科在统计期间的任课安排
+func (mine *SchoolInfo) slotTeacher(class string, item proxy.TimetableItem, from, to time.Time, dic map[string]map[string]string) string {
+	if item.Teacher != "" {
+		return item.Teacher
+	}
+	subject := ""
+	for _, tmp := range mine.Subjects {
+		if tmp.Name == item.Name {
+			subject = tmp.UID
+			break
+		}
+	}
+	if subject == "" {
+		return ""
+	}
+	teachers, ok := dic[class]
+	if !ok {
+		teachers = termTeachers(mine.GetClassAssignments(class, time.Time{}), from, to)
+		dic[class] = teachers
+	}
+	return teachers[subject]
+}
+
+// workloadWarning 超过上限或者低于下限的提醒，不任课的老师（没有课时也没有学科）不提醒
+func workloadWarning(load *TeacherWorkload, teaching bool, min, max uint32) string {
+	if max > 0 && load.Periods > max {
+		return WorkloadOver
+	}
+	if min > 0 && load.Periods < min && (teaching || load.Periods > 0) {
+		return WorkloadUnder
+	}
+	return ""
+}
+
+// GetWorkloadReport 按某学年的课表统计老师每周的课时，学校的在职老师都会列出；
+// from为空时统计整个学年，to为空时到学年结束
+func (mine *SchoolInfo) GetWorkloadReport(year uint32, from, to time.Time) (*WorkloadReport, error) {
+	begin, end := mine.yearRange(year)
+	if from.IsZero() {
+		from = begin
+	}
+	if to.IsZero() {
+		to = end
+	}
+	from = switchDay(from)
+	to = switchDay(to)
+	if !to.After(from) {
+		return nil, errors.New("the end date must after the start date")
+	}
+	tables, err := mine.GetTimetablesBy(year)
+	if err != nil {
+		return nil, err
+	}
+	report := &WorkloadReport{School: mine.UID, Year: year, From: from, To: to, Min: mine.Workload.Min, Max: mine.Workload.Max,
+		Teachers: make([]*TeacherWorkload, 0, len(mine.teacherList)), Overloads: make([]string, 0, 5), Underloads: make([]string, 0, 5)}
+	loads := make(map[string]*TeacherWorkload, len(mine.teacherList))
+	teaching := make(map[string]bool, len(mine.teacherList))
+	getLoad := func(uid string) *TeacherWorkload {
+		load, ok := loads[uid]
+		if !ok {
+			load = &TeacherWorkload{Teacher: uid, Subjects: make(map[string]uint32, 2), Classes: make(map[string]uint32, 5)}
+			teacher := cacheCtx.GetTeacher(uid)
+			if teacher != nil {
+				load.Name = teacher.Name
+				teaching[uid] = len(teacher.Subjects) > 0
+			}
+			loads[uid] = load
+			report.Teachers = append(report.Teachers, load)
+		}
+		return load
+	}
+	for _, uid := range mine.teacherList {
+		getLoad(uid)
+	}
+	dic := make(map[string]map[string]string, len(tables))
+	for _, table := range tables {
+		for _, item := range table.Items {
+			uid := mine.slotTeacher(table.Class, item, from, to, dic)
+			if uid == "" {
+				report.Unassigned += 1
+				continue
+			}
+			load := getLoad(uid)
+			load.Periods += 1
+			load.Subjects[item.Name] += 1
+			load.Classes[table.Class] += 1
+		}
+	}
+	for _, load := range report.Teachers {
+		load.Warning = workloadWarning(load, teaching[load.Teacher], report.Min, report.Max)
+		if load.Warning == WorkloadOver {
+			report.Overloads = append(report.Overloads, load.Teacher)
+		} else if load.Warning == WorkloadUnder {
+			report.Underloads = append(report.Underloads, load.Teacher)
+		}
+	}
+	sort.SliceStable(report.Teachers, func(i, j int) bool {
+		return report.Teachers[i].Periods > report.Teachers[j].Periods
+	})
+	return report, nil
+}
+
+// GetTeacherWorkload 老师在某学年（或学期）课表中的工作量
+func (mine *SchoolInfo) GetTeacherWorkload(teacher string, year uint32, from, to time.Time) (*TeacherWorkload, error) {
+	report, err := mine.GetWorkloadReport(year, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range report.Teachers {
+		if item.Teacher == teacher {
+			return item, nil
+		}
+	}
+	return nil, errors.New("not found the teacher in the school")
+}
@@ -4,7 +4,9 @@ const defaultJson string = `{
 	"service": {
 		"address": ":7078",
 		"ttl": 15,
-		"interval": 10
+		"interval": 10,
+		"token": "",
+		"privacy": false
 	},
 	"logger": {
 		"level": "info",
@@ -19,6 +21,13 @@ const defaultJson string = `{
 		"password": "pass2019",
 		"type": "mongodb"
 	},
+	"secret": {
+		"current": 0,
+		"index": "",
+		"sign": "",
+		"keys": [],
+		"oldIndexes": []
+	},
 	"basic": {
 		"tags": 6,
 		"synonyms": 5
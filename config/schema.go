@@ -4,6 +4,10 @@ type ServiceConfig struct {
 	TTL      int64  `json:"ttl"`
 	Interval int64  `json:"interval"`
 	Address  string `json:"address"`
+	// 内部服务调用时携带的令牌，为空时不接受内部服务角色
+	Token string `json:"token"`
+	// 为true时没有携带角色的请求按访客脱敏，为false时按内部服务处理以兼容旧的调用方
+	Privacy bool `json:"privacy"`
 }
 
 type LoggerConfig struct {
@@ -26,9 +30,25 @@ type BasicConfig struct {
 	TagMax     int32 `json:"tags"`
 }
 
+// SecretKey 字段加密的密钥，轮换时新增一个版本并修改current
+type SecretKey struct {
+	Version uint32 `json:"version"`
+	Secret  string `json:"secret"`
+}
+
+type SecretConfig struct {
+	Current uint32      `json:"current"`
+	Index   string      `json:"index"`
+	Sign    string      `json:"sign"`
+	Keys    []SecretKey `json:"keys"`
+	// 轮换前的盲索引密钥，重建索引完成之前需要保留
+	OldIndexes []string `json:"oldIndexes"`
+}
+
 type SchemaConfig struct {
 	Service  ServiceConfig `json:"service"`
 	Logger   LoggerConfig  `json:"logger"`
 	Database DBConfig      `json:"database"`
+	Secret   SecretConfig  `json:"secret"`
 	//Basic   BasicConfig 	`json:"basic"`
 }
@@ -1,7 +1,6 @@
 package grpc
 
 import (
-	"encoding/json"
 	"github.com/micro/go-micro/v2/logger"
 	pb "github.com/xtech-cloud/omo-msp-school/proto/school"
 	pbst "github.com/xtech-cloud/omo-msp-status/proto/status"
@@ -9,8 +8,7 @@ import (
 )
 
 func inLog(name, data interface{}) {
-	bytes, _ := json.Marshal(data)
-	msg := ByteString(bytes)
+	msg := redactJson(data)
 	logger.Infof("[in.%s]:data = %s", name, msg)
 }
 
@@ -24,8 +22,7 @@ func outError(name, msg string, code pbst.ResultStatus) *pb.ReplyStatus {
 }
 
 func outLog(name, data interface{}) *pb.ReplyStatus {
-	bytes, _ := json.Marshal(data)
-	msg := ByteString(bytes)
+	msg := redactJson(data)
 	logger.Infof("[out.%s]:data = %s", name, msg)
 	tmp := &pb.ReplyStatus{
 		Code: 0,
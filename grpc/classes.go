@@ -2,6 +2,8 @@ package grpc
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	pb "github.com/xtech-cloud/omo-msp-school/proto/school"
 	pbstatus "github.com/xtech-cloud/omo-msp-status/proto/status"
@@ -9,6 +11,7 @@ import (
 	"omo.msa.school/proxy"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type ClassService struct{}
@@ -19,7 +22,7 @@ func switchClass(info *cache.ClassInfo) *pb.ClassInfo {
 	tmp.Id = info.ID
 	tmp.Created = uint64(info.CreateTime.Unix())
 	tmp.Updated = uint64(info.UpdateTime.Unix())
-	tmp.Name = info.Name
+	tmp.Name = info.DisplayName()
 	tmp.Type = uint32(info.Type)
 	tmp.Operator = info.Operator
 	tmp.Creator = info.Creator
@@ -30,9 +33,6 @@ func switchClass(info *cache.ClassInfo) *pb.ClassInfo {
 	tmp.Owner = info.School
 	tmp.Assistant = info.Assistant
 	tmp.Teachers = info.Teachers
-	if tmp.Name == "" {
-		tmp.Name = info.FullName()
-	}
 	tmp.Students = make([]*pb.MemberInfo, 0, len(info.Members))
 	for _, member := range info.Members {
 		tmp.Students = append(tmp.Students, &pb.MemberInfo{Uid: member.UID, Student: member.Student, Status: uint32(member.Status), Remark: member.Remark})
@@ -76,6 +76,26 @@ func (mine *ClassService) GetOne(ctx context.Context, in *pb.RequestInfo, out *p
 	}
 
 	out.Info = switchClass(info)
+	if in.Filter == "attendance" {
+		// value: 日期，parent: 节次，为空时返回当天所有记录
+		date, er := cache.ParseDay(in.Value)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		list := info.GetAttendances(date)
+		if len(in.Parent) > 0 {
+			period, _ := strconv.ParseUint(in.Parent, 10, 32)
+			arr := make([]*cache.AttendanceInfo, 0, len(list))
+			for _, item := range list {
+				if item.Period == uint8(period) {
+					arr = append(arr, item)
+				}
+			}
+			list = arr
+		}
+		out.Info.Students = switchAttendances(list)
+	}
 	out.Status = outLog(path, out)
 	return nil
 }
@@ -132,7 +152,12 @@ func (mine *ClassService) GetByFilter(ctx context.Context, in *pb.RequestPage, o
 	path := "class.getByFilter"
 	inLog(path, in)
 	if in.Parent == "" {
-
+		out.List = make([]*pb.ClassInfo, 0, 3)
+		if in.Filter == "groups.student" {
+			for _, class := range cache.Context().GetGroupsByStudent(in.Value) {
+				out.List = append(out.List, switchClass(class))
+			}
+		}
 	} else {
 		school, _ := cache.Context().GetSchoolBy(in.Parent)
 		if school == nil {
@@ -163,6 +188,12 @@ func (mine *ClassService) GetByFilter(ctx context.Context, in *pb.RequestPage, o
 			classes = school.GetClassesByEnrol(date.Year, date.Month)
 		} else if in.Filter == "menus" {
 			classes = school.GetAllClasses()
+		} else if in.Filter == "groups" {
+			classes = school.GetGroups()
+		} else if in.Filter == "groups.student" {
+			classes = school.GetGroupsByStudent(in.Value)
+		} else if in.Filter == "groups.teacher" {
+			classes = school.GetGroupsByTeacher(in.Value)
 		}
 		for _, class := range classes {
 			out.List = append(out.List, switchClass(class))
@@ -175,6 +206,290 @@ func (mine *ClassService) GetByFilter(ctx context.Context, in *pb.RequestPage, o
 func (mine *ClassService) GetStatistic(ctx context.Context, in *pb.RequestPage, out *pb.ReplyStatistic) error {
 	path := "class.getStatistic"
 	inLog(path, in)
+	if strings.HasPrefix(in.Filter, "attendance.") {
+		// list: [开始日期, 结束日期]
+		if len(in.List) < 2 {
+			out.Status = outError(path, "the date range is empty", pbstatus.ResultStatus_Empty)
+			return nil
+		}
+		from, er := cache.ParseDay(in.List[0])
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		to, er := cache.ParseDay(in.List[1])
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		var summary *cache.AttendanceSummary
+		if in.Filter == "attendance.class" {
+			class := cache.Context().GetClass(in.Uid)
+			if class == nil {
+				out.Status = outError(path, "not found the class", pbstatus.ResultStatus_NotExisted)
+				return nil
+			}
+			summary = class.GetAttendanceSummary(from, to)
+		} else if in.Filter == "attendance.grade" {
+			school, _ := cache.Context().GetSchoolBy(in.Parent)
+			if school == nil {
+				out.Status = outError(path, "not found the school by uid", pbstatus.ResultStatus_NotExisted)
+				return nil
+			}
+			grade, _ := strconv.ParseUint(in.Value, 10, 32)
+			summary = school.GetGradeAttendanceSummary(uint8(grade), from, to)
+		} else if in.Filter == "attendance.student" {
+			summary = cache.Context().GetStudentAttendanceSummary(in.Uid, from, to)
+		}
+		if summary != nil {
+			bytes, _ := json.Marshal(summary)
+			out.Key = string(bytes)
+			out.Owner = in.Uid
+			out.Count = summary.Total
+		}
+	} else if strings.HasPrefix(in.Filter, "exam.") {
+		// value: 考试UID，exam.class时uid为班级，exam.grade时统计整个年级；监护人只能看到自己孩子的名次
+		school, _ := cache.Context().GetSchoolBy(in.Parent)
+		if school == nil {
+			out.Status = outError(path, "not found the school by uid", pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		exam := school.GetExam(in.Value)
+		if exam == nil {
+			out.Status = outError(path, "not found the exam by uid", pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		class := ""
+		if in.Filter == "exam.class" {
+			class = in.Uid
+		}
+		info := exam.GetStatistic(class)
+		if !isStaff(ctx) {
+			arr := make([]*cache.ScoreRank, 0, 1)
+			for _, item := range info.Ranks {
+				if canViewStudent(ctx, cache.Context().GetStudent(item.Student)) {
+					arr = append(arr, item)
+				}
+			}
+			info.Ranks = arr
+		}
+		bytes, _ := json.Marshal(info)
+		out.Key = string(bytes)
+		out.Owner = exam.UID
+		out.Count = info.Count
+	} else if in.Filter == "conduct.class" {
+		// uid: 班级，value: 学期，为空时使用当前学期；监护人只能看到自己孩子的名次
+		class := cache.Context().GetClass(in.Uid)
+		if class == nil {
+			out.Status = outError(path, "not found the class", pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		school, _ := cache.Context().GetSchoolBy(class.School)
+		if school == nil {
+			out.Status = outError(path, "not found the school by uid", pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		list := school.GetClassConductRanks(class, in.Value)
+		if !isStaff(ctx) {
+			arr := make([]*cache.ConductRank, 0, 1)
+			for _, item := range list {
+				if canViewStudent(ctx, cache.Context().GetStudent(item.Target)) {
+					arr = append(arr, item)
+				}
+			}
+			list = arr
+		}
+		bytes, _ := json.Marshal(list)
+		out.Key = string(bytes)
+		out.Owner = class.UID
+		out.Count = uint32(len(list))
+	} else if in.Filter == "conduct.grade" {
+		// value: 年级，为0时包含所有在读班级，params: 学期
+		school, _ := cache.Context().GetSchoolBy(in.Parent)
+		if school == nil {
+			out.Status = outError(path, "not found the school by uid", pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		grade, _ := strconv.ParseUint(in.Value, 10, 32)
+		list := school.GetGradeConductRanks(uint8(grade), in.Params)
+		bytes, _ := json.Marshal(list)
+		out.Key = string(bytes)
+		out.Owner = school.UID
+		out.Count = uint32(len(list))
+	} else if in.Filter == "split.preview" || in.Filter == "merge.preview" {
+		school, _ := cache.Context().GetSchoolBy(in.Parent)
+		if school == nil {
+			out.Status = outError(path, "not found the school by uid", pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		plan, er := planClasses(school, in)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		bytes, _ := json.Marshal(plan)
+		out.Key = string(bytes)
+		out.Owner = in.Uid
+		out.Count = uint32(len(plan.Items))
+	} else if in.Filter == "assign.class" || in.Filter == "assign.teacher" {
+		// assign.class时uid为班级，返回学科到老师的对应；assign.teacher时uid为老师；value: 日期，为空时为当天
+		school, _ := cache.Context().GetSchoolBy(in.Parent)
+		if school == nil {
+			out.Status = outError(path, "not found the school by uid", pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		date, er := parseOptionalDay(in.Value)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		if date.IsZero() {
+			date = time.Now()
+		}
+		var bytes []byte
+		if in.Filter == "assign.class" {
+			dic := school.GetClassSubjectTeachers(in.Uid, date)
+			bytes, _ = json.Marshal(dic)
+			out.Count = uint32(len(dic))
+		} else {
+			list := school.GetTeacherAssignments(in.Uid, date)
+			bytes, _ = json.Marshal(list)
+			out.Count = uint32(len(list))
+		}
+		out.Key = string(bytes)
+		out.Owner = in.Uid
+	} else if in.Filter == "officers" || in.Filter == "duties" {
+		// uid: 班级，value: 学期，duties时list: [开始日期, 结束日期]，可以为空
+		class := cache.Context().GetClass(in.Uid)
+		if class == nil {
+			out.Status = outError(path, "not found the class", pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		var bytes []byte
+		if in.Filter == "officers" {
+			list := class.GetOfficers(in.Value)
+			bytes, _ = json.Marshal(list)
+			out.Count = uint32(len(list))
+		} else {
+			dates := make([]time.Time, 2)
+			for i := 0; i < len(in.List) && i < 2; i += 1 {
+				date, er := parseOptionalDay(in.List[i])
+				if er != nil {
+					out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+					return nil
+				}
+				dates[i] = date
+			}
+			list := class.GetDuties(in.Value, dates[0], dates[1])
+			bytes, _ = json.Marshal(list)
+			out.Count = uint32(len(list))
+		}
+		out.Key = string(bytes)
+		out.Owner = class.UID
+	} else if in.Filter == "seating" || in.Filter == "seatings" {
+		// uid: 班级，seating时value为学期，seatings返回所有学期的座位表
+		class := cache.Context().GetHistoryClass(in.Uid)
+		if class == nil {
+			out.Status = outError(path, "not found the class", pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		var bytes []byte
+		if in.Filter == "seating" {
+			info := class.GetSeating(in.Value)
+			if info == nil {
+				out.Status = outError(path, "not found the seating of the term", pbstatus.ResultStatus_NotExisted)
+				return nil
+			}
+			bytes, _ = json.Marshal(info)
+			out.Count = uint32(len(info.Seats))
+		} else {
+			list := class.GetSeatings()
+			bytes, _ = json.Marshal(list)
+			out.Count = uint32(len(list))
+		}
+		out.Key = string(bytes)
+		out.Owner = class.UID
+	} else if in.Filter == "roster" || in.Filter == "memberships" {
+		// uid: 班级，roster时value为日期，为空时为当前，返回当天在班级的学生；memberships返回所有在籍记录
+		class := cache.Context().GetHistoryClass(in.Uid)
+		if class == nil {
+			out.Status = outError(path, "not found the class", pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		var bytes []byte
+		if in.Filter == "roster" {
+			date, er := parseRosterDate(in.Value)
+			if er != nil {
+				out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+				return nil
+			}
+			list := class.GetRosterAt(date)
+			bytes, _ = json.Marshal(list)
+			out.Count = uint32(len(list))
+		} else {
+			list := class.GetMemberships()
+			bytes, _ = json.Marshal(list)
+			out.Count = uint32(len(list))
+		}
+		out.Key = string(bytes)
+		out.Owner = class.UID
+	} else if in.Filter == "roles" {
+		// uid: 班级，value: 日期，为空时返回所有任职记录
+		class := cache.Context().GetHistoryClass(in.Uid)
+		if class == nil {
+			out.Status = outError(path, "not found the class", pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		date, er := parseOptionalDay(in.Value)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		list := class.GetRoles(date)
+		bytes, _ := json.Marshal(list)
+		out.Key = string(bytes)
+		out.Owner = class.UID
+		out.Count = uint32(len(list))
+	} else if in.Filter == "roles.teacher" {
+		list := cache.Context().GetTeacherRoles(in.Uid)
+		bytes, _ := json.Marshal(list)
+		out.Key = string(bytes)
+		out.Owner = in.Uid
+		out.Count = uint32(len(list))
+	} else if in.Filter == "capacity.class" {
+		class := cache.Context().GetClass(in.Uid)
+		if class == nil {
+			out.Status = outError(path, "not found the class", pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		info := class.GetCapacityReport()
+		bytes, _ := json.Marshal(info)
+		out.Key = string(bytes)
+		out.Owner = class.UID
+		out.Count = info.Count
+	} else if in.Filter == "capacity.over" {
+		school, _ := cache.Context().GetSchoolBy(in.Parent)
+		if school == nil {
+			out.Status = outError(path, "not found the school by uid", pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		list := school.GetCapacityReports()
+		bytes, _ := json.Marshal(list)
+		out.Key = string(bytes)
+		out.Owner = school.UID
+		out.Count = uint32(len(list))
+	} else if in.Filter == "scores.student" {
+		// uid: 学生，监护人只能查看自己的孩子
+		if !canViewStudent(ctx, cache.Context().GetStudent(in.Uid)) {
+			out.Status = outError(path, "the caller is not the custodian of student", pbstatus.ResultStatus_Empty)
+			return nil
+		}
+		list := cache.Context().GetStudentScores(in.Uid)
+		bytes, _ := json.Marshal(list)
+		out.Key = string(bytes)
+		out.Owner = in.Uid
+		out.Count = uint32(len(list))
+	}
 
 	out.Status = outLog(path, out)
 	return nil
@@ -219,12 +534,346 @@ func (mine *ClassService) SetByFilter(ctx context.Context, in *pb.RequestPage, o
 		out.Status = outError(path, "not found the class", pbstatus.ResultStatus_NotExisted)
 		return nil
 	}
+	var err error
+	var records []*cache.AttendanceInfo
+	var scores []*cache.ScoreInfo
+	if in.Filter == "split" || in.Filter == "merge" {
+		plan, er := planClasses(school, in)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		_, err = school.ExecutePlan(plan, in.Operator)
+	} else if in.Filter == "assign" {
+		// value: 学科UID，params: 老师UID，list: [开始日期, 结束日期]，日期可以为空
+		dates := make([]time.Time, 2)
+		for i := 0; i < len(in.List) && i < 2; i += 1 {
+			date, er := parseOptionalDay(in.List[i])
+			if er != nil {
+				out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+				return nil
+			}
+			dates[i] = date
+		}
+		_, err = school.AssignTeacher(info, in.Value, in.Params, in.Operator, dates[0], dates[1])
+	} else if in.Filter == "assign.end" {
+		// value: 任课安排UID，params: 结束日期，为空时为当天
+		end, er := parseOptionalDay(in.Params)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		err = school.EndAssignment(in.Value, in.Operator, end)
+	} else if in.Filter == "assign.remove" {
+		err = school.RemoveAssignment(in.Value, in.Operator)
+	} else if in.Filter == "officers" {
+		// value: 班干部类别UID，params: 学期，list: 担任的学生
+		_, err = school.SetOfficers(info, in.Value, in.Params, in.Operator, in.List)
+	} else if in.Filter == "officer.remove" {
+		err = school.RemoveOfficer(in.Value, in.Operator)
+	} else if in.Filter == "duties" {
+		// value: 轮换规则(order、shuffle)，params: 学期，list: [开始日期, 结束日期, 每天人数, 星期"1,2,3,4,5"]
+		if len(in.List) < 3 {
+			out.Status = outError(path, "the duty rule is empty", pbstatus.ResultStatus_Empty)
+			return nil
+		}
+		from, er := cache.ParseDay(in.List[0])
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		to, er := cache.ParseDay(in.List[1])
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		size, er := strconv.Atoi(in.List[2])
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		rule := cache.DutyRule{Rule: in.Value, Size: size}
+		if len(in.List) > 3 && in.List[3] != "" {
+			for _, item := range strings.Split(in.List[3], ",") {
+				day, er := strconv.ParseUint(item, 10, 32)
+				if er != nil || day > 6 {
+					out.Status = outError(path, "the duty weekday is error", pbstatus.ResultStatus_FormatError)
+					return nil
+				}
+				rule.Weekdays = append(rule.Weekdays, time.Weekday(day))
+			}
+		}
+		_, err = info.GenerateDuties(in.Params, in.Operator, from, to, rule)
+	} else if in.Filter == "timetable.teacher" {
+		// value: 课表学年，params: 老师，为空时改回按任课安排，list: 课时"星期:节次"
+		year, er := strconv.ParseUint(in.Value, 10, 32)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		slots := make([]proxy.TimetableItem, 0, len(in.List))
+		for _, item := range in.List {
+			arr := strings.Split(item, ":")
+			if len(arr) != 2 {
+				out.Status = outError(path, "the slot format is error", pbstatus.ResultStatus_FormatError)
+				return nil
+			}
+			weekday, er := strconv.ParseUint(arr[0], 10, 32)
+			if er != nil {
+				out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+				return nil
+			}
+			number, er := strconv.ParseUint(arr[1], 10, 32)
+			if er != nil {
+				out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+				return nil
+			}
+			slots = append(slots, proxy.TimetableItem{Weekday: time.Weekday(weekday), Number: uint8(number)})
+		}
+		_, err = school.UpdateTimetableTeacher(info.UID, uint32(year), in.Params, in.Operator, slots)
+	} else if in.Filter == "seat.layout" {
+		// params: 学期，list: [行数, 列数, 不可用的座位"行-列,行-列"]
+		if len(in.List) < 2 {
+			out.Status = outError(path, "the seat layout is empty", pbstatus.ResultStatus_Empty)
+			return nil
+		}
+		rows, _ := strconv.ParseUint(in.List[0], 10, 32)
+		columns, _ := strconv.ParseUint(in.List[1], 10, 32)
+		disabled := make([]string, 0, 2)
+		if len(in.List) > 2 && in.List[2] != "" {
+			disabled = strings.Split(in.List[2], ",")
+		}
+		_, err = info.UpdateSeatLayout(in.Params, in.Operator, uint8(rows), uint8(columns), disabled)
+	} else if in.Filter == "seats" {
+		// params: 学期，list: "学生:行:列"，学生为空时清空该座位
+		seats := make([]proxy.SeatInfo, 0, len(in.List))
+		for _, item := range in.List {
+			arr := strings.Split(item, ":")
+			if len(arr) != 3 {
+				out.Status = outError(path, "the seat format is error", pbstatus.ResultStatus_FormatError)
+				return nil
+			}
+			row, er := strconv.ParseUint(arr[1], 10, 32)
+			if er != nil {
+				out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+				return nil
+			}
+			column, er := strconv.ParseUint(arr[2], 10, 32)
+			if er != nil {
+				out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+				return nil
+			}
+			seats = append(seats, proxy.SeatInfo{Row: uint8(row), Column: uint8(column), Student: arr[0]})
+		}
+		_, err = info.AssignSeats(in.Params, in.Operator, seats)
+	} else if in.Filter == "seat.arrange" {
+		// value: 策略(height、random、sex)，params: 学期
+		_, err = info.ArrangeSeats(in.Params, in.Operator, in.Value)
+	} else if in.Filter == "role" {
+		// value: 职务(master、assistant或其他)，params: 老师UID，为空时结束当前任职
+		err = info.SetRole(in.Value, in.Params, in.Operator)
+	} else if in.Filter == "track" {
+		// value: 分科方向，params: 教学语言
+		err = info.UpdateTrack(in.Value, in.Params, in.Operator)
+	} else if in.Filter == "capacity" {
+		// value: 班级容量，为0时使用年级默认值
+		capacity, er := strconv.ParseUint(in.Value, 10, 32)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		err = info.UpdateCapacity(in.Operator, uint32(capacity))
+	} else if in.Filter == "wait.append" {
+		// list: 候补学生，params: 备注
+		for _, student := range in.List {
+			err = info.AppendWait(student, in.Params, in.Operator)
+			if err != nil {
+				break
+			}
+		}
+	} else if in.Filter == "wait.remove" {
+		for _, student := range in.List {
+			err = info.RemoveWait(student, in.Operator)
+			if err != nil {
+				break
+			}
+		}
+	} else if in.Filter == "group.join" {
+		// list: 加入虚拟班的学生
+		err = info.JoinGroup(in.Operator, in.List)
+	} else if in.Filter == "group.leave" {
+		// list: 退出虚拟班的学生，params: 备注
+		err = info.LeaveGroup(in.Operator, in.Params, in.List)
+	} else if in.Filter == "scores" {
+		// value: 考试UID，list: "学生:分数:备注"
+		school, _ := cache.Context().GetSchoolBy(info.School)
+		if school == nil {
+			out.Status = outError(path, "not found the school by uid", pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		exam := school.GetExam(in.Value)
+		if exam == nil {
+			out.Status = outError(path, "not found the exam by uid", pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		marks := make([]cache.ScoreMark, 0, len(in.List))
+		for _, item := range in.List {
+			mark, er := parseScoreMark(item)
+			if er != nil {
+				out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+				return nil
+			}
+			marks = append(marks, *mark)
+		}
+		scores, err = info.EnterScores(exam, getOperator(ctx, in.Operator), marks)
+	} else if in.Filter == "attendance" || in.Filter == "attendances" {
+		// value: 日期，params: 节次(0为全天)
+		date, er := cache.ParseDay(in.Value)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		period, _ := strconv.ParseUint(in.Params, 10, 32)
+		if in.Filter == "attendance" {
+			// list: [学生, 状态, 原因]
+			mark, er := parseAttendanceMark(strings.Join(in.List, ":"))
+			if er != nil {
+				out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+				return nil
+			}
+			var record *cache.AttendanceInfo
+			record, err = info.MarkAttendance(mark.Student, date, uint8(period), mark.Status, mark.Reason, getOperator(ctx, in.Operator))
+			if record != nil {
+				records = append(records, record)
+			}
+		} else {
+			// list: 例外学生"学生:状态:原因"，其他在读学生记为出勤
+			marks := make([]cache.AttendanceMark, 0, len(in.List))
+			for _, item := range in.List {
+				mark, er := parseAttendanceMark(item)
+				if er != nil {
+					out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+					return nil
+				}
+				marks = append(marks, *mark)
+			}
+			records, err = info.MarkAttendances(date, uint8(period), getOperator(ctx, in.Operator), marks)
+		}
+	}
+	if err != nil {
+		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
+		return nil
+	}
 
 	out.Info = switchClass(info)
+	if records != nil {
+		out.Info.Students = switchAttendances(records)
+	}
+	if scores != nil {
+		out.Info.Students = switchScores(scores)
+	}
 	out.Status = outLog(path, out)
 	return nil
 }
 
+func parseAttendanceMark(msg string) (*cache.AttendanceMark, error) {
+	arr := strings.SplitN(msg, ":", 3)
+	if len(arr) < 2 {
+		return nil, errors.New("the attendance format is error")
+	}
+	st, err := strconv.ParseUint(arr[1], 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	mark := new(cache.AttendanceMark)
+	mark.Student = arr[0]
+	mark.Status = cache.AttendStatus(st)
+	if len(arr) > 2 {
+		mark.Reason = arr[2]
+	}
+	return mark, nil
+}
+
+func parseOptionalDay(msg string) (time.Time, error) {
+	if msg == "" {
+		return time.Time{}, nil
+	}
+	return cache.ParseDay(msg)
+}
+
+// parseRosterDate 花名册按当天结束时计算，为空时为当前时间
+func parseRosterDate(msg string) (time.Time, error) {
+	if msg == "" {
+		return time.Now(), nil
+	}
+	date, err := cache.ParseDay(msg)
+	if err != nil {
+		return date, err
+	}
+	return date.AddDate(0, 0, 1).Add(-time.Second), nil
+}
+
+// planClasses 分班时uid为原班级，value为班级数量，list为指定分配"学生:班级序号"；
+// 合班时uid为目标班级，list为被合并的班级
+func planClasses(school *cache.SchoolInfo, in *pb.RequestPage) (*cache.ClassPlan, error) {
+	if strings.HasPrefix(in.Filter, cache.PlanMerge) {
+		return school.PlanMergeClasses(in.Uid, in.List)
+	}
+	count, err := strconv.Atoi(in.Value)
+	if err != nil {
+		return nil, err
+	}
+	assign := make(map[string]int, len(in.List))
+	for _, item := range in.List {
+		arr := strings.Split(item, ":")
+		if len(arr) != 2 {
+			return nil, errors.New("the split assign format is error")
+		}
+		index, er := strconv.Atoi(arr[1])
+		if er != nil {
+			return nil, er
+		}
+		assign[arr[0]] = index
+	}
+	return school.PlanSplitClass(in.Uid, count, assign)
+}
+
+func parseScoreMark(msg string) (*cache.ScoreMark, error) {
+	arr := strings.SplitN(msg, ":", 3)
+	if len(arr) < 2 {
+		return nil, errors.New("the score format is error")
+	}
+	value, err := strconv.ParseFloat(arr[1], 32)
+	if err != nil {
+		return nil, err
+	}
+	mark := new(cache.ScoreMark)
+	mark.Student = arr[0]
+	mark.Value = float32(value)
+	if len(arr) > 2 {
+		mark.Remark = arr[2]
+	}
+	return mark, nil
+}
+
+// switchScores 分数放在remark中返回
+func switchScores(list []*cache.ScoreInfo) []*pb.MemberInfo {
+	arr := make([]*pb.MemberInfo, 0, len(list))
+	for _, item := range list {
+		arr = append(arr, &pb.MemberInfo{Uid: item.UID, Student: item.Student,
+			Remark: strconv.FormatFloat(float64(item.Value), 'f', -1, 32)})
+	}
+	return arr
+}
+
+func switchAttendances(list []*cache.AttendanceInfo) []*pb.MemberInfo {
+	arr := make([]*pb.MemberInfo, 0, len(list))
+	for _, item := range list {
+		arr = append(arr, &pb.MemberInfo{Uid: item.UID, Student: item.Student, Status: uint32(item.Status), Remark: item.Reason})
+	}
+	return arr
+}
+
 func (mine *ClassService) RemoveOne(ctx context.Context, in *pb.RequestInfo, out *pb.ReplyInfo) error {
 	path := "class.removeOne"
 	inLog(path, in)
@@ -319,15 +968,21 @@ func (mine *ClassService) AppendStudent(ctx context.Context, in *pb.ReqClassStud
 		out.Status = outError(path, "not found the student", pbstatus.ResultStatus_NotExisted)
 		return nil
 	}
-	err := info.AddStudent(student)
+	var err error
+	if info.IsVirtual() {
+		// 虚拟班不影响学生所在的行政班
+		err = info.JoinGroup(in.Operator, []string{student.UID})
+	} else {
+		err = info.TransferStudent(student, oClass, in.Operator)
+	}
+	if err == cache.ErrClassFull {
+		// 班级已满时和新建学生一样进入候补队列，补位时再转班
+		err = info.AppendWait(student.UID, cache.RemarkClassFull, in.Operator)
+	}
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
 	}
-	_ = student.UpdateClassNumber(info.Number, in.Operator)
-	if oClass != nil {
-		_ = oClass.RemoveStudent(in.Student, "change class", student.ID, cache.StudentLeave)
-	}
 	out.Students = make([]*pb.MemberInfo, 0, len(info.Members))
 	for _, member := range info.Members {
 		out.Students = append(out.Students, &pb.MemberInfo{Uid: member.UID, Student: member.Student, Status: uint32(member.Status), Remark: member.Remark})
@@ -355,7 +1010,7 @@ func (mine *ClassService) SubtractStudent(ctx context.Context, in *pb.ReqClassSt
 		return nil
 	}
 
-	err := class.RemoveStudent(in.Student, in.Remark, student.ID, cache.StudentLeave)
+	err := class.RemoveStudent(in.Student, in.Remark, in.Operator, student.ID, cache.StudentLeave)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -0,0 +1,451 @@
+package grpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/micro/go-micro/v2/metadata"
+	"github.com/micro/go-micro/v2/server"
+	pb "github.com/xtech-cloud/omo-msp-school/proto/school"
+	"omo.msa.school/cache"
+	"omo.msa.school/config"
+	"strings"
+)
+
+const (
+	RoleSystem    = "system"    // 内部服务调用，不做脱敏
+	RoleAdmin     = "admin"     // 学校管理员
+	RoleTeacher   = "teacher"   // 老师
+	RoleCustodian = "custodian" // 监护人
+	RoleGuest     = "guest"     // 其他调用者
+)
+
+const (
+	SensitivityPublic   Sensitivity = 0 // 公开
+	SensitivityInternal Sensitivity = 1 // 校内可见
+	SensitivityPrivate  Sensitivity = 2 // 仅管理员可见
+)
+
+// MetaRole 请求元数据中表示调用者角色的字段
+const MetaRole = "Role"
+
+// MetaToken 内部服务调用时携带的令牌，必须和配置的service.token一致
+const MetaToken = "Token"
+
+// MetaUser 网关验证后写入的调用者身份，监护人为手机号，不能使用请求中的operator代替
+const MetaUser = "User"
+
+type Sensitivity uint8
+
+// sensitiveFields 字段敏感级别登记表，键为 对象.字段
+var sensitiveFields = map[string]Sensitivity{
+	"student.card":       SensitivityPrivate,
+	"student.sid":        SensitivityPrivate,
+	"student.sn":         SensitivityInternal,
+	"student.entity":     SensitivityInternal,
+	"custodian.name":     SensitivityInternal,
+	"custodian.phones":   SensitivityInternal,
+	"custodian.identify": SensitivityPrivate,
+	"teacher.user":       SensitivityInternal,
+	"teacher.entity":     SensitivityInternal,
+}
+
+// redactKeys 日志中需要脱敏的字段，只包含不会和普通字段重名的个人信息
+var redactKeys = map[string]bool{
+	"card":      true,
+	"cards":     true,
+	"sid":       true,
+	"phones":    true,
+	"phone":     true,
+	"identify":  true,
+	"identity":  true,
+	"applicant": true,
+}
+
+// payloadFields Kvs以及统计结果中JSON字段的敏感级别，键为小写的字段名
+var payloadFields = map[string]Sensitivity{
+	"card":      SensitivityPrivate,
+	"cards":     SensitivityPrivate,
+	"sid":       SensitivityPrivate,
+	"identify":  SensitivityPrivate,
+	"identity":  SensitivityPrivate,
+	"phone":     SensitivityInternal,
+	"phones":    SensitivityInternal,
+	"applicant": SensitivityInternal,
+	"reason":    SensitivityInternal,
+}
+
+// payloadMarks 带有标记字段的JSON对象中，以下字段（包括下级对象）同样是个人信息：
+// 请假的创建人、审批记录的操作人和备注都是申请人填写的；删除回执的目标是监护人手机号或者学生
+var payloadMarks = map[string][]string{
+	"applicant": {"creator", "operator", "remark"},
+	"signature": {"target"},
+}
+
+var roleLevels = map[string]Sensitivity{
+	RoleSystem:    SensitivityPrivate,
+	RoleAdmin:     SensitivityPrivate,
+	RoleTeacher:   SensitivityInternal,
+	RoleCustodian: SensitivityPublic,
+	RoleGuest:     SensitivityPublic,
+}
+
+// recordFields 带有student字段的JSON对象是某个学生的记录（成绩、请假、考勤等），
+// 调用者不能查看该学生时删除以下字段
+var recordFields = []string{"value", "rank", "remark", "reason", "status", "applicant", "histories"}
+
+// getRole 角色由网关验证后写入，除访客外都必须携带配置的令牌，否则按访客处理；
+// 没有携带角色的请求在未开启service.privacy时按内部服务处理，兼容旧的调用方
+func getRole(ctx context.Context) string {
+	role, ok := metadata.Get(ctx, MetaRole)
+	if !ok || role == "" {
+		if !config.Schema.Service.Privacy {
+			return RoleSystem
+		}
+		return RoleGuest
+	}
+	role = strings.ToLower(role)
+	if _, had := roleLevels[role]; !had {
+		return RoleGuest
+	}
+	if role != RoleGuest && !trustedSystem(ctx) {
+		return RoleGuest
+	}
+	return role
+}
+
+func trustedSystem(ctx context.Context) bool {
+	if config.Schema.Service.Token == "" {
+		return false
+	}
+	token, ok := metadata.Get(ctx, MetaToken)
+	if !ok || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(config.Schema.Service.Token)) == 1
+}
+
+func getCaller(ctx context.Context) string {
+	user, ok := metadata.Get(ctx, MetaUser)
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(user)
+}
+
+// getOperator 权限检查使用的操作人，内部服务可以代替用户操作，使用请求中的operator，其他调用者只能使用网关验证的身份
+func getOperator(ctx context.Context, operator string) string {
+	if getRole(ctx) == RoleSystem {
+		return operator
+	}
+	return getCaller(ctx)
+}
+
+// isStaff 内部服务、管理员和老师
+func isStaff(ctx context.Context) bool {
+	switch getRole(ctx) {
+	case RoleSystem, RoleAdmin, RoleTeacher:
+		return true
+	default:
+		return false
+	}
+}
+
+// canViewStudent 内部服务、管理员和老师可以查看所有学生，监护人只能查看自己的孩子，访客不能查看
+func canViewStudent(ctx context.Context, student *cache.StudentInfo) bool {
+	if student == nil {
+		return false
+	}
+	switch getRole(ctx) {
+	case RoleSystem, RoleAdmin, RoleTeacher:
+		return true
+	case RoleCustodian:
+		caller := getCaller(ctx)
+		return caller != "" && student.HadCustodian(caller)
+	default:
+		return false
+	}
+}
+
+func visible(role, field string) bool {
+	level, ok := sensitiveFields[field]
+	if !ok {
+		return true
+	}
+	return roleLevels[role] >= level
+}
+
+// maskText 保留首尾少量字符，其余用*代替
+func maskText(str string) string {
+	if str == "" {
+		return str
+	}
+	arr := []rune(str)
+	size := len(arr)
+	head, tail := 1, 0
+	if size > 10 {
+		head, tail = 3, 4
+	} else if size > 6 {
+		head, tail = 3, 2
+	} else if size > 2 {
+		tail = 1
+	}
+	for i := head; i < size-tail; i++ {
+		arr[i] = '*'
+	}
+	return string(arr)
+}
+
+func maskStudent(role string, info *pb.StudentInfo) {
+	if info == nil || role == RoleSystem {
+		return
+	}
+	if !visible(role, "student.card") {
+		info.Card = maskText(info.Card)
+	}
+	if !visible(role, "student.sid") {
+		info.Sid = maskText(info.Sid)
+	}
+	if !visible(role, "student.sn") {
+		info.Sn = maskText(info.Sn)
+	}
+	if !visible(role, "student.entity") {
+		info.Entity = ""
+	}
+	for _, custodian := range info.Custodians {
+		maskCustodian(role, custodian)
+	}
+	for _, kv := range info.Kvs {
+		if kv != nil {
+			kv.Value = maskPayload(role, kv.Value)
+		}
+	}
+}
+
+func maskCustodian(role string, info *pb.CustodianInfo) {
+	if info == nil {
+		return
+	}
+	if !visible(role, "custodian.name") {
+		info.Name = maskText(info.Name)
+	}
+	if !visible(role, "custodian.identify") {
+		info.Identify = maskText(info.Identify)
+	}
+	if !visible(role, "custodian.phones") {
+		phones := make([]string, 0, len(info.Phones))
+		for _, phone := range info.Phones {
+			phones = append(phones, maskText(phone))
+		}
+		info.Phones = phones
+	}
+}
+
+func maskTeacher(role string, info *pb.TeacherInfo) {
+	if info == nil || role == RoleSystem {
+		return
+	}
+	if !visible(role, "teacher.user") {
+		info.User = ""
+	}
+	if !visible(role, "teacher.entity") {
+		info.Entity = ""
+	}
+}
+
+// viewer 返回判断调用者能否查看某个学生的函数，同一个返回结果中的学生只查询一次
+func viewer(ctx context.Context) func(uid string) bool {
+	checked := make(map[string]bool)
+	return func(uid string) bool {
+		if ok, had := checked[uid]; had {
+			return ok
+		}
+		ok := canViewStudent(ctx, cache.Context().GetStudent(uid))
+		checked[uid] = ok
+		return ok
+	}
+}
+
+func maskMembers(list []*pb.MemberInfo, viewable func(uid string) bool) {
+	for _, member := range list {
+		if member != nil && !viewable(member.Student) {
+			member.Remark = ""
+		}
+	}
+}
+
+func maskReply(role string, rsp interface{}, viewable func(uid string) bool) {
+	switch out := rsp.(type) {
+	case *pb.ReplyStudentInfo:
+		maskStudent(role, out.Info)
+	case *pb.ReplyStudentList:
+		for _, item := range out.List {
+			maskStudent(role, item)
+		}
+	case *pb.ReplyTeacherInfo:
+		maskTeacher(role, out.Info)
+	case *pb.ReplyTeacherList:
+		for _, item := range out.List {
+			maskTeacher(role, item)
+		}
+	case *pb.ReplyClassInfo:
+		if out.Info != nil {
+			maskMembers(out.Info.Students, viewable)
+		}
+	case *pb.ReplyClassList:
+		for _, item := range out.List {
+			if item != nil {
+				maskMembers(item.Students, viewable)
+			}
+		}
+	case *pb.ReplyClassStudents:
+		maskMembers(out.Students, viewable)
+	case *pb.ReplyStatistic:
+		out.Key = maskRecords(out.Key, viewable)
+		out.Key = maskPayload(role, out.Key)
+	}
+}
+
+// maskRecords 删除调用者不能查看的学生记录中的个人字段，不是JSON的内容原样返回
+func maskRecords(text string, viewable func(uid string) bool) string {
+	tree, ok := parsePayload(text)
+	if !ok {
+		return text
+	}
+	bytes, err := json.Marshal(hideRecords(tree, viewable))
+	if err != nil {
+		return text
+	}
+	return string(bytes)
+}
+
+func hideRecords(value interface{}, viewable func(uid string) bool) interface{} {
+	switch val := value.(type) {
+	case map[string]interface{}:
+		if student, ok := val["student"].(string); ok && !viewable(student) {
+			for _, key := range recordFields {
+				delete(val, key)
+			}
+		}
+		for k, v := range val {
+			val[k] = hideRecords(v, viewable)
+		}
+		return val
+	case []interface{}:
+		for i, v := range val {
+			val[i] = hideRecords(v, viewable)
+		}
+		return val
+	default:
+		return val
+	}
+}
+
+// maskPayload 对JSON格式的返回内容按字段脱敏，不是JSON的内容原样返回
+func maskPayload(role, text string) string {
+	tree, ok := parsePayload(text)
+	if !ok {
+		return text
+	}
+	bytes, err := json.Marshal(maskValue("", tree, func(key string, extra bool) bool {
+		level, had := payloadFields[key]
+		if !had {
+			if !extra {
+				return false
+			}
+			level = SensitivityInternal
+		}
+		return roleLevels[role] < level
+	}, nil))
+	if err != nil {
+		return text
+	}
+	return string(bytes)
+}
+
+func parsePayload(text string) (interface{}, bool) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "{") && !strings.HasPrefix(text, "[") {
+		return nil, false
+	}
+	var tree interface{}
+	if json.Unmarshal([]byte(text), &tree) != nil {
+		return nil, false
+	}
+	return tree, true
+}
+
+// maskValue 遍历JSON，hidden判断字段是否需要脱敏，extra为上级对象根据payloadMarks追加的字段
+func maskValue(key string, value interface{}, hidden func(key string, extra bool) bool, extras []string) interface{} {
+	key = strings.ToLower(key)
+	switch val := value.(type) {
+	case map[string]interface{}:
+		for k := range val {
+			if arr, ok := payloadMarks[strings.ToLower(k)]; ok {
+				extras = append(append([]string{}, extras...), arr...)
+			}
+		}
+		for k, v := range val {
+			val[k] = maskValue(k, v, hidden, extras)
+		}
+		return val
+	case []interface{}:
+		for i, v := range val {
+			val[i] = maskValue(key, v, hidden, extras)
+		}
+		return val
+	case string:
+		if tree, ok := parsePayload(val); ok {
+			bytes, _ := json.Marshal(maskValue(key, tree, hidden, extras))
+			return string(bytes)
+		}
+		if hidden(key, containsKey(extras, key)) {
+			return maskText(val)
+		}
+		return val
+	default:
+		return val
+	}
+}
+
+func containsKey(list []string, key string) bool {
+	for _, item := range list {
+		if item == key {
+			return true
+		}
+	}
+	return false
+}
+
+// PrivacyWrapper 根据调用者角色对返回的个人信息进行脱敏
+func PrivacyWrapper(fn server.HandlerFunc) server.HandlerFunc {
+	return func(ctx context.Context, req server.Request, rsp interface{}) error {
+		err := fn(ctx, req, rsp)
+		role := getRole(ctx)
+		if role != RoleSystem {
+			maskReply(role, rsp, viewer(ctx))
+		}
+		return err
+	}
+}
+
+// redactJson 日志输出前对敏感字段脱敏
+func redactJson(data interface{}) string {
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return ""
+	}
+	var tree interface{}
+	if json.Unmarshal(bytes, &tree) != nil {
+		return ByteString(bytes)
+	}
+	bytes, _ = json.Marshal(redactValue("", tree))
+	return ByteString(bytes)
+}
+
+func redactValue(key string, value interface{}) interface{} {
+	return maskValue(key, value, func(key string, extra bool) bool {
+		_, had := payloadFields[key]
+		return redactKeys[key] || had || extra
+	}, nil)
+}
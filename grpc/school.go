@@ -2,6 +2,7 @@ package grpc
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	pb "github.com/xtech-cloud/omo-msp-school/proto/school"
 	pbstatus "github.com/xtech-cloud/omo-msp-status/proto/status"
@@ -9,6 +10,7 @@ import (
 	"omo.msa.school/proxy"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type SchoolService struct{}
@@ -92,6 +94,8 @@ func (mine *SchoolService) GetOne(ctx context.Context, in *pb.RequestInfo, out *
 		school = cache.Context().GetSchoolByUser(in.Value)
 	} else if in.Filter == "entity" {
 		school = cache.Context().GetSchoolByEntity(in.Value)
+	} else if in.Filter == "awards" {
+		school, _ = cache.Context().GetSchoolBy(in.Uid)
 	} else {
 		if len(in.Uid) > 1 {
 			school, _ = cache.Context().GetSchoolBy(in.Uid)
@@ -108,6 +112,17 @@ func (mine *SchoolService) GetOne(ctx context.Context, in *pb.RequestInfo, out *
 	}
 
 	out.Info = switchSchool(school)
+	if in.Filter == "awards" {
+		// value: 学期，为空时按所有学期汇总
+		briefs := school.GetAwardBriefs(in.Value)
+		for _, honor := range append(out.Info.Honors, out.Info.Respects...) {
+			for _, brief := range briefs {
+				if brief.Honor == honor.Uid {
+					honor.Bries = append(honor.Bries, &pb.HonorBrief{Year: brief.Term, Count: uint32(len(brief.Targets)), Entities: brief.Targets})
+				}
+			}
+		}
+	}
 	out.Status = outLog(path, out)
 	return nil
 }
@@ -149,6 +164,103 @@ func (mine *SchoolService) GetByFilter(ctx context.Context, in *pb.RequestPage,
 func (mine *SchoolService) GetStatistic(ctx context.Context, in *pb.RequestPage, out *pb.ReplyStatistic) error {
 	path := "school.getStatistic"
 	inLog(path, in)
+	school, _ := cache.Context().GetSchoolBy(in.Parent)
+	if school == nil {
+		out.Status = outError(path, "not found the school by uid", pbstatus.ResultStatus_NotExisted)
+		return nil
+	}
+	out.Owner = school.UID
+	if in.Filter == "tags" {
+		list := school.GetTagStatistic()
+		bytes, _ := json.Marshal(list)
+		out.Key = string(bytes)
+		out.Count = uint32(len(list))
+	} else if in.Filter == "tag" {
+		out.Key = in.Value
+		for _, item := range school.GetTagStatistic() {
+			if item.UID == in.Value || item.Name == in.Value {
+				out.Count = item.Students + item.Teachers
+				break
+			}
+		}
+	} else if strings.HasPrefix(in.Filter, "awards") {
+		var list []*cache.AwardInfo
+		if in.Filter == "awards.target" {
+			list = cache.Context().GetAwardsByTarget(in.Value)
+		} else if in.Filter == "awards.honor" {
+			list = school.GetAwardsByHonor(in.Value)
+		} else {
+			list = school.GetAwardsByTerm(in.Value)
+		}
+		bytes, _ := json.Marshal(list)
+		out.Key = string(bytes)
+		out.Count = uint32(len(list))
+	} else if in.Filter == "exams" {
+		// value: 学期，为空时返回所有考试
+		list := school.GetExams(in.Value)
+		bytes, _ := json.Marshal(list)
+		out.Key = string(bytes)
+		out.Count = uint32(len(list))
+	} else if in.Filter == "erasures" {
+		list := school.GetErasures()
+		bytes, _ := json.Marshal(list)
+		out.Key = string(bytes)
+		out.Count = uint32(len(list))
+	} else if in.Filter == "erasure" {
+		// value: 回执UID，count为1表示签名校验通过
+		info := school.GetErasure(in.Value)
+		if info == nil {
+			out.Status = outError(path, "not found the erasure by uid", pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		bytes, _ := json.Marshal(info)
+		out.Key = string(bytes)
+		if info.Verified {
+			out.Count = 1
+		}
+	} else if in.Filter == "rollover.preview" {
+		// value: 学年，为空时使用当前年份
+		year, er := parseRolloverYear(in.Value)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		info := school.PreviewRollover(year)
+		bytes, _ := json.Marshal(info)
+		out.Key = string(bytes)
+		out.Count = uint32(len(info.Graduates))
+	} else if in.Filter == "roster" {
+		// value: 日期，为空时为当前，返回当天各班级的学生
+		date, er := parseRosterDate(in.Value)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		list := school.GetRosterAt(date)
+		bytes, _ := json.Marshal(list)
+		out.Key = string(bytes)
+		out.Count = uint32(len(list))
+	} else if in.Filter == "snapshot" {
+		// value: 学期
+		info := school.GetRosterSnapshot(in.Value)
+		if info == nil {
+			out.Status = outError(path, "not found the snapshot of the term", pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		bytes, _ := json.Marshal(info)
+		out.Key = string(bytes)
+		out.Count = uint32(len(info.Classes))
+	} else if in.Filter == "snapshots" {
+		list := school.GetRosterSnapshots()
+		bytes, _ := json.Marshal(list)
+		out.Key = string(bytes)
+		out.Count = uint32(len(list))
+	} else if in.Filter == "rollovers" {
+		list := school.GetRollovers()
+		bytes, _ := json.Marshal(list)
+		out.Key = string(bytes)
+		out.Count = uint32(len(list))
+	}
 
 	out.Status = outLog(path, out)
 	return nil
@@ -222,6 +334,199 @@ func (mine *SchoolService) SetByFilter(ctx context.Context, in *pb.RequestPage,
 			return nil
 		}
 		err = school.UpdateGrade(uint8(num), in.Operator)
+	} else if in.Filter == "tag" {
+		// value: 名称，params: 分类，list: [颜色, 互斥组]
+		color := ""
+		group := ""
+		if len(in.List) > 0 {
+			color = in.List[0]
+		}
+		if len(in.List) > 1 {
+			group = in.List[1]
+		}
+		if len(in.Uid) > 0 {
+			err = school.UpdateTag(in.Uid, in.Value, in.Params, color, group, in.Operator)
+		} else {
+			_, err = school.CreateTag(in.Value, in.Params, color, group, in.Operator)
+		}
+	} else if in.Filter == "tag.remove" {
+		err = school.RemoveTag(in.Uid, in.Operator)
+	} else if in.Filter == "tag.merge" {
+		err = school.MergeTag(in.Uid, in.Value, in.Operator)
+	} else if in.Filter == "award" {
+		// uid: 获奖人，value: 荣誉，params: 学期，list: [类型(1学生,2老师), 日期, 颁发单位, 证书, 备注]
+		if len(in.List) < 2 {
+			out.Status = outError(path, "the award type or date is empty", pbstatus.ResultStatus_Empty)
+			return nil
+		}
+		kind, er := strconv.ParseUint(in.List[0], 10, 32)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		date, er := cache.ParseDay(in.List[1])
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		arr := make([]string, 3)
+		copy(arr, in.List[2:])
+		_, err = school.CreateAward(pb.TargetType(kind), in.Value, in.Uid, in.Params, arr[0], arr[1], arr[2], in.Operator, date)
+	} else if in.Filter == "award.remove" {
+		err = school.RemoveAward(in.Uid, in.Operator)
+	} else if in.Filter == "exam" {
+		// value: 名称，params: 学期，list: [年级, 学科, 满分, 日期]，uid不为空时修改
+		if len(in.List) < 4 {
+			out.Status = outError(path, "the exam grade, subject, full or date is empty", pbstatus.ResultStatus_Empty)
+			return nil
+		}
+		grade, er := strconv.ParseUint(in.List[0], 10, 32)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		full, er := strconv.ParseFloat(in.List[2], 32)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		date, er := cache.ParseDay(in.List[3])
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		if len(in.Uid) > 0 {
+			exam := school.GetExam(in.Uid)
+			if exam == nil {
+				out.Status = outError(path, "not found the exam by uid", pbstatus.ResultStatus_NotExisted)
+				return nil
+			}
+			err = exam.UpdateBase(in.Value, in.Params, in.Operator, float32(full), date)
+		} else {
+			_, err = school.CreateExam(in.Value, in.Params, in.List[1], in.Operator, uint8(grade), float32(full), date)
+		}
+	} else if in.Filter == "exam.remove" {
+		err = school.RemoveExam(in.Uid, in.Operator)
+	} else if in.Filter == "behavior" {
+		// value: 名称，params: 默认分值，list: [备注]，uid不为空时修改
+		points, er := strconv.ParseInt(in.Params, 10, 32)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		remark := ""
+		if len(in.List) > 0 {
+			remark = in.List[0]
+		}
+		if len(in.Uid) > 0 {
+			err = school.UpdateBehavior(in.Uid, in.Value, remark, in.Operator, int32(points))
+		} else {
+			_, err = school.CreateBehavior(in.Value, remark, in.Operator, int32(points))
+		}
+	} else if in.Filter == "behavior.remove" {
+		err = school.RemoveBehavior(in.Uid, in.Operator)
+	} else if in.Filter == "officer.type" {
+		// value: 名称，params: 每班人数上限，list: [备注]，uid不为空时修改
+		limit, _ := strconv.ParseUint(in.Params, 10, 32)
+		remark := ""
+		if len(in.List) > 0 {
+			remark = in.List[0]
+		}
+		if len(in.Uid) > 0 {
+			err = school.UpdateOfficerType(in.Uid, in.Value, remark, in.Operator, uint32(limit))
+		} else {
+			_, err = school.CreateOfficerType(in.Value, remark, in.Operator, uint32(limit))
+		}
+	} else if in.Filter == "officer.type.remove" {
+		err = school.RemoveOfficerType(in.Uid, in.Operator)
+	} else if in.Filter == "conduct.term" {
+		err = school.ResetConductTerm(in.Value, in.Operator)
+	} else if in.Filter == "conduct.remove" {
+		err = school.RemoveConduct(in.Uid, in.Operator)
+	} else if in.Filter == "workload" {
+		// value: 老师每周课时下限，params: 上限，为0时不检查
+		min, er := strconv.ParseUint(in.Value, 10, 32)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		max, er := strconv.ParseUint(in.Params, 10, 32)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		err = school.UpdateWorkloadLimit(in.Operator, uint32(min), uint32(max))
+	} else if in.Filter == "capacity" {
+		// list: 年级默认容量"年级:人数"
+		list := make([]proxy.CapacityInfo, 0, len(in.List))
+		for _, item := range in.List {
+			arr := strings.Split(item, ":")
+			if len(arr) != 2 {
+				out.Status = outError(path, "the capacity format is error", pbstatus.ResultStatus_FormatError)
+				return nil
+			}
+			grade, er := strconv.ParseUint(arr[0], 10, 32)
+			if er != nil {
+				out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+				return nil
+			}
+			count, er := strconv.ParseUint(arr[1], 10, 32)
+			if er != nil {
+				out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+				return nil
+			}
+			list = append(list, proxy.CapacityInfo{Grade: uint8(grade), Count: uint32(count)})
+		}
+		err = school.UpdateCapacities(in.Operator, list)
+	} else if in.Filter == "naming" {
+		// value: 班级模板，params: 年级模板，list: [学段, 年级偏移, 数字样式(zh为中文), 班号是否用字母]
+		info := proxy.NamingInfo{Template: in.Value, Grade: in.Params}
+		if len(in.List) > 0 {
+			info.Stage = in.List[0]
+		}
+		if len(in.List) > 1 {
+			offset, _ := strconv.ParseUint(in.List[1], 10, 32)
+			info.Offset = uint8(offset)
+		}
+		if len(in.List) > 2 {
+			info.Numeral = in.List[2]
+		}
+		if len(in.List) > 3 {
+			info.Letter, _ = strconv.ParseBool(in.List[3])
+		}
+		err = school.UpdateNaming(in.Operator, info)
+	} else if in.Filter == "rollover.template" {
+		// list: [起始年级班级数量, 入学月份]
+		if len(in.List) < 2 {
+			out.Status = outError(path, "the rollover template is empty", pbstatus.ResultStatus_Empty)
+			return nil
+		}
+		classes, er := strconv.ParseUint(in.List[0], 10, 32)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		month, _ := strconv.ParseUint(in.List[1], 10, 32)
+		err = school.UpdateRolloverTemplate(in.Operator, uint16(classes), uint8(month))
+	} else if in.Filter == "rollover" {
+		// value: 学年，为空时使用当前年份，报告通过统计接口的rollovers获取
+		year, er := parseRolloverYear(in.Value)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		_, err = school.ExecuteRollover(year, in.Operator)
+	} else if in.Filter == "roster.freeze" {
+		// value: 学期，params: 冻结的日期，为空时为当前
+		date, er := parseRosterDate(in.Params)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		_, err = school.FreezeRoster(in.Value, in.Operator, date)
+	} else if in.Filter == "erasure.custodian" {
+		// value: 监护人手机号，回执通过统计接口的erasures获取
+		_, err = school.AnonymizeCustodian(in.Value, in.Operator)
 	}
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
@@ -277,7 +582,7 @@ func (mine *SchoolService) AppendTeacher(ctx context.Context, in *pb.RequestInfo
 		out.Status = outError(path, "not found the teacher", pbstatus.ResultStatus_NotExisted)
 		return nil
 	}
-	er := school.AppendTeacher(teacher)
+	er := school.AppendTeacher(teacher, in.Operator)
 	if er != nil {
 		out.Status = outError(path, er.Error(), pbstatus.ResultStatus_DBException)
 		return nil
@@ -299,3 +604,14 @@ func (mine *SchoolService) SubtractTeacher(ctx context.Context, in *pb.RequestIn
 	out.Status = outLog(path, fmt.Sprintf("the length = %d", len(out.List)))
 	return nil
 }
+
+func parseRolloverYear(msg string) (uint16, error) {
+	if msg == "" {
+		return uint16(time.Now().Year()), nil
+	}
+	year, err := strconv.ParseUint(msg, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint16(year), nil
+}
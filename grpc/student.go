@@ -2,13 +2,16 @@ package grpc
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"github.com/micro/go-micro/v2/logger"
 	pb "github.com/xtech-cloud/omo-msp-school/proto/school"
 	pbstatus "github.com/xtech-cloud/omo-msp-status/proto/status"
 	"omo.msa.school/cache"
 	"omo.msa.school/proxy"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type StudentService struct{}
@@ -36,10 +39,13 @@ func switchStudent(info *cache.StudentInfo, class *cache.ClassInfo) *pb.StudentI
 			cla := cache.Context().GetClass(info.Class)
 			if cla != nil {
 				tmp.Class = info.Class
-				tmp.Kvs = append(tmp.Kvs, &pb.PairInfo{Key: tmp.Class, Value: cla.FullName()})
+				tmp.Kvs = append(tmp.Kvs, &pb.PairInfo{Key: tmp.Class, Value: cla.DisplayName()})
 			} else {
 				tmp.Class = fmt.Sprintf("%d-%d", info.EnrolDate.Year, tmp.Number)
-				if info.ClassNo > 0 {
+				school, _ := cache.Context().GetSchoolBy(info.School)
+				if school != nil {
+					tmp.Kvs = append(tmp.Kvs, &pb.PairInfo{Key: tmp.Class, Value: school.FormatClassName(info.Grade(), info.ClassNo, "", "")})
+				} else if info.ClassNo > 0 {
 					tmp.Kvs = append(tmp.Kvs, &pb.PairInfo{Key: tmp.Class, Value: fmt.Sprintf("%d年级%d班", info.Grade(), info.ClassNo)})
 				} else {
 					tmp.Kvs = append(tmp.Kvs, &pb.PairInfo{Key: tmp.Class, Value: fmt.Sprintf("%d年级", info.Grade())})
@@ -47,7 +53,7 @@ func switchStudent(info *cache.StudentInfo, class *cache.ClassInfo) *pb.StudentI
 			}
 		} else {
 			tmp.Class = class.UID
-			tmp.Kvs = append(tmp.Kvs, &pb.PairInfo{Key: tmp.Class, Value: class.FullName()})
+			tmp.Kvs = append(tmp.Kvs, &pb.PairInfo{Key: tmp.Class, Value: class.DisplayName()})
 		}
 	} else if info.Status == cache.StudentFinish {
 		tmp.Class = info.EnrolDate.String()
@@ -97,16 +103,27 @@ func (mine *StudentService) AddOne(ctx context.Context, in *pb.ReqStudentAdd, ou
 		if len(in.Entity) > 0 {
 			_ = student.BindEntity(in.Entity, in.Operator)
 		}
-		_ = student.UpdateClassNumber(uint16(in.Number), in.Operator)
 		class := school.GetClassByStudent(student.UID, cache.StudentAll)
 		if class != nil {
+			_ = student.UpdateClassNumber(uint16(in.Number), in.Operator)
 			out.Info = switchStudent(student, class)
 		} else {
 			cla := school.GetClass(in.Class)
 			if cla != nil {
-				_ = cla.AddStudent(student)
-				out.Info = switchStudent(student, cla)
+				// 进入候补队列的学生补位时才设置班号
+				joined, er := cla.AdmitStudent(student, cache.RemarkClassFull, in.Operator)
+				if er != nil {
+					out.Status = outError(path, er.Error(), pbstatus.ResultStatus_DBException)
+					return nil
+				}
+				if joined {
+					_ = student.UpdateClassNumber(cla.Number, in.Operator)
+					out.Info = switchStudent(student, cla)
+				} else {
+					out.Info = switchStudent(student, nil)
+				}
 			} else {
+				_ = student.UpdateClassNumber(uint16(in.Number), in.Operator)
 				out.Info = switchStudent(student, nil)
 			}
 		}
@@ -159,6 +176,7 @@ func (mine *StudentService) GetByFilter(ctx context.Context, in *pb.RequestPage,
 	path := "student.getByFilter"
 	inLog(path, in)
 	var list = make([]*cache.StudentInfo, 0, 10)
+	var leaves []*cache.LeaveInfo
 	if len(in.Parent) > 1 {
 		school, err := cache.Context().GetSchoolBy(in.Parent)
 		if err != nil {
@@ -189,6 +207,15 @@ func (mine *StudentService) GetByFilter(ctx context.Context, in *pb.RequestPage,
 		} else if in.Filter == "search" {
 			act := in.Params == "0"
 			list = school.SearchStudents(in.Value, act)
+		} else if in.Filter == "fuzzy" {
+			list = school.SearchStudentsFuzzy(in.Value, int(in.Number))
+		} else if in.Filter == "leaves" {
+			// value: 班级UID，params: 状态，为空时返回全部
+			class := school.GetClass(in.Value)
+			if class != nil {
+				st, er := strconv.ParseUint(in.Params, 10, 32)
+				leaves = class.GetLeaves(cache.LeaveStatus(st), er != nil)
+			}
 		} else if in.Filter == "enrol" {
 			list = school.GetStudentsByEnrol(in.Value, uint16(in.Number))
 		} else if in.Filter == "bind" {
@@ -225,12 +252,87 @@ func (mine *StudentService) GetByFilter(ctx context.Context, in *pb.RequestPage,
 			}
 		} else if in.Filter == "custodian" {
 			list = cache.Context().GetStudentsByCustodian(in.Value, in.Params)
+		} else if in.Filter == "family" {
+			family := cache.Context().GetFamilyByStudent(in.Value)
+			if family != nil {
+				list = family.GetStudents()
+			}
+		} else if in.Filter == "families" {
+			st, er := strconv.ParseUint(in.Value, 10, 32)
+			if er != nil {
+				out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+				return nil
+			}
+			families := cache.Context().GetFamiliesByStatus(cache.FamilyStatus(st))
+			for _, family := range families {
+				list = append(list, family.GetStudents()...)
+			}
+		} else if in.Filter == "leaves" {
+			// value: 申请人
+			leaves = cache.Context().GetLeavesByApplicant(in.Value)
+		} else if in.Filter == "timeline" || in.Filter == "bindings" {
+			student := cache.Context().GetStudent(in.Value)
+			if student != nil {
+				list = append(list, student)
+			}
+		} else if in.Filter == "conducts" {
+			// value: 学生，params: 学期，监护人只能查看自己的孩子
+			student := cache.Context().GetStudent(in.Value)
+			if student != nil {
+				if !canViewStudent(ctx, student) {
+					out.Status = outError(path, "the caller is not the custodian of student", pbstatus.ResultStatus_Empty)
+					return nil
+				}
+				list = append(list, student)
+			}
+		}
+	}
+	if leaves != nil {
+		list = make([]*cache.StudentInfo, 0, len(leaves))
+		for _, leave := range leaves {
+			if !hadStudentIn(list, leave.Student) {
+				info := cache.Context().GetStudent(leave.Student)
+				if info != nil {
+					list = append(list, info)
+				}
+			}
 		}
 	}
 	out.List = make([]*pb.StudentInfo, 0, len(list))
 	for _, info := range list {
 		class := cache.Context().GetClassByStudent(info.UID)
-		out.List = append(out.List, switchStudent(info, class))
+		tmp := switchStudent(info, class)
+		for _, leave := range leaves {
+			if leave.Student == info.UID {
+				tmp.Kvs = append(tmp.Kvs, switchLeave(leave))
+			}
+		}
+		if in.Filter == "timeline" {
+			for _, event := range info.GetTimeline() {
+				bytes, _ := json.Marshal(event)
+				tmp.Kvs = append(tmp.Kvs, &pb.PairInfo{Key: "timeline", Value: string(bytes)})
+			}
+		} else if in.Filter == "bindings" {
+			for _, binding := range cache.Context().GetBindings(info.UID) {
+				bytes, _ := json.Marshal(binding)
+				tmp.Kvs = append(tmp.Kvs, &pb.PairInfo{Key: "binding", Value: string(bytes)})
+			}
+		} else if in.Filter == "conducts" {
+			school, _ := cache.Context().GetSchoolBy(info.School)
+			if school != nil {
+				for _, item := range school.GetStudentConducts(info.UID, in.Params) {
+					bytes, _ := json.Marshal(item)
+					tmp.Kvs = append(tmp.Kvs, &pb.PairInfo{Key: "conduct", Value: string(bytes)})
+				}
+			}
+		}
+		if in.Filter == "family" || in.Filter == "families" {
+			family := cache.Context().GetFamilyByStudent(info.UID)
+			if family != nil {
+				tmp.Kvs = append(tmp.Kvs, &pb.PairInfo{Key: "family", Value: family.UID})
+			}
+		}
+		out.List = append(out.List, tmp)
 	}
 	out.Status = outLog(path, fmt.Sprintf("the length = %d", len(out.List)))
 	return nil
@@ -373,6 +475,9 @@ func (mine *StudentService) SetByFilter(ctx context.Context, in *pb.RequestPage,
 		return nil
 	}
 	var err error
+	var leave *cache.LeaveInfo
+	var erasure *cache.ErasureInfo
+	var conduct *cache.ConductInfo
 	if in.Filter == "class" {
 		num, er := strconv.Atoi(in.Value)
 		if er != nil {
@@ -389,12 +494,99 @@ func (mine *StudentService) SetByFilter(ctx context.Context, in *pb.RequestPage,
 		}
 	} else if in.Filter == "status" {
 
+	} else if in.Filter == "family" {
+		family := cache.Context().GetFamilyByStudent(info.UID)
+		if family == nil {
+			family, err = cache.Context().CheckFamily(info, in.Operator)
+		}
+		if family != nil && len(in.Value) > 0 {
+			st, er := strconv.ParseUint(in.Value, 10, 32)
+			if er != nil {
+				out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+				return nil
+			}
+			err = family.UpdateStatus(cache.FamilyStatus(st), in.Operator)
+		}
+	} else if in.Filter == "family.remove" {
+		family := cache.Context().GetFamilyByStudent(info.UID)
+		if family != nil {
+			err = family.RemoveStudent(info.UID, in.Operator)
+		}
+	} else if in.Filter == "leave" {
+		// value: 申请人(监护人手机号或者实体)，params: 原因，list: [开始日期, 结束日期]
+		if len(in.List) < 2 {
+			out.Status = outError(path, "the leave date range is empty", pbstatus.ResultStatus_Empty)
+			return nil
+		}
+		from, er := cache.ParseDay(in.List[0])
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		to, er := cache.ParseDay(in.List[1])
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		leave, err = school.SubmitLeave(info.UID, in.Value, in.Params, from, to)
+	} else if in.Filter == "unbind" {
+		// params: 备注
+		err = info.UnbindEntity(in.Operator, in.Params)
+	} else if in.Filter == "rebind" {
+		// value: 新的实体，params: 备注
+		err = info.RebindEntity(in.Value, in.Operator, in.Params)
+	} else if strings.HasPrefix(in.Filter, "leave.") {
+		// value: 请假UID，params: 备注
+		leave = cache.Context().GetLeave(in.Value)
+		if leave == nil || leave.Student != info.UID {
+			out.Status = outError(path, "not found the leave of student", pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		if in.Filter == "leave.approve" {
+			err = leave.Approve(getOperator(ctx, in.Operator), in.Params)
+		} else if in.Filter == "leave.reject" {
+			err = leave.Reject(getOperator(ctx, in.Operator), in.Params)
+		} else if in.Filter == "leave.cancel" {
+			err = leave.Cancel(getOperator(ctx, in.Operator), in.Params)
+		}
+	} else if in.Filter == "conduct" {
+		// value: 行为类别，params: 说明，list: [分值(0为默认分值), 日期]
+		var points int64
+		date := time.Now()
+		if len(in.List) > 0 {
+			points, _ = strconv.ParseInt(in.List[0], 10, 32)
+		}
+		if len(in.List) > 1 {
+			day, er := cache.ParseDay(in.List[1])
+			if er != nil {
+				out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+				return nil
+			}
+			date = day
+		}
+		conduct, err = school.RecordConduct(cla, info.UID, in.Value, in.Params, in.Operator, int32(points), date)
+	} else if in.Filter == "anonymize" {
+		erasure, err = school.AnonymizeStudent(info.UID, in.Operator)
+		if err == nil {
+			info = school.GetStudentByUID(info.UID)
+		}
 	}
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
 	}
 	out.Info = switchStudent(info, cla)
+	if leave != nil {
+		out.Info.Kvs = append(out.Info.Kvs, switchLeave(leave))
+	}
+	if conduct != nil {
+		bytes, _ := json.Marshal(conduct)
+		out.Info.Kvs = append(out.Info.Kvs, &pb.PairInfo{Key: "conduct", Value: string(bytes)})
+	}
+	if erasure != nil {
+		bytes, _ := json.Marshal(erasure)
+		out.Info.Kvs = append(out.Info.Kvs, &pb.PairInfo{Key: "erasure", Value: string(bytes)})
+	}
 	out.Status = outLog(path, out)
 	return nil
 }
@@ -486,6 +678,13 @@ func (mine *StudentService) UpdateCustodian(ctx context.Context, in *pb.ReqStude
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
 	}
+	family := cache.Context().GetFamilyByStudent(info.UID)
+	if family != nil && family.IsConfirmed() {
+		er := family.UpdateCustodian(info.UID, in.Name, in.Phones, in.Identify)
+		if er != nil {
+			logger.Warnf("[error.%s]:sync the custodian to siblings failed: %s", path, er.Error())
+		}
+	}
 	out.Info = switchStudent(info, cla)
 	out.Status = outLog(path, out)
 	return nil
@@ -536,3 +735,17 @@ func (mine *StudentService) UpdateStatus(ctx context.Context, in *pb.RequestStat
 	out.Status = outLog(path, out)
 	return nil
 }
+
+func switchLeave(info *cache.LeaveInfo) *pb.PairInfo {
+	bytes, _ := json.Marshal(info)
+	return &pb.PairInfo{Key: "leave", Value: string(bytes)}
+}
+
+func hadStudentIn(list []*cache.StudentInfo, uid string) bool {
+	for _, item := range list {
+		if item.UID == uid {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package grpc
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	pb "github.com/xtech-cloud/omo-msp-school/proto/school"
 	pbstatus "github.com/xtech-cloud/omo-msp-status/proto/status"
@@ -178,6 +179,11 @@ func (mine *TeacherService) GetByFilter(ctx context.Context, in *pb.RequestPage,
 			for _, info := range list {
 				out.List = append(out.List, switchTeacher(info))
 			}
+		} else if in.Filter == "fuzzy" {
+			list := school.SearchTeachersFuzzy(in.Value, int(in.Number))
+			for _, info := range list {
+				out.List = append(out.List, switchTeacher(info))
+			}
 		} else if in.Filter == "leave" {
 			list := cache.Context().GetLeaveTeachers(school.UID)
 			for _, info := range list {
@@ -208,6 +214,47 @@ func (mine *TeacherService) GetByFilter(ctx context.Context, in *pb.RequestPage,
 func (mine *TeacherService) GetStatistic(ctx context.Context, in *pb.RequestPage, out *pb.ReplyStatistic) error {
 	path := "teacher.getStatistic"
 	inLog(path, in)
+	if in.Filter == "bindings" {
+		list := cache.Context().GetBindings(in.Uid)
+		bytes, _ := json.Marshal(list)
+		out.Key = string(bytes)
+		out.Owner = in.Uid
+		out.Count = uint32(len(list))
+	} else if in.Filter == "career" {
+		// uid: 老师，返回在各学校的任职经历
+		info := cache.Context().GetTeacher(in.Uid)
+		if info == nil {
+			out.Status = outError(path, "not found the teacher by uid", pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		list := info.GetCareer()
+		bytes, _ := json.Marshal(list)
+		out.Key = string(bytes)
+		out.Owner = info.UID
+		out.Count = uint32(len(list))
+	} else if in.Filter == "employments" {
+		// parent: 学校，value: 日期，返回当天在职的任职记录，为空时返回所有记录
+		school, _ := cache.Context().GetSchoolBy(in.Parent)
+		if school == nil {
+			out.Status = outError(path, "not found the school by uid", pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		var list []*cache.EmploymentInfo
+		if in.Value == "" {
+			list = school.GetEmployments()
+		} else {
+			date, er := parseRosterDate(in.Value)
+			if er != nil {
+				out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+				return nil
+			}
+			list = school.GetActiveTeachersAt(date)
+		}
+		bytes, _ := json.Marshal(list)
+		out.Key = string(bytes)
+		out.Owner = school.UID
+		out.Count = uint32(len(list))
+	}
 
 	out.Status = outLog(path, out)
 	return nil
@@ -242,6 +289,33 @@ func (mine *TeacherService) SetByFilter(ctx context.Context, in *pb.RequestPage,
 		out.Status = outError(path, "not found the teacher by uid", pbstatus.ResultStatus_NotExisted)
 		return nil
 	}
+	var err error
+	if in.Filter == "bind" {
+		err = info.BindEntity(in.Value, in.Operator)
+	} else if in.Filter == "unbind" {
+		// params: 备注
+		err = info.UnbindEntity(in.Operator, in.Params)
+	} else if in.Filter == "rebind" {
+		// value: 新的实体，params: 备注
+		err = info.RebindEntity(in.Value, in.Operator, in.Params)
+	} else if in.Filter == "position" {
+		// parent: 学校，value: 职位，params: 变更日期，为空时为当前
+		school, _ := cache.Context().GetSchoolBy(in.Parent)
+		if school == nil {
+			out.Status = outError(path, "not found the school by uid", pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		date, er := parseOptionalDay(in.Params)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		_, err = school.UpdateTeacherPosition(info.UID, in.Value, in.Operator, date)
+	}
+	if err != nil {
+		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
+		return nil
+	}
 
 	out.Info = switchTeacher(info)
 	out.Status = outLog(path, out)
@@ -256,7 +330,7 @@ func (mine *TeacherService) RemoveOne(ctx context.Context, in *pb.RequestInfo, o
 		out.Status = outError(path, "not found the school by scene", pbstatus.ResultStatus_NotExisted)
 		return nil
 	}
-	err := info.RemoveTeacherByUID(in.Uid, in.Value)
+	err := info.RemoveTeacherByUID(in.Uid, in.Value, in.Operator)
 	if err != nil {
 		out.Status = outError(path, err.Error(), pbstatus.ResultStatus_DBException)
 		return nil
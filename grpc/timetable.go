@@ -2,6 +2,7 @@ package grpc
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	pb "github.com/xtech-cloud/omo-msp-school/proto/school"
 	pbstatus "github.com/xtech-cloud/omo-msp-status/proto/status"
@@ -182,6 +183,55 @@ func (mine *TimetableService) GetByFilter(ctx context.Context, in *pb.RequestPag
 func (mine *TimetableService) GetStatistic(ctx context.Context, in *pb.RequestPage, out *pb.ReplyStatistic) error {
 	path := "timetable.getStatistic"
 	inLog(path, in)
+	if in.Filter == "workload" || in.Filter == "workload.teacher" {
+		// value: 课表学年，list: 统计的起止日期（可选，例如学期的起止日期），workload.teacher时uid为老师
+		school, err := cache.Context().GetSchoolBy(in.Parent)
+		if err != nil {
+			out.Status = outError(path, err.Error(), pbstatus.ResultStatus_NotExisted)
+			return nil
+		}
+		out.Owner = school.UID
+		year, er := strconv.ParseUint(in.Value, 10, 32)
+		if er != nil {
+			out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+			return nil
+		}
+		var from, to time.Time
+		if len(in.List) > 0 {
+			from, er = cache.ParseDay(in.List[0])
+			if er != nil {
+				out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+				return nil
+			}
+		}
+		if len(in.List) > 1 {
+			to, er = cache.ParseDay(in.List[1])
+			if er != nil {
+				out.Status = outError(path, er.Error(), pbstatus.ResultStatus_FormatError)
+				return nil
+			}
+		}
+		var bytes []byte
+		if in.Filter == "workload" {
+			report, er := school.GetWorkloadReport(uint32(year), from, to)
+			if er != nil {
+				out.Status = outError(path, er.Error(), pbstatus.ResultStatus_DBException)
+				return nil
+			}
+			bytes, _ = json.Marshal(report)
+			out.Count = uint32(len(report.Overloads) + len(report.Underloads))
+		} else {
+			info, er := school.GetTeacherWorkload(in.Uid, uint32(year), from, to)
+			if er != nil {
+				out.Status = outError(path, er.Error(), pbstatus.ResultStatus_NotExisted)
+				return nil
+			}
+			bytes, _ = json.Marshal(info)
+			out.Owner = in.Uid
+			out.Count = info.Periods
+		}
+		out.Key = string(bytes)
+	}
 
 	out.Status = outLog(path, out)
 	return nil
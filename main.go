@@ -3,7 +3,9 @@ package main
 import (
 	"crypto/md5"
 	"encoding/hex"
+	"encoding/json"
 	"github.com/micro/go-micro/v2"
+	"github.com/micro/go-micro/v2/broker"
 	"github.com/micro/go-micro/v2/logger"
 	_ "github.com/micro/go-plugins/registry/consul/v2"
 	_ "github.com/micro/go-plugins/registry/etcdv3/v2"
@@ -37,9 +39,13 @@ func main() {
 		micro.RegisterTTL(time.Second*time.Duration(config.Schema.Service.TTL)),
 		micro.RegisterInterval(time.Second*time.Duration(config.Schema.Service.Interval)),
 		micro.Address(config.Schema.Service.Address),
+		micro.WrapHandler(grpc.PrivacyWrapper),
 	)
 	// Initialise service
 	service.Init()
+	cache.SetNotifyHandler(func(topic string, msg interface{}) {
+		publishEvent(service, topic, msg)
+	})
 	// Register Handler
 	_ = proto.RegisterClassesServiceHandler(service.Server(), new(grpc.ClassService))
 	_ = proto.RegisterSchoolServiceHandler(service.Server(), new(grpc.SchoolService))
@@ -70,6 +76,18 @@ func main() {
 
 func checkTimer() {
 	time.Sleep(time.Second * 5)
+	_, err := cache.Context().EncryptSecrets()
+	if err != nil {
+		logger.Warn("encrypt secrets failed that err = " + err.Error())
+	}
+	_, err = cache.Context().MigrateMemberships(cache.OperatorSystem)
+	if err != nil {
+		logger.Warn("migrate memberships failed that err = " + err.Error())
+	}
+	_, err = cache.Context().MigrateEmployments(cache.OperatorSystem)
+	if err != nil {
+		logger.Warn("migrate employments failed that err = " + err.Error())
+	}
 	cache.Context().CheckStudentFinish()
 	cache.Context().CheckStudentError()
 	cli := cron.New()
@@ -80,6 +98,14 @@ func checkTimer() {
 		logger.Warn("start cron failed that err = " + er.Error())
 		return
 	}
+	_, er = cli.AddFunc("0 3 1 * *", func() {
+		list := cache.Context().RolloverSchools()
+		logger.Infof("rollover schools count = %d", len(list))
+	})
+	if er != nil {
+		logger.Warn("start cron failed that err = " + er.Error())
+		return
+	}
 	cli.Start()
 	//cache.DebugClasses()
 	//std := new(grpc.StudentService)
@@ -92,6 +118,21 @@ func checkTimer() {
 	//std.GetByFilter(context.Background(), in, out)
 }
 
+func publishEvent(service micro.Service, topic string, msg interface{}) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	message := &broker.Message{
+		Header: map[string]string{"Content-Type": "application/json"},
+		Body:   body,
+	}
+	err = service.Options().Broker.Publish(topic, message)
+	if err != nil {
+		logger.Warn("publish event failed that topic = " + topic + " and err = " + err.Error())
+	}
+}
+
 func md5hex(_file string) string {
 	h := md5.New()
 
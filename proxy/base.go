@@ -15,6 +15,74 @@ type SubjectInfo struct {
 	Remark string `json:"remark" bson:"remark"`
 }
 
+// 学校定义的行为类别，分值为正表示表扬，为负表示违纪
+type BehaviorInfo struct {
+	UID    string `json:"uid" bson:"uid"`
+	Name   string `json:"name" bson:"name"`
+	Points int32  `json:"points" bson:"points"`
+	Remark string `json:"remark" bson:"remark"`
+}
+
+// 年级默认的班级容量，班级未单独设置时使用
+type CapacityInfo struct {
+	Grade uint8  `json:"grade" bson:"grade"`
+	Count uint32 `json:"count" bson:"count"`
+}
+
+// 学年升级的模板，Year为最近一次执行升级的学年
+type RolloverInfo struct {
+	Classes uint16 `json:"classes" bson:"classes"`
+	Month   uint8  `json:"month" bson:"month"`
+	Year    uint16 `json:"year" bson:"year"`
+}
+
+// 班级命名模板，占位符{stage}、{grade}、{number}、{track}、{language}
+type NamingInfo struct {
+	Template string `json:"template" bson:"template"`
+	// 只有年级没有班号时的模板
+	Grade   string `json:"grade" bson:"grade"`
+	Stage   string `json:"stage" bson:"stage"`
+	Offset  uint8  `json:"offset" bson:"offset"`
+	Numeral string `json:"numeral" bson:"numeral"`
+	Letter  bool   `json:"letter" bson:"letter"`
+}
+
+// 学校定义的班干部类别，Limit为每个班级的人数上限，为0时不限制
+type OfficerInfo struct {
+	UID    string `json:"uid" bson:"uid"`
+	Name   string `json:"name" bson:"name"`
+	Limit  uint32 `json:"limit" bson:"limit"`
+	Remark string `json:"remark" bson:"remark"`
+}
+
+// 老师每周课时的上下限，为0时不检查
+type WorkloadInfo struct {
+	Min uint32 `json:"min" bson:"min"`
+	Max uint32 `json:"max" bson:"max"`
+}
+
+// 座位，行列从1开始，第1行为最前排
+type SeatInfo struct {
+	Row     uint8  `json:"row" bson:"row"`
+	Column  uint8  `json:"column" bson:"column"`
+	Student string `json:"student" bson:"student"`
+}
+
+// 花名册快照中的一个班级
+type RosterClass struct {
+	Class    string   `json:"class" bson:"class"`
+	Students []string `json:"students" bson:"students"`
+}
+
+// 学校定义的标签词汇，同一个互斥组内的标签只能选择一个
+type TagInfo struct {
+	UID      string `json:"uid" bson:"uid"`
+	Name     string `json:"name" bson:"name"`
+	Category string `json:"category" bson:"category"`
+	Color    string `json:"color" bson:"color"`
+	Group    string `json:"group" bson:"group"`
+}
+
 // 监护人信息
 type CustodianInfo struct {
 	Name     string   `json:"name" bson:"name"`
@@ -32,6 +100,14 @@ type HistoryInfo struct {
 	Created uint64 `json:"created" bson:"created"`
 }
 
+// 状态变更记录
+type StatusHistory struct {
+	Status   uint8  `json:"status" bson:"status"`
+	Operator string `json:"operator" bson:"operator"`
+	Remark   string `json:"remark" bson:"remark"`
+	Created  uint64 `json:"created" bson:"created"`
+}
+
 type ClassMember struct {
 	UID     string `bson:"uid"`
 	Student string `bson:"student"`
@@ -50,4 +126,6 @@ type TimetableItem struct {
 	Weekday   time.Weekday `json:"weekday" bson:"weekday"`
 	Number uint8        `json:"number" bson:"number"`
 	Name   string       `json:"name" bson:"name"`
+	// 任课老师，为空时按班级的任课安排
+	Teacher string `json:"teacher" bson:"teacher"`
 }
@@ -0,0 +1,96 @@
+package nosql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Assignment 班级学科的任课老师，结束时间为空表示仍在任
+type Assignment struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	ID          uint64             `json:"id" bson:"id"`
+	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
+	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Creator     string             `json:"creator" bson:"creator"`
+	Operator    string             `json:"operator" bson:"operator"`
+
+	School  string    `json:"school" bson:"school"`
+	Class   string    `json:"class" bson:"class"`
+	Subject string    `json:"subject" bson:"subject"`
+	Teacher string    `json:"teacher" bson:"teacher"`
+	Start   time.Time `json:"start" bson:"start"`
+	End     time.Time `json:"end" bson:"end"`
+}
+
+func CreateAssignment(info *Assignment) error {
+	_, err := insertOne(TableAssign, info)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func GetAssignmentNextID() uint64 {
+	num, _ := getSequenceNext(TableAssign)
+	return num
+}
+
+func GetAssignment(uid string) (*Assignment, error) {
+	result, err := findOne(TableAssign, uid)
+	if err != nil {
+		return nil, err
+	}
+	model := new(Assignment)
+	err1 := result.Decode(model)
+	if err1 != nil {
+		return nil, err1
+	}
+	return model, nil
+}
+
+func GetAssignmentsByClass(class string) ([]*Assignment, error) {
+	msg := bson.M{"class": class, "deleteAt": new(time.Time)}
+	return getAssignments(msg)
+}
+
+func GetAssignmentsByTeacher(teacher string) ([]*Assignment, error) {
+	msg := bson.M{"teacher": teacher, "deleteAt": new(time.Time)}
+	return getAssignments(msg)
+}
+
+func GetAssignmentsBySchool(school string) ([]*Assignment, error) {
+	msg := bson.M{"school": school, "deleteAt": new(time.Time)}
+	return getAssignments(msg)
+}
+
+func getAssignments(msg bson.M) ([]*Assignment, error) {
+	var items = make([]*Assignment, 0, 20)
+	cursor, err1 := findMany(TableAssign, msg, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		var node = new(Assignment)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
+
+func UpdateAssignmentEnd(uid, operator string, end time.Time) error {
+	msg := bson.M{"end": end, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableAssign, uid, msg)
+	return err
+}
+
+func RemoveAssignment(uid, operator string) error {
+	_, err := removeOne(TableAssign, uid, operator)
+	return err
+}
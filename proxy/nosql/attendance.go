@@ -0,0 +1,127 @@
+package nosql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type Attendance struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	ID          uint64             `json:"id" bson:"id"`
+	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
+	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Creator     string             `json:"creator" bson:"creator"`
+	Operator    string             `json:"operator" bson:"operator"`
+
+	School  string `json:"school" bson:"school"`
+	Class   string `json:"class" bson:"class"`
+	Student string `json:"student" bson:"student"`
+	Grade   uint8  `json:"grade" bson:"grade"`
+	// 考勤日期，当天零点
+	Date time.Time `json:"date" bson:"date"`
+	// 课时节次，0表示全天
+	Period uint8  `json:"period" bson:"period"`
+	Status uint8  `json:"status" bson:"status"`
+	Reason string `json:"reason" bson:"reason"`
+}
+
+func CreateAttendance(info *Attendance) error {
+	_, err := insertOne(TableAttend, info)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func GetAttendanceNextID() uint64 {
+	num, _ := getSequenceNext(TableAttend)
+	return num
+}
+
+func GetAttendance(uid string) (*Attendance, error) {
+	result, err := findOne(TableAttend, uid)
+	if err != nil {
+		return nil, err
+	}
+	model := new(Attendance)
+	err1 := result.Decode(model)
+	if err1 != nil {
+		return nil, err1
+	}
+	return model, nil
+}
+
+func GetAttendanceBy(student string, date time.Time, period uint8) (*Attendance, error) {
+	msg := bson.M{"student": student, "date": date, "period": period, "deleteAt": new(time.Time)}
+	result, err := findOneBy(TableAttend, msg)
+	if err != nil {
+		return nil, err
+	}
+	model := new(Attendance)
+	err1 := result.Decode(model)
+	if err1 != nil {
+		return nil, err1
+	}
+	return model, nil
+}
+
+func GetAttendancesByClass(class string, date time.Time) ([]*Attendance, error) {
+	msg := bson.M{"class": class, "date": date, "deleteAt": new(time.Time)}
+	return getAttendances(msg)
+}
+
+func GetAttendancesByClassRange(class string, from, to time.Time) ([]*Attendance, error) {
+	msg := bson.M{"class": class, "date": bson.M{"$gte": from, "$lte": to}, "deleteAt": new(time.Time)}
+	return getAttendances(msg)
+}
+
+func GetAttendancesByGradeRange(school string, grade uint8, from, to time.Time) ([]*Attendance, error) {
+	msg := bson.M{"school": school, "grade": grade, "date": bson.M{"$gte": from, "$lte": to}, "deleteAt": new(time.Time)}
+	return getAttendances(msg)
+}
+
+func GetAttendancesByStudentRange(student string, from, to time.Time) ([]*Attendance, error) {
+	msg := bson.M{"student": student, "date": bson.M{"$gte": from, "$lte": to}, "deleteAt": new(time.Time)}
+	return getAttendances(msg)
+}
+
+func getAttendances(msg bson.M) ([]*Attendance, error) {
+	var items = make([]*Attendance, 0, 20)
+	cursor, err1 := findMany(TableAttend, msg, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		var node = new(Attendance)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
+
+func UpdateAttendanceStatus(uid, operator, reason string, st uint8) error {
+	msg := bson.M{"status": st, "reason": reason, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableAttend, uid, msg)
+	return err
+}
+
+// ClearAttendanceReasons 匿名化时清除学生考勤的原因，to为空时不限制日期
+func ClearAttendanceReasons(student, operator string, from, to time.Time) (int64, error) {
+	msg := bson.M{"student": student, "reason": bson.M{"$ne": ""}}
+	if !to.IsZero() {
+		msg["date"] = bson.M{"$gte": from, "$lte": to}
+	}
+	return updateMany(TableAttend, msg, bson.M{"reason": "", "operator": operator, "updatedAt": time.Now()})
+}
+
+func RemoveAttendance(uid, operator string) error {
+	_, err := removeOne(TableAttend, uid, operator)
+	return err
+}
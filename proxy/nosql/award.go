@@ -0,0 +1,115 @@
+package nosql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type Award struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	ID          uint64             `json:"id" bson:"id"`
+	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
+	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Creator     string             `json:"creator" bson:"creator"`
+	Operator    string             `json:"operator" bson:"operator"`
+
+	School string `json:"school" bson:"school"`
+	// 荣誉UID，学生荣誉或者教师荣誉
+	Honor string `json:"honor" bson:"honor"`
+	// 获奖人，学生或者老师的UID
+	Target string    `json:"target" bson:"target"`
+	Type   uint8     `json:"type" bson:"type"`
+	Date   time.Time `json:"date" bson:"date"`
+	// 学期
+	Term string `json:"term" bson:"term"`
+	// 颁发单位
+	Issuer string `json:"issuer" bson:"issuer"`
+	// 证书资源
+	Asset  string `json:"asset" bson:"asset"`
+	Remark string `json:"remark" bson:"remark"`
+}
+
+func CreateAward(info *Award) error {
+	_, err := insertOne(TableAward, info)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func GetAwardNextID() uint64 {
+	num, _ := getSequenceNext(TableAward)
+	return num
+}
+
+func GetAward(uid string) (*Award, error) {
+	result, err := findOne(TableAward, uid)
+	if err != nil {
+		return nil, err
+	}
+	model := new(Award)
+	err1 := result.Decode(model)
+	if err1 != nil {
+		return nil, err1
+	}
+	return model, nil
+}
+
+func GetAwardsByTarget(target string) ([]*Award, error) {
+	msg := bson.M{"target": target, "deleteAt": new(time.Time)}
+	return getAwards(msg)
+}
+
+func GetAwardsByHonor(school, honor string) ([]*Award, error) {
+	msg := bson.M{"school": school, "honor": honor, "deleteAt": new(time.Time)}
+	return getAwards(msg)
+}
+
+func GetAwardsBySchool(school string) ([]*Award, error) {
+	msg := bson.M{"school": school, "deleteAt": new(time.Time)}
+	return getAwards(msg)
+}
+
+func GetAwardsByTerm(school, term string) ([]*Award, error) {
+	msg := bson.M{"school": school, "term": term, "deleteAt": new(time.Time)}
+	return getAwards(msg)
+}
+
+func GetAwardCount(target, honor string) uint32 {
+	msg := bson.M{"target": target, "honor": honor, "deleteAt": new(time.Time)}
+	num, _ := getCountBy(TableAward, msg)
+	return uint32(num)
+}
+
+func getAwards(msg bson.M) ([]*Award, error) {
+	var items = make([]*Award, 0, 10)
+	cursor, err1 := findMany(TableAward, msg, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		var node = new(Award)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
+
+func UpdateAwardBase(uid, term, issuer, asset, remark, operator string, date time.Time) error {
+	msg := bson.M{"term": term, "issuer": issuer, "asset": asset, "remark": remark, "date": date,
+		"operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableAward, uid, msg)
+	return err
+}
+
+func RemoveAward(uid, operator string) error {
+	_, err := removeOne(TableAward, uid, operator)
+	return err
+}
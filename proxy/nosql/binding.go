@@ -0,0 +1,73 @@
+package nosql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Binding 学生或者老师绑定、解绑实体的记录
+type Binding struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	ID          uint64             `json:"id" bson:"id"`
+	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
+	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Creator     string             `json:"creator" bson:"creator"`
+	Operator    string             `json:"operator" bson:"operator"`
+
+	School string `json:"school" bson:"school"`
+	Target string `json:"target" bson:"target"`
+	Type   uint8  `json:"type" bson:"type"`
+	Entity string `json:"entity" bson:"entity"`
+	Action uint8  `json:"action" bson:"action"`
+	Remark string `json:"remark" bson:"remark"`
+}
+
+func CreateBinding(info *Binding) error {
+	_, err := insertOne(TableBinding, info)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func GetBindingNextID() uint64 {
+	num, _ := getSequenceNext(TableBinding)
+	return num
+}
+
+func GetBindingsByTarget(target string) ([]*Binding, error) {
+	msg := bson.M{"target": target, "deleteAt": new(time.Time)}
+	return getBindings(msg)
+}
+
+func GetBindingsByEntity(entity string) ([]*Binding, error) {
+	msg := bson.M{"entity": entity, "deleteAt": new(time.Time)}
+	return getBindings(msg)
+}
+
+func getBindings(msg bson.M) ([]*Binding, error) {
+	var items = make([]*Binding, 0, 5)
+	cursor, err1 := findMany(TableBinding, msg, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		var node = new(Binding)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
+
+// AnonymizeBindings 匿名化时清除绑定记录中的实体以及备注
+func AnonymizeBindings(target, operator string) (int64, error) {
+	msg := bson.M{"target": target}
+	return updateMany(TableBinding, msg, bson.M{"entity": "", "remark": "", "operator": operator, "updatedAt": time.Now()})
+}
@@ -27,6 +27,11 @@ type Class struct {
 	Number    uint16              `json:"number" bson:"number"`
 	Teachers  []string 			  `json:"teachers" bson:"teachers"`
 	Students  []proxy.ClassMember `json:"students" bson:"students"`
+	Capacity  uint32              `json:"capacity" bson:"capacity"`
+	Waits     []proxy.ClassMember `json:"waits" bson:"waits"`
+	Status    uint8               `json:"status" bson:"status"`
+	Track     string              `json:"track" bson:"track"`
+	Language  string              `json:"language" bson:"language"`
 }
 
 func CreateClass(info *Class) error {
@@ -122,6 +127,30 @@ func UpdateClassTeachers(uid, operator string, list []string) error {
 	return err
 }
 
+func UpdateClassCapacity(uid, operator string, capacity uint32) error {
+	msg := bson.M{"capacity": capacity, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableClass, uid, msg)
+	return err
+}
+
+func UpdateClassWaits(uid, operator string, list []proxy.ClassMember) error {
+	msg := bson.M{"waits": list, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableClass, uid, msg)
+	return err
+}
+
+func UpdateClassTrack(uid, track, language, operator string) error {
+	msg := bson.M{"track": track, "language": language, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableClass, uid, msg)
+	return err
+}
+
+func UpdateClassStatus(uid, operator string, st uint8) error {
+	msg := bson.M{"status": st, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableClass, uid, msg)
+	return err
+}
+
 func RemoveClass(uid, operator string) error {
 	_, err := removeOne(TableClass, uid, operator)
 	return err
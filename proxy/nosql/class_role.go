@@ -0,0 +1,75 @@
+package nosql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// ClassRole 班级职务的任职记录，如班主任、副班主任，结束时间为空表示仍在任
+type ClassRole struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	ID          uint64             `json:"id" bson:"id"`
+	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
+	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Creator     string             `json:"creator" bson:"creator"`
+	Operator    string             `json:"operator" bson:"operator"`
+
+	School  string    `json:"school" bson:"school"`
+	Class   string    `json:"class" bson:"class"`
+	Role    string    `json:"role" bson:"role"`
+	Teacher string    `json:"teacher" bson:"teacher"`
+	Start   time.Time `json:"start" bson:"start"`
+	End     time.Time `json:"end" bson:"end"`
+	// Inferred 没有记录的旧任职补录的，开始时间不可靠
+	Inferred bool `json:"inferred" bson:"inferred"`
+}
+
+func CreateClassRole(info *ClassRole) error {
+	_, err := insertOne(TableClassRole, info)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func GetClassRoleNextID() uint64 {
+	num, _ := getSequenceNext(TableClassRole)
+	return num
+}
+
+func GetClassRolesByClass(class string) ([]*ClassRole, error) {
+	msg := bson.M{"class": class, "deleteAt": new(time.Time)}
+	return getClassRoles(msg)
+}
+
+func GetClassRolesByTeacher(teacher string) ([]*ClassRole, error) {
+	msg := bson.M{"teacher": teacher, "deleteAt": new(time.Time)}
+	return getClassRoles(msg)
+}
+
+func getClassRoles(msg bson.M) ([]*ClassRole, error) {
+	var items = make([]*ClassRole, 0, 10)
+	cursor, err1 := findMany(TableClassRole, msg, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		var node = new(ClassRole)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
+
+func UpdateClassRoleEnd(uid, operator string, end time.Time) error {
+	msg := bson.M{"end": end, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableClassRole, uid, msg)
+	return err
+}
@@ -0,0 +1,94 @@
+package nosql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type Conduct struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	ID          uint64             `json:"id" bson:"id"`
+	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
+	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Creator     string             `json:"creator" bson:"creator"`
+	Operator    string             `json:"operator" bson:"operator"`
+
+	School  string `json:"school" bson:"school"`
+	Class   string `json:"class" bson:"class"`
+	Student string `json:"student" bson:"student"`
+	// 行为类别UID
+	Behavior string `json:"behavior" bson:"behavior"`
+	Term     string `json:"term" bson:"term"`
+	Points   int32  `json:"points" bson:"points"`
+	// 记录的老师
+	Teacher string    `json:"teacher" bson:"teacher"`
+	Date    time.Time `json:"date" bson:"date"`
+	Note    string    `json:"note" bson:"note"`
+}
+
+func CreateConduct(info *Conduct) error {
+	_, err := insertOne(TableConduct, info)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func GetConductNextID() uint64 {
+	num, _ := getSequenceNext(TableConduct)
+	return num
+}
+
+func GetConduct(uid string) (*Conduct, error) {
+	result, err := findOne(TableConduct, uid)
+	if err != nil {
+		return nil, err
+	}
+	model := new(Conduct)
+	err1 := result.Decode(model)
+	if err1 != nil {
+		return nil, err1
+	}
+	return model, nil
+}
+
+func GetConductsByStudent(student, term string) ([]*Conduct, error) {
+	msg := bson.M{"student": student, "term": term, "deleteAt": new(time.Time)}
+	return getConducts(msg)
+}
+
+func GetConductsByClass(class, term string) ([]*Conduct, error) {
+	msg := bson.M{"class": class, "term": term, "deleteAt": new(time.Time)}
+	return getConducts(msg)
+}
+
+func GetConductsBySchool(school, term string) ([]*Conduct, error) {
+	msg := bson.M{"school": school, "term": term, "deleteAt": new(time.Time)}
+	return getConducts(msg)
+}
+
+func getConducts(msg bson.M) ([]*Conduct, error) {
+	var items = make([]*Conduct, 0, 20)
+	cursor, err1 := findMany(TableConduct, msg, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		var node = new(Conduct)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
+
+func RemoveConduct(uid, operator string) error {
+	_, err := removeOne(TableConduct, uid, operator)
+	return err
+}
@@ -432,3 +432,33 @@ func copyOne(collection string) (*mongo.Collection, error) {
 	}
 	return tmp, nil
 }
+
+func findDistinct(collection string, field string, filter bson.M) ([]interface{}, error) {
+	if len(collection) < 1 {
+		return nil, errors.New("the collection is empty")
+	}
+	c := noSql.Collection(collection)
+	if c == nil {
+		return nil, errors.New("can not found the collection of" + collection)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	defer cancel()
+	return c.Distinct(ctx, field, filter)
+}
+
+func updateMany(collection string, filter bson.M, data bson.M) (int64, error) {
+	if len(collection) < 1 {
+		return 0, errors.New("the collection is empty")
+	}
+	c := noSql.Collection(collection)
+	if c == nil {
+		return 0, errors.New("can not found the collection of" + collection)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeOut)
+	defer cancel()
+	result, err := c.UpdateMany(ctx, filter, bson.M{"$set": data})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
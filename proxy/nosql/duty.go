@@ -0,0 +1,62 @@
+package nosql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Duty 班级某天的值日学生
+type Duty struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	ID          uint64             `json:"id" bson:"id"`
+	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
+	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Creator     string             `json:"creator" bson:"creator"`
+	Operator    string             `json:"operator" bson:"operator"`
+
+	School   string    `json:"school" bson:"school"`
+	Class    string    `json:"class" bson:"class"`
+	Term     string    `json:"term" bson:"term"`
+	Date     time.Time `json:"date" bson:"date"`
+	Students []string  `json:"students" bson:"students"`
+}
+
+func CreateDuty(info *Duty) error {
+	_, err := insertOne(TableDuty, info)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func GetDutyNextID() uint64 {
+	num, _ := getSequenceNext(TableDuty)
+	return num
+}
+
+func GetDutiesByClass(class, term string) ([]*Duty, error) {
+	var items = make([]*Duty, 0, 30)
+	msg := bson.M{"class": class, "term": term, "deleteAt": new(time.Time)}
+	cursor, err1 := findMany(TableDuty, msg, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		var node = new(Duty)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
+
+func RemoveDuty(uid, operator string) error {
+	_, err := removeOne(TableDuty, uid, operator)
+	return err
+}
@@ -0,0 +1,80 @@
+package nosql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Employment 老师在学校的任职记录，离职时间为空表示仍在职
+type Employment struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	ID          uint64             `json:"id" bson:"id"`
+	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
+	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Creator     string             `json:"creator" bson:"creator"`
+	Operator    string             `json:"operator" bson:"operator"`
+
+	School   string    `json:"school" bson:"school"`
+	Teacher  string    `json:"teacher" bson:"teacher"`
+	Position string    `json:"position" bson:"position"`
+	Join     time.Time `json:"join" bson:"join"`
+	Leave    time.Time `json:"leave" bson:"leave"`
+	Remark   string    `json:"remark" bson:"remark"`
+	// Inferred 由迁移根据老师的离职记录补录，时间不可靠
+	Inferred bool `json:"inferred" bson:"inferred"`
+}
+
+func CreateEmployment(info *Employment) error {
+	_, err := insertOne(TableEmploy, info)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func GetEmploymentNextID() uint64 {
+	num, _ := getSequenceNext(TableEmploy)
+	return num
+}
+
+func GetEmploymentsBySchool(school string) ([]*Employment, error) {
+	msg := bson.M{"school": school, "deleteAt": new(time.Time)}
+	return getEmployments(msg)
+}
+
+func GetEmploymentsByTeacher(teacher string) ([]*Employment, error) {
+	msg := bson.M{"teacher": teacher, "deleteAt": new(time.Time)}
+	return getEmployments(msg)
+}
+
+func GetOpenEmployments(school, teacher string) ([]*Employment, error) {
+	msg := bson.M{"school": school, "teacher": teacher, "leave": new(time.Time), "deleteAt": new(time.Time)}
+	return getEmployments(msg)
+}
+
+func getEmployments(msg bson.M) ([]*Employment, error) {
+	var items = make([]*Employment, 0, 10)
+	cursor, err1 := findMany(TableEmploy, msg, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		var node = new(Employment)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
+
+func UpdateEmploymentLeave(uid, remark, operator string, leave time.Time) error {
+	msg := bson.M{"leave": leave, "remark": remark, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableEmploy, uid, msg)
+	return err
+}
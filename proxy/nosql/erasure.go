@@ -0,0 +1,71 @@
+package nosql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type Erasure struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	ID          uint64             `json:"id" bson:"id"`
+	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
+	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Creator     string             `json:"creator" bson:"creator"`
+	Operator    string             `json:"operator" bson:"operator"`
+
+	School string `json:"school" bson:"school"`
+	Type   uint8  `json:"type" bson:"type"`
+	// 被匿名化的对象，学生UID或者监护人手机号的摘要
+	Target string `json:"target" bson:"target"`
+	// 已清除的数据范围
+	Scopes    []string `json:"scopes" bson:"scopes"`
+	Signature string   `json:"signature" bson:"signature"`
+}
+
+func CreateErasure(info *Erasure) error {
+	_, err := insertOne(TableErasure, info)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func GetErasureNextID() uint64 {
+	num, _ := getSequenceNext(TableErasure)
+	return num
+}
+
+func GetErasure(uid string) (*Erasure, error) {
+	result, err := findOne(TableErasure, uid)
+	if err != nil {
+		return nil, err
+	}
+	model := new(Erasure)
+	err1 := result.Decode(model)
+	if err1 != nil {
+		return nil, err1
+	}
+	return model, nil
+}
+
+func GetErasuresBySchool(school string) ([]*Erasure, error) {
+	var items = make([]*Erasure, 0, 10)
+	msg := bson.M{"school": school, "deleteAt": new(time.Time)}
+	cursor, err1 := findMany(TableErasure, msg, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		var node = new(Erasure)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
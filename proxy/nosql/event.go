@@ -0,0 +1,65 @@
+package nosql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// StudentEvent 学生的履历事件
+type StudentEvent struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	ID          uint64             `json:"id" bson:"id"`
+	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
+	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Creator     string             `json:"creator" bson:"creator"`
+	Operator    string             `json:"operator" bson:"operator"`
+
+	School  string `json:"school" bson:"school"`
+	Student string `json:"student" bson:"student"`
+	Type    uint8  `json:"type" bson:"type"`
+	Class   string `json:"class" bson:"class"`
+	From    string `json:"from" bson:"from"`
+	To      string `json:"to" bson:"to"`
+	Remark  string `json:"remark" bson:"remark"`
+}
+
+func CreateStudentEvent(info *StudentEvent) error {
+	_, err := insertOne(TableEvent, info)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func GetStudentEventNextID() uint64 {
+	num, _ := getSequenceNext(TableEvent)
+	return num
+}
+
+func GetStudentEvents(student string) ([]*StudentEvent, error) {
+	var items = make([]*StudentEvent, 0, 10)
+	msg := bson.M{"student": student, "deleteAt": new(time.Time)}
+	cursor, err1 := findMany(TableEvent, msg, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		var node = new(StudentEvent)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
+
+// AnonymizeStudentEvents 匿名化时清除指定类型履历事件中的变更内容以及备注
+func AnonymizeStudentEvents(student, operator string, types []uint8) (int64, error) {
+	msg := bson.M{"student": student, "type": bson.M{"$in": types}}
+	return updateMany(TableEvent, msg, bson.M{"from": "", "to": "", "remark": "", "operator": operator, "updatedAt": time.Now()})
+}
@@ -0,0 +1,106 @@
+package nosql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type Exam struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	ID          uint64             `json:"id" bson:"id"`
+	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
+	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Creator     string             `json:"creator" bson:"creator"`
+	Operator    string             `json:"operator" bson:"operator"`
+
+	Name   string `json:"name" bson:"name"`
+	School string `json:"school" bson:"school"`
+	// 学期
+	Term  string `json:"term" bson:"term"`
+	Grade uint8  `json:"grade" bson:"grade"`
+	// 学科UID
+	Subject string `json:"subject" bson:"subject"`
+	// 满分
+	Full float32   `json:"full" bson:"full"`
+	Date time.Time `json:"date" bson:"date"`
+}
+
+func CreateExam(info *Exam) error {
+	_, err := insertOne(TableExam, info)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func GetExamNextID() uint64 {
+	num, _ := getSequenceNext(TableExam)
+	return num
+}
+
+func GetExam(uid string) (*Exam, error) {
+	result, err := findOne(TableExam, uid)
+	if err != nil {
+		return nil, err
+	}
+	model := new(Exam)
+	err1 := result.Decode(model)
+	if err1 != nil {
+		return nil, err1
+	}
+	return model, nil
+}
+
+func GetExamsBySchool(school string) ([]*Exam, error) {
+	msg := bson.M{"school": school, "deleteAt": new(time.Time)}
+	return getExams(msg)
+}
+
+func GetExamsByTerm(school, term string) ([]*Exam, error) {
+	msg := bson.M{"school": school, "term": term, "deleteAt": new(time.Time)}
+	return getExams(msg)
+}
+
+func GetExamsByList(list []string) ([]*Exam, error) {
+	ids := make(bson.A, 0, len(list))
+	for _, uid := range list {
+		objID, err := primitive.ObjectIDFromHex(uid)
+		if err == nil {
+			ids = append(ids, objID)
+		}
+	}
+	msg := bson.M{"_id": bson.M{"$in": ids}, "deleteAt": new(time.Time)}
+	return getExams(msg)
+}
+
+func getExams(msg bson.M) ([]*Exam, error) {
+	var items = make([]*Exam, 0, 10)
+	cursor, err1 := findMany(TableExam, msg, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		var node = new(Exam)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
+
+func UpdateExamBase(uid, name, term, operator string, full float32, date time.Time) error {
+	msg := bson.M{"name": name, "term": term, "full": full, "date": date, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableExam, uid, msg)
+	return err
+}
+
+func RemoveExam(uid, operator string) error {
+	_, err := removeOne(TableExam, uid, operator)
+	return err
+}
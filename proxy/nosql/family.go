@@ -0,0 +1,202 @@
+package nosql
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type Family struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	ID          uint64             `json:"id" bson:"id"`
+	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
+	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Creator     string             `json:"creator" bson:"creator"`
+	Operator    string             `json:"operator" bson:"operator"`
+
+	Name   string `json:"name" bson:"name"`
+	Status uint8  `json:"status" bson:"status"`
+	// 家庭成员（学生UID）
+	Students []string `json:"students" bson:"students"`
+	// 共同的监护人手机号
+	Phones []string `json:"phones" bson:"phones"`
+	// 共同的身份证号
+	Cards []string `json:"cards" bson:"cards"`
+	// 被移出的学生，重新推断时不再加入
+	Removed []string `json:"removed" bson:"removed"`
+	// 加密字段所用的密钥版本以及盲索引
+	Secret     uint32   `json:"-" bson:"secret"`
+	IndexKey   string   `json:"-" bson:"idxKey"`
+	PhoneIndex []string `json:"-" bson:"phoneIdx"`
+	CardIndex  []string `json:"-" bson:"cardIdx"`
+	// 有无法解密的字段，字段中保留的是原有的密文
+	Locked bool `json:"-" bson:"-"`
+}
+
+type familyAlias Family
+
+// MarshalBSON 写入数据库时加密监护人手机号以及身份证号
+func (mine *Family) MarshalBSON() ([]byte, error) {
+	tmp := familyAlias(*mine)
+	tmp.Secret = secretCtx.current
+	tmp.IndexKey = secretCtx.indexKey
+	tmp.Phones, tmp.PhoneIndex = encryptList(mine.Phones)
+	tmp.Cards, tmp.CardIndex = encryptList(mine.Cards)
+	return bson.Marshal(&tmp)
+}
+
+func (mine *Family) UnmarshalBSON(data []byte) error {
+	tmp := new(familyAlias)
+	err := bson.Unmarshal(data, tmp)
+	if err != nil {
+		return err
+	}
+	locked := false
+	tmp.Phones = decryptList(tmp.Phones, &locked)
+	tmp.Cards = decryptList(tmp.Cards, &locked)
+	tmp.Locked = locked
+	*mine = Family(*tmp)
+	return nil
+}
+
+func CreateFamily(info *Family) error {
+	_, err := insertOne(TableFamily, info)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func GetFamilyNextID() uint64 {
+	num, _ := getSequenceNext(TableFamily)
+	return num
+}
+
+func GetFamily(uid string) (*Family, error) {
+	result, err := findOne(TableFamily, uid)
+	if err != nil {
+		return nil, err
+	}
+	model := new(Family)
+	err1 := result.Decode(model)
+	if err1 != nil {
+		return nil, err1
+	}
+	return model, nil
+}
+
+func GetFamilyByStudent(student string) (*Family, error) {
+	msg := bson.M{"students": student, "deleteAt": new(time.Time)}
+	result, err := findOneBy(TableFamily, msg)
+	if err != nil {
+		return nil, err
+	}
+	model := new(Family)
+	err1 := result.Decode(model)
+	if err1 != nil {
+		return nil, err1
+	}
+	return model, nil
+}
+
+func GetFamiliesByPhone(phone string) ([]*Family, error) {
+	msg := bson.M{"deleteAt": new(time.Time), "$or": indexFilter("phoneIdx", "phones", phone)}
+	return getFamilies(msg)
+}
+
+// GetFamiliesBySecret 获取还没有使用当前密钥加密或者建立索引的家庭
+func GetFamiliesBySecret() ([]*Family, error) {
+	return getFamilies(secretFilter())
+}
+
+func getFamilies(msg bson.M) ([]*Family, error) {
+	var items = make([]*Family, 0, 2)
+	cursor, err1 := findMany(TableFamily, msg, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		var node = new(Family)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
+
+func GetFamiliesByStatus(st uint8) ([]*Family, error) {
+	var items = make([]*Family, 0, 10)
+	msg := bson.M{"status": st, "deleteAt": new(time.Time)}
+	cursor, err1 := findMany(TableFamily, msg, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		var node = new(Family)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
+
+func UpdateFamilyStatus(uid, operator string, st uint8) error {
+	msg := bson.M{"status": st, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableFamily, uid, msg)
+	return err
+}
+
+func UpdateFamilyMembers(uid, operator string, st uint8, students, phones, cards []string) error {
+	phones, phoneIdx := encryptList(phones)
+	cards, cardIdx := encryptList(cards)
+	msg := bson.M{"status": st, "students": students, "phones": phones, "phoneIdx": phoneIdx, "cards": cards, "cardIdx": cardIdx,
+		"secret": secretCtx.current, "idxKey": secretCtx.indexKey, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableFamily, uid, msg)
+	return err
+}
+
+func UpdateFamilyRemoved(uid, operator string, removed []string) error {
+	msg := bson.M{"removed": removed, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableFamily, uid, msg)
+	return err
+}
+
+// UpdateFamilySecret 使用当前密钥重新加密并建立盲索引，有无法解密的字段时跳过
+func UpdateFamilySecret(info *Family) error {
+	if info.Locked {
+		return ErrSecretLocked
+	}
+	phones, phoneIdx := encryptList(info.Phones)
+	cards, cardIdx := encryptList(info.Cards)
+	msg := bson.M{"phones": phones, "phoneIdx": phoneIdx, "cards": cards, "cardIdx": cardIdx,
+		"secret": secretCtx.current, "idxKey": secretCtx.indexKey}
+	_, err := updateOne(TableFamily, info.UID.Hex(), msg)
+	return err
+}
+
+func RemoveFamily(uid, operator string) error {
+	_, err := removeOne(TableFamily, uid, operator)
+	return err
+}
+
+func SubtractFamilyStudent(uid, student string) error {
+	if len(uid) < 1 {
+		return errors.New("the uid is empty")
+	}
+	msg := bson.M{"students": student}
+	_, err := removeElement(TableFamily, uid, msg)
+	if err != nil {
+		return err
+	}
+	_, err = appendElement(TableFamily, uid, bson.M{"removed": student})
+	return err
+}
@@ -0,0 +1,181 @@
+package nosql
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.school/proxy"
+	"time"
+)
+
+type Leave struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	ID          uint64             `json:"id" bson:"id"`
+	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
+	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Creator     string             `json:"creator" bson:"creator"`
+	Operator    string             `json:"operator" bson:"operator"`
+
+	School  string `json:"school" bson:"school"`
+	Class   string `json:"class" bson:"class"`
+	Student string `json:"student" bson:"student"`
+	// 申请人，监护人手机号或者实体
+	Applicant string    `json:"applicant" bson:"applicant"`
+	Reason    string    `json:"reason" bson:"reason"`
+	From      time.Time `json:"from" bson:"from"`
+	To        time.Time `json:"to" bson:"to"`
+	Status    uint8     `json:"status" bson:"status"`
+	// 审批人
+	Approver  string                `json:"approver" bson:"approver"`
+	Histories []proxy.StatusHistory `json:"histories" bson:"histories"`
+	// 加密字段所用的密钥版本以及申请人的盲索引
+	Secret         uint32 `json:"-" bson:"secret"`
+	IndexKey       string `json:"-" bson:"idxKey"`
+	ApplicantIndex string `json:"-" bson:"applicantIdx"`
+	// 有无法解密的字段，字段中保留的是原有的密文
+	Locked bool `json:"-" bson:"-"`
+}
+
+type leaveAlias Leave
+
+// MarshalBSON 写入数据库时加密申请人、请假原因以及审批记录
+func (mine *Leave) MarshalBSON() ([]byte, error) {
+	tmp := leaveAlias(*mine)
+	tmp.Secret = secretCtx.current
+	tmp.IndexKey = secretCtx.indexKey
+	tmp.Creator = encryptText(mine.Creator)
+	tmp.Operator = encryptText(mine.Operator)
+	tmp.Applicant = encryptText(mine.Applicant)
+	tmp.ApplicantIndex = blindIndex(mine.Applicant)
+	tmp.Reason = encryptText(mine.Reason)
+	tmp.Histories = encryptHistories(mine.Histories)
+	return bson.Marshal(&tmp)
+}
+
+func (mine *Leave) UnmarshalBSON(data []byte) error {
+	tmp := new(leaveAlias)
+	err := bson.Unmarshal(data, tmp)
+	if err != nil {
+		return err
+	}
+	locked := false
+	tmp.Creator = openText(tmp.Creator, &locked)
+	tmp.Operator = openText(tmp.Operator, &locked)
+	tmp.Applicant = openText(tmp.Applicant, &locked)
+	tmp.Reason = openText(tmp.Reason, &locked)
+	tmp.Histories = decryptHistories(tmp.Histories, &locked)
+	tmp.Locked = locked
+	*mine = Leave(*tmp)
+	return nil
+}
+
+func CreateLeave(info *Leave) error {
+	_, err := insertOne(TableLeave, info)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func GetLeaveNextID() uint64 {
+	num, _ := getSequenceNext(TableLeave)
+	return num
+}
+
+func GetLeave(uid string) (*Leave, error) {
+	result, err := findOne(TableLeave, uid)
+	if err != nil {
+		return nil, err
+	}
+	model := new(Leave)
+	err1 := result.Decode(model)
+	if err1 != nil {
+		return nil, err1
+	}
+	return model, nil
+}
+
+func GetLeavesByStudent(student string) ([]*Leave, error) {
+	msg := bson.M{"student": student, "deleteAt": new(time.Time)}
+	return getLeaves(msg)
+}
+
+func GetLeavesByClass(class string) ([]*Leave, error) {
+	msg := bson.M{"class": class, "deleteAt": new(time.Time)}
+	return getLeaves(msg)
+}
+
+func GetLeavesByClassStatus(class string, st uint8) ([]*Leave, error) {
+	msg := bson.M{"class": class, "status": st, "deleteAt": new(time.Time)}
+	return getLeaves(msg)
+}
+
+func GetLeavesByApplicant(applicant string) ([]*Leave, error) {
+	msg := bson.M{"deleteAt": new(time.Time), "$or": indexFilter("applicantIdx", "applicant", applicant)}
+	return getLeaves(msg)
+}
+
+// GetLeavesBySecret 获取还没有使用当前密钥加密或者建立索引的请假
+func GetLeavesBySecret() ([]*Leave, error) {
+	return getLeaves(secretFilter())
+}
+
+func getLeaves(msg bson.M) ([]*Leave, error) {
+	var items = make([]*Leave, 0, 10)
+	cursor, err1 := findMany(TableLeave, msg, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		var node = new(Leave)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
+
+func UpdateLeaveStatus(uid, operator, approver string, st uint8) error {
+	msg := bson.M{"status": st, "approver": approver, "operator": encryptText(operator), "updatedAt": time.Now()}
+	_, err := updateOne(TableLeave, uid, msg)
+	return err
+}
+
+// AnonymizeLeave 匿名化时清除申请人、请假原因、创建人以及审批记录中的操作人和备注
+func AnonymizeLeave(uid, operator string) error {
+	msg := bson.M{"creator": "", "applicant": "", "applicantIdx": "", "reason": "",
+		"histories.$[].operator": "", "histories.$[].remark": "", "operator": encryptText(operator), "updatedAt": time.Now()}
+	_, err := updateOne(TableLeave, uid, msg)
+	return err
+}
+
+func AppendLeaveHistory(uid string, info *proxy.StatusHistory) error {
+	if len(uid) < 1 {
+		return errors.New("the uid is empty")
+	}
+	msg := bson.M{"histories": encryptHistories([]proxy.StatusHistory{*info})[0]}
+	_, err := appendElement(TableLeave, uid, msg)
+	return err
+}
+
+// UpdateLeaveSecret 使用当前密钥重新加密并建立盲索引，有无法解密的字段时跳过
+func UpdateLeaveSecret(info *Leave) error {
+	if info.Locked {
+		return ErrSecretLocked
+	}
+	msg := bson.M{"creator": encryptText(info.Creator), "operator": encryptText(info.Operator), "applicant": encryptText(info.Applicant),
+		"applicantIdx": blindIndex(info.Applicant), "reason": encryptText(info.Reason),
+		"histories": encryptHistories(info.Histories), "secret": secretCtx.current, "idxKey": secretCtx.indexKey}
+	_, err := updateOne(TableLeave, info.UID.Hex(), msg)
+	return err
+}
+
+func RemoveLeave(uid, operator string) error {
+	_, err := removeOne(TableLeave, uid, operator)
+	return err
+}
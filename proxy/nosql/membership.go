@@ -0,0 +1,85 @@
+package nosql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Membership 学生在班级的一段在籍时间，离开时间为空表示仍在班级
+type Membership struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	ID          uint64             `json:"id" bson:"id"`
+	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
+	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Creator     string             `json:"creator" bson:"creator"`
+	Operator    string             `json:"operator" bson:"operator"`
+
+	School  string    `json:"school" bson:"school"`
+	Class   string    `json:"class" bson:"class"`
+	Student string    `json:"student" bson:"student"`
+	Join    time.Time `json:"join" bson:"join"`
+	Leave   time.Time `json:"leave" bson:"leave"`
+	Remark  string    `json:"remark" bson:"remark"`
+	// Inferred 由迁移根据旧的班级成员补录，时间不可靠
+	Inferred bool `json:"inferred" bson:"inferred"`
+}
+
+func CreateMembership(info *Membership) error {
+	_, err := insertOne(TableMember, info)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func GetMembershipNextID() uint64 {
+	num, _ := getSequenceNext(TableMember)
+	return num
+}
+
+func GetMembershipsByClass(class string) ([]*Membership, error) {
+	msg := bson.M{"class": class, "deleteAt": new(time.Time)}
+	return getMemberships(msg)
+}
+
+func GetMembershipsBySchool(school string) ([]*Membership, error) {
+	msg := bson.M{"school": school, "deleteAt": new(time.Time)}
+	return getMemberships(msg)
+}
+
+func GetMembershipsByStudent(student string) ([]*Membership, error) {
+	msg := bson.M{"student": student, "deleteAt": new(time.Time)}
+	return getMemberships(msg)
+}
+
+func GetOpenMemberships(class, student string) ([]*Membership, error) {
+	msg := bson.M{"class": class, "student": student, "leave": new(time.Time), "deleteAt": new(time.Time)}
+	return getMemberships(msg)
+}
+
+func getMemberships(msg bson.M) ([]*Membership, error) {
+	var items = make([]*Membership, 0, 50)
+	cursor, err1 := findMany(TableMember, msg, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		var node = new(Membership)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
+
+func UpdateMembershipLeave(uid, remark, operator string, leave time.Time) error {
+	msg := bson.M{"leave": leave, "remark": remark, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableMember, uid, msg)
+	return err
+}
@@ -0,0 +1,76 @@
+package nosql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Officer 学生在某学期担任的班干部
+type Officer struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	ID          uint64             `json:"id" bson:"id"`
+	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
+	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Creator     string             `json:"creator" bson:"creator"`
+	Operator    string             `json:"operator" bson:"operator"`
+
+	School  string `json:"school" bson:"school"`
+	Class   string `json:"class" bson:"class"`
+	Student string `json:"student" bson:"student"`
+	// 班干部类别UID
+	Kind string `json:"kind" bson:"kind"`
+	Term string `json:"term" bson:"term"`
+}
+
+func CreateOfficer(info *Officer) error {
+	_, err := insertOne(TableOfficer, info)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func GetOfficerNextID() uint64 {
+	num, _ := getSequenceNext(TableOfficer)
+	return num
+}
+
+func GetOfficer(uid string) (*Officer, error) {
+	result, err := findOne(TableOfficer, uid)
+	if err != nil {
+		return nil, err
+	}
+	model := new(Officer)
+	err1 := result.Decode(model)
+	if err1 != nil {
+		return nil, err1
+	}
+	return model, nil
+}
+
+func GetOfficersByClass(class, term string) ([]*Officer, error) {
+	var items = make([]*Officer, 0, 10)
+	msg := bson.M{"class": class, "term": term, "deleteAt": new(time.Time)}
+	cursor, err1 := findMany(TableOfficer, msg, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		var node = new(Officer)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
+
+func RemoveOfficer(uid, operator string) error {
+	_, err := removeOne(TableOfficer, uid, operator)
+	return err
+}
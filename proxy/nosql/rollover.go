@@ -0,0 +1,58 @@
+package nosql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type Rollover struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	ID          uint64             `json:"id" bson:"id"`
+	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
+	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Creator     string             `json:"creator" bson:"creator"`
+	Operator    string             `json:"operator" bson:"operator"`
+
+	School string `json:"school" bson:"school"`
+	Year   uint16 `json:"year" bson:"year"`
+	// 新建的起始年级班级
+	Created []string `json:"created" bson:"created"`
+	// 归档的毕业班级
+	Archived  []string `json:"archived" bson:"archived"`
+	Graduates []string `json:"graduates" bson:"graduates"`
+}
+
+func CreateRollover(info *Rollover) error {
+	_, err := insertOne(TableRollover, info)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func GetRolloverNextID() uint64 {
+	num, _ := getSequenceNext(TableRollover)
+	return num
+}
+
+func GetRolloversBySchool(school string) ([]*Rollover, error) {
+	var items = make([]*Rollover, 0, 10)
+	msg := bson.M{"school": school, "deleteAt": new(time.Time)}
+	cursor, err1 := findMany(TableRollover, msg, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		var node = new(Rollover)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
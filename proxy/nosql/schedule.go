@@ -169,6 +169,25 @@ func UpdateScheduleUsers(uid, operator string, users []string) error {
 	return err
 }
 
+func GetSchedulesByUser(user string) ([]*Schedule, error) {
+	var items = make([]*Schedule, 0, 10)
+	msg := bson.M{"users": user, "deleteAt": new(time.Time)}
+	cursor, err1 := findMany(TableSchedules, msg, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		var node = new(Schedule)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
+
 func AppendScheduleUser(uid, user string) error {
 	if len(uid) < 1 {
 		return errors.New("the uid is empty")
@@ -30,6 +30,15 @@ type School struct {
 	Honors []proxy.HonorInfo `json:"honors" bson:"honors"`
 	Respects []proxy.HonorInfo `json:"respects" bson:"respects"`
 	Subjects []proxy.SubjectInfo `json:"subjects" bson:"subjects"`
+	Tags []proxy.TagInfo `json:"tags" bson:"tags"`
+	Behaviors []proxy.BehaviorInfo `json:"behaviors" bson:"behaviors"`
+	// 当前计分的学期，切换学期即重新计分
+	ConductTerm string `json:"conductTerm" bson:"conductTerm"`
+	Capacities []proxy.CapacityInfo `json:"capacities" bson:"capacities"`
+	Rollover proxy.RolloverInfo `json:"rollover" bson:"rollover"`
+	Naming proxy.NamingInfo `json:"naming" bson:"naming"`
+	Officers []proxy.OfficerInfo `json:"officers" bson:"officers"`
+	Workload proxy.WorkloadInfo `json:"workload" bson:"workload"`
 }
 
 func CreateSchool(info *School) error {
@@ -55,6 +64,21 @@ func GetSchoolSubjectNextID() uint64 {
 	return num
 }
 
+func GetSchoolTagNextID() uint64 {
+	num, _ := getSequenceNext("school_tag")
+	return num
+}
+
+func GetSchoolOfficerNextID() uint64 {
+	num, _ := getSequenceNext("school_officer")
+	return num
+}
+
+func GetSchoolBehaviorNextID() uint64 {
+	num, _ := getSequenceNext("school_behavior")
+	return num
+}
+
 func GetSchool(uid string) (*School, error) {
 	result, err := findOne(TableSchool, uid)
 	if err != nil {
@@ -282,3 +306,105 @@ func SubtractSchoolSubject(uid string, subject string) error {
 	_, err := removeElement(TableSchool, uid, msg)
 	return err
 }
+
+func UpdateSchoolTags(uid, operator string, list []proxy.TagInfo) error {
+	msg := bson.M{"tags": list, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableSchool, uid, msg)
+	return err
+}
+
+func AppendSchoolTag(uid string, tag proxy.TagInfo) error {
+	if len(uid) < 1 {
+		return errors.New("the uid is empty")
+	}
+	msg := bson.M{"tags": tag}
+	_, err := appendElement(TableSchool, uid, msg)
+	return err
+}
+
+func SubtractSchoolTag(uid string, tag string) error {
+	if len(uid) < 1 {
+		return errors.New("the uid is empty")
+	}
+	msg := bson.M{"tags": bson.M{"uid": tag}}
+	_, err := removeElement(TableSchool, uid, msg)
+	return err
+}
+
+func UpdateSchoolBehaviors(uid, operator string, list []proxy.BehaviorInfo) error {
+	msg := bson.M{"behaviors": list, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableSchool, uid, msg)
+	return err
+}
+
+func AppendSchoolBehavior(uid string, info proxy.BehaviorInfo) error {
+	if len(uid) < 1 {
+		return errors.New("the uid is empty")
+	}
+	msg := bson.M{"behaviors": info}
+	_, err := appendElement(TableSchool, uid, msg)
+	return err
+}
+
+func SubtractSchoolBehavior(uid string, behavior string) error {
+	if len(uid) < 1 {
+		return errors.New("the uid is empty")
+	}
+	msg := bson.M{"behaviors": bson.M{"uid": behavior}}
+	_, err := removeElement(TableSchool, uid, msg)
+	return err
+}
+
+func UpdateSchoolCapacities(uid, operator string, list []proxy.CapacityInfo) error {
+	msg := bson.M{"capacities": list, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableSchool, uid, msg)
+	return err
+}
+
+func UpdateSchoolRollover(uid, operator string, info proxy.RolloverInfo) error {
+	msg := bson.M{"rollover": info, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableSchool, uid, msg)
+	return err
+}
+
+func UpdateSchoolNaming(uid, operator string, info proxy.NamingInfo) error {
+	msg := bson.M{"naming": info, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableSchool, uid, msg)
+	return err
+}
+
+func UpdateSchoolWorkload(uid, operator string, info proxy.WorkloadInfo) error {
+	msg := bson.M{"workload": info, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableSchool, uid, msg)
+	return err
+}
+
+func UpdateSchoolOfficers(uid, operator string, list []proxy.OfficerInfo) error {
+	msg := bson.M{"officers": list, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableSchool, uid, msg)
+	return err
+}
+
+func AppendSchoolOfficer(uid string, info proxy.OfficerInfo) error {
+	if len(uid) < 1 {
+		return errors.New("the uid is empty")
+	}
+	msg := bson.M{"officers": info}
+	_, err := appendElement(TableSchool, uid, msg)
+	return err
+}
+
+func SubtractSchoolOfficer(uid string, officer string) error {
+	if len(uid) < 1 {
+		return errors.New("the uid is empty")
+	}
+	msg := bson.M{"officers": bson.M{"uid": officer}}
+	_, err := removeElement(TableSchool, uid, msg)
+	return err
+}
+
+func UpdateSchoolConductTerm(uid, operator, term string) error {
+	msg := bson.M{"conductTerm": term, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableSchool, uid, msg)
+	return err
+}
@@ -0,0 +1,96 @@
+package nosql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type Score struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	ID          uint64             `json:"id" bson:"id"`
+	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
+	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Creator     string             `json:"creator" bson:"creator"`
+	Operator    string             `json:"operator" bson:"operator"`
+
+	School  string  `json:"school" bson:"school"`
+	Exam    string  `json:"exam" bson:"exam"`
+	Class   string  `json:"class" bson:"class"`
+	Student string  `json:"student" bson:"student"`
+	Value   float32 `json:"value" bson:"value"`
+	Remark  string  `json:"remark" bson:"remark"`
+}
+
+func CreateScore(info *Score) error {
+	_, err := insertOne(TableScore, info)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func GetScoreNextID() uint64 {
+	num, _ := getSequenceNext(TableScore)
+	return num
+}
+
+func GetScoreBy(exam, student string) (*Score, error) {
+	msg := bson.M{"exam": exam, "student": student, "deleteAt": new(time.Time)}
+	result, err := findOneBy(TableScore, msg)
+	if err != nil {
+		return nil, err
+	}
+	model := new(Score)
+	err1 := result.Decode(model)
+	if err1 != nil {
+		return nil, err1
+	}
+	return model, nil
+}
+
+func GetScoresByExam(exam string) ([]*Score, error) {
+	msg := bson.M{"exam": exam, "deleteAt": new(time.Time)}
+	return getScores(msg)
+}
+
+func GetScoresByClass(exam, class string) ([]*Score, error) {
+	msg := bson.M{"exam": exam, "class": class, "deleteAt": new(time.Time)}
+	return getScores(msg)
+}
+
+func GetScoresByStudent(student string) ([]*Score, error) {
+	msg := bson.M{"student": student, "deleteAt": new(time.Time)}
+	return getScores(msg)
+}
+
+func GetScoresByExams(list []string) ([]*Score, error) {
+	msg := bson.M{"exam": bson.M{"$in": list}, "deleteAt": new(time.Time)}
+	return getScores(msg)
+}
+
+func getScores(msg bson.M) ([]*Score, error) {
+	var items = make([]*Score, 0, 50)
+	cursor, err1 := findMany(TableScore, msg, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		var node = new(Score)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
+
+func UpdateScoreValue(uid, class, remark, operator string, value float32) error {
+	msg := bson.M{"value": value, "class": class, "remark": remark, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableScore, uid, msg)
+	return err
+}
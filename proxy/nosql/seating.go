@@ -0,0 +1,87 @@
+package nosql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.school/proxy"
+	"time"
+)
+
+// Seating 班级某学期的座位表
+type Seating struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	ID          uint64             `json:"id" bson:"id"`
+	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
+	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Creator     string             `json:"creator" bson:"creator"`
+	Operator    string             `json:"operator" bson:"operator"`
+
+	School  string `json:"school" bson:"school"`
+	Class   string `json:"class" bson:"class"`
+	Term    string `json:"term" bson:"term"`
+	Rows    uint8  `json:"rows" bson:"rows"`
+	Columns uint8  `json:"columns" bson:"columns"`
+	// 不能使用的座位，格式为"行-列"
+	Disabled []string         `json:"disabled" bson:"disabled"`
+	Seats    []proxy.SeatInfo `json:"seats" bson:"seats"`
+}
+
+func CreateSeating(info *Seating) error {
+	_, err := insertOne(TableSeating, info)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func GetSeatingNextID() uint64 {
+	num, _ := getSequenceNext(TableSeating)
+	return num
+}
+
+func GetSeatingBy(class, term string) (*Seating, error) {
+	msg := bson.M{"class": class, "term": term, "deleteAt": new(time.Time)}
+	result, err := findOneBy(TableSeating, msg)
+	if err != nil {
+		return nil, err
+	}
+	model := new(Seating)
+	err1 := result.Decode(model)
+	if err1 != nil {
+		return nil, err1
+	}
+	return model, nil
+}
+
+func GetSeatingsByClass(class string) ([]*Seating, error) {
+	var items = make([]*Seating, 0, 10)
+	msg := bson.M{"class": class, "deleteAt": new(time.Time)}
+	cursor, err1 := findMany(TableSeating, msg, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		var node = new(Seating)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
+
+func UpdateSeatingLayout(uid, operator string, rows, columns uint8, disabled []string, seats []proxy.SeatInfo) error {
+	msg := bson.M{"rows": rows, "columns": columns, "disabled": disabled, "seats": seats, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableSeating, uid, msg)
+	return err
+}
+
+func UpdateSeatingSeats(uid, operator string, seats []proxy.SeatInfo) error {
+	msg := bson.M{"seats": seats, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableSeating, uid, msg)
+	return err
+}
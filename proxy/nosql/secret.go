@@ -0,0 +1,302 @@
+package nosql
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"io"
+	"omo.msa.school/proxy"
+	"strconv"
+	"strings"
+)
+
+// 加密后的字段格式为 enc:版本:base64(nonce+密文)
+const secretPrefix = "enc:"
+
+// ErrSecretLocked 数据中有无法解密的字段，为了不覆盖原有的密文拒绝写入
+var ErrSecretLocked = errors.New("the secret field can not decrypt")
+
+var secretCtx = struct {
+	current uint32
+	index   []byte
+	// 当前盲索引密钥的指纹，用于找出还没有重建索引的数据
+	indexKey string
+	// 轮换前的盲索引密钥，重建完成之前查询时同时匹配
+	olds    [][]byte
+	ciphers map[uint32]cipher.AEAD
+}{ciphers: make(map[uint32]cipher.AEAD)}
+
+// SetSecret 设置字段加密的密钥，current为0时只建立盲索引不加密，olds为轮换前的盲索引密钥
+func SetSecret(current uint32, index string, olds []string, keys map[uint32]string) error {
+	ciphers := make(map[uint32]cipher.AEAD, len(keys))
+	for version, secret := range keys {
+		if version < 1 || secret == "" {
+			return errors.New("the secret key is error")
+		}
+		sum := sha256.Sum256([]byte(secret))
+		block, err := aes.NewCipher(sum[:])
+		if err != nil {
+			return err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return err
+		}
+		ciphers[version] = aead
+	}
+	if current > 0 {
+		if _, ok := ciphers[current]; !ok {
+			return errors.New("not found the current secret key")
+		}
+		if index == "" {
+			return errors.New("the secret index is empty")
+		}
+	}
+	arr := make([][]byte, 0, len(olds))
+	for _, old := range olds {
+		if old != "" && old != index {
+			arr = append(arr, []byte(old))
+		}
+	}
+	secretCtx.current = current
+	secretCtx.index = []byte(index)
+	secretCtx.indexKey = indexFingerprint(index)
+	secretCtx.olds = arr
+	secretCtx.ciphers = ciphers
+	return nil
+}
+
+func SecretEnabled() bool {
+	return secretCtx.current > 0
+}
+
+// HadSecretKey 判断某个版本的密钥是否已配置
+func HadSecretKey(version uint32) bool {
+	_, ok := secretCtx.ciphers[version]
+	return ok
+}
+
+func indexFingerprint(key string) string {
+	if key == "" {
+		return ""
+	}
+	// 盲索引的字段有变化时修改版本号，迁移时会重建所有数据的索引
+	sum := sha256.Sum256([]byte("index:2:" + key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// encryptText 已经是密文的字段原样返回，避免无法解密的旧密文被二次加密
+func encryptText(plain string) string {
+	if plain == "" || secretCtx.current < 1 || strings.HasPrefix(plain, secretPrefix) {
+		return plain
+	}
+	aead := secretCtx.ciphers[secretCtx.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return plain
+	}
+	data := aead.Seal(nonce, nonce, []byte(plain), nil)
+	return fmt.Sprintf("%s%d:%s", secretPrefix, secretCtx.current, base64.StdEncoding.EncodeToString(data))
+}
+
+// decryptText 兼容未加密的旧数据，密钥版本未配置或者密文损坏时返回错误
+func decryptText(text string) (string, error) {
+	if !strings.HasPrefix(text, secretPrefix) {
+		return text, nil
+	}
+	arr := strings.SplitN(strings.TrimPrefix(text, secretPrefix), ":", 2)
+	if len(arr) != 2 {
+		return "", errors.New("the secret format is error")
+	}
+	version, err := strconv.ParseUint(arr[0], 10, 32)
+	if err != nil {
+		return "", err
+	}
+	aead, ok := secretCtx.ciphers[uint32(version)]
+	if !ok {
+		return "", fmt.Errorf("not found the secret key of version %d", version)
+	}
+	data, err := base64.StdEncoding.DecodeString(arr[1])
+	if err != nil {
+		return "", err
+	}
+	if len(data) < aead.NonceSize() {
+		return "", errors.New("the secret data is too short")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// openText 解密失败时保留原有的密文并标记，写入时据此拒绝覆盖
+func openText(text string, locked *bool) string {
+	plain, err := decryptText(text)
+	if err != nil {
+		*locked = true
+		return text
+	}
+	return plain
+}
+
+func signIndex(key []byte, plain string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(plain))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// blindIndex 用于密文字段的精确匹配查询
+func blindIndex(plain string) string {
+	plain = strings.TrimSpace(plain)
+	if plain == "" || strings.HasPrefix(plain, secretPrefix) {
+		return ""
+	}
+	return signIndex(secretCtx.index, plain)
+}
+
+// blindIndexes 当前以及轮换前的盲索引，查询时都需要匹配
+func blindIndexes(plain string) []string {
+	plain = strings.TrimSpace(plain)
+	list := make([]string, 0, len(secretCtx.olds)+1)
+	if plain == "" {
+		return list
+	}
+	list = append(list, signIndex(secretCtx.index, plain))
+	for _, old := range secretCtx.olds {
+		list = append(list, signIndex(old, plain))
+	}
+	return list
+}
+
+// indexFilter 同时匹配盲索引和未迁移的明文
+func indexFilter(index, field, plain string) bson.A {
+	return bson.A{bson.M{index: bson.M{"$in": blindIndexes(plain)}}, bson.M{field: plain}}
+}
+
+// stampSecret 所有字段都使用当前密钥加密时才更新密钥版本和索引指纹，
+// 有原样写入的旧密文时保留原来的版本，迁移时会重新处理
+func stampSecret(msg bson.M, plains ...string) bson.M {
+	for _, plain := range plains {
+		if strings.HasPrefix(plain, secretPrefix) {
+			return msg
+		}
+	}
+	msg["secret"] = secretCtx.current
+	msg["idxKey"] = secretCtx.indexKey
+	return msg
+}
+
+// secretFilter 还没有使用当前密钥加密或者建立索引的数据
+func secretFilter() bson.M {
+	return bson.M{"$or": bson.A{bson.M{"secret": bson.M{"$ne": secretCtx.current}},
+		bson.M{"idxKey": bson.M{"$ne": secretCtx.indexKey}}}}
+}
+
+// CheckSecretVersions 检查数据中用到的密钥版本都已配置，缺少旧密钥时迁移会把无法解密的字段当作空值
+func CheckSecretVersions() error {
+	for _, table := range []string{TableStudent, TableFamily, TableLeave} {
+		values, err := findDistinct(table, "secret", bson.M{})
+		if err != nil {
+			return err
+		}
+		for _, value := range values {
+			var version uint32
+			switch num := value.(type) {
+			case int32:
+				version = uint32(num)
+			case int64:
+				version = uint32(num)
+			case float64:
+				version = uint32(num)
+			}
+			if version > 0 && !HadSecretKey(version) {
+				return fmt.Errorf("not found the secret key of version %d that used by %s", version, table)
+			}
+		}
+	}
+	return nil
+}
+
+func encryptList(list []string) ([]string, []string) {
+	arr := make([]string, 0, len(list))
+	indexes := make([]string, 0, len(list))
+	for _, item := range list {
+		arr = append(arr, encryptText(item))
+		if idx := blindIndex(item); idx != "" {
+			indexes = append(indexes, idx)
+		}
+	}
+	return arr, indexes
+}
+
+func decryptList(list []string, locked *bool) []string {
+	for i := range list {
+		list[i] = openText(list[i], locked)
+	}
+	return list
+}
+
+func encryptCustodians(list []proxy.CustodianInfo) ([]proxy.CustodianInfo, []string) {
+	arr := make([]proxy.CustodianInfo, 0, len(list))
+	indexes := make([]string, 0, len(list))
+	for _, item := range list {
+		phones, idx := encryptList(item.Phones)
+		indexes = append(indexes, idx...)
+		arr = append(arr, proxy.CustodianInfo{Name: item.Name, Identity: encryptText(item.Identity), Phones: phones})
+	}
+	return arr, indexes
+}
+
+// identityIndexes 监护人身份证号的盲索引，用于查找同一监护人的其他孩子
+func identityIndexes(list []proxy.CustodianInfo) []string {
+	indexes := make([]string, 0, len(list))
+	for _, item := range list {
+		if idx := blindIndex(item.Identity); idx != "" && !containsString(indexes, idx) {
+			indexes = append(indexes, idx)
+		}
+	}
+	return indexes
+}
+
+func containsString(list []string, str string) bool {
+	for _, item := range list {
+		if item == str {
+			return true
+		}
+	}
+	return false
+}
+
+func decryptCustodians(list []proxy.CustodianInfo, locked *bool) []proxy.CustodianInfo {
+	for i := range list {
+		list[i].Identity = openText(list[i].Identity, locked)
+		list[i].Phones = decryptList(list[i].Phones, locked)
+	}
+	return list
+}
+
+func encryptHistories(list []proxy.StatusHistory) []proxy.StatusHistory {
+	arr := make([]proxy.StatusHistory, 0, len(list))
+	for _, item := range list {
+		item.Operator = encryptText(item.Operator)
+		item.Remark = encryptText(item.Remark)
+		arr = append(arr, item)
+	}
+	return arr
+}
+
+func decryptHistories(list []proxy.StatusHistory, locked *bool) []proxy.StatusHistory {
+	for i := range list {
+		list[i].Operator = openText(list[i].Operator, locked)
+		list[i].Remark = openText(list[i].Remark, locked)
+	}
+	return list
+}
@@ -0,0 +1,71 @@
+package nosql
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omo.msa.school/proxy"
+	"time"
+)
+
+// Snapshot 学期结束时冻结的学校花名册
+type Snapshot struct {
+	UID         primitive.ObjectID `bson:"_id"`
+	ID          uint64             `json:"id" bson:"id"`
+	CreatedTime time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedTime time.Time          `json:"updatedAt" bson:"updatedAt"`
+	DeleteTime  time.Time          `json:"deleteAt" bson:"deleteAt"`
+	Creator     string             `json:"creator" bson:"creator"`
+	Operator    string             `json:"operator" bson:"operator"`
+
+	School  string              `json:"school" bson:"school"`
+	Term    string              `json:"term" bson:"term"`
+	Date    time.Time           `json:"date" bson:"date"`
+	Classes []proxy.RosterClass `json:"classes" bson:"classes"`
+}
+
+func CreateSnapshot(info *Snapshot) error {
+	_, err := insertOne(TableSnapshot, info)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func GetSnapshotNextID() uint64 {
+	num, _ := getSequenceNext(TableSnapshot)
+	return num
+}
+
+func GetSnapshotBy(school, term string) (*Snapshot, error) {
+	msg := bson.M{"school": school, "term": term, "deleteAt": new(time.Time)}
+	result, err := findOneBy(TableSnapshot, msg)
+	if err != nil {
+		return nil, err
+	}
+	model := new(Snapshot)
+	err1 := result.Decode(model)
+	if err1 != nil {
+		return nil, err1
+	}
+	return model, nil
+}
+
+func GetSnapshotsBySchool(school string) ([]*Snapshot, error) {
+	var items = make([]*Snapshot, 0, 10)
+	msg := bson.M{"school": school, "deleteAt": new(time.Time)}
+	cursor, err1 := findMany(TableSnapshot, msg, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		var node = new(Snapshot)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
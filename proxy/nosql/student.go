@@ -36,6 +36,47 @@ type Student struct {
 	School     string                `json:"school" bson:"school"`
 	Tags       []string              `json:"tags" bson:"tags"`
 	Custodians []proxy.CustodianInfo `json:"custodians" bson:"custodians"`
+	// 加密字段所用的密钥版本以及盲索引
+	Secret     uint32   `json:"-" bson:"secret"`
+	IndexKey   string   `json:"-" bson:"idxKey"`
+	CardIndex  string   `json:"-" bson:"cardIdx"`
+	SIDIndex   string   `json:"-" bson:"sidIdx"`
+	PhoneIndex []string `json:"-" bson:"phoneIdx"`
+	// 监护人身份证号的盲索引
+	IdentityIndex []string `json:"-" bson:"identityIdx"`
+	// 有无法解密的字段，字段中保留的是原有的密文
+	Locked bool `json:"-" bson:"-"`
+}
+
+type studentAlias Student
+
+// MarshalBSON 写入数据库时加密身份证、学籍号以及监护人信息
+func (mine *Student) MarshalBSON() ([]byte, error) {
+	tmp := studentAlias(*mine)
+	tmp.Secret = secretCtx.current
+	tmp.IndexKey = secretCtx.indexKey
+	tmp.IDCard = encryptText(mine.IDCard)
+	tmp.CardIndex = blindIndex(mine.IDCard)
+	tmp.SID = encryptText(mine.SID)
+	tmp.SIDIndex = blindIndex(mine.SID)
+	tmp.Custodians, tmp.PhoneIndex = encryptCustodians(mine.Custodians)
+	tmp.IdentityIndex = identityIndexes(mine.Custodians)
+	return bson.Marshal(&tmp)
+}
+
+func (mine *Student) UnmarshalBSON(data []byte) error {
+	tmp := new(studentAlias)
+	err := bson.Unmarshal(data, tmp)
+	if err != nil {
+		return err
+	}
+	locked := false
+	tmp.IDCard = openText(tmp.IDCard, &locked)
+	tmp.SID = openText(tmp.SID, &locked)
+	tmp.Custodians = decryptCustodians(tmp.Custodians, &locked)
+	tmp.Locked = locked
+	*mine = Student(*tmp)
+	return nil
 }
 
 func (mine *Student) HadCustodian(phone string) bool {
@@ -121,7 +162,7 @@ func GetStudentBySN(school, sn string) (*Student, error) {
 }
 
 func GetStudentByIDCard(school, card string) (*Student, error) {
-	msg := bson.M{"school": school, "card": card, "deleteAt": new(time.Time)}
+	msg := bson.M{"school": school, "deleteAt": new(time.Time), "$or": indexFilter("cardIdx", "card", card)}
 	result, err := findOneBy(TableStudent, msg)
 	if err != nil {
 		return nil, err
@@ -136,7 +177,7 @@ func GetStudentByIDCard(school, card string) (*Student, error) {
 
 func GetStudentsByCard(card string) ([]*Student, error) {
 	var items = make([]*Student, 0, 5)
-	msg := bson.M{"card": card, "deleteAt": new(time.Time)}
+	msg := bson.M{"deleteAt": new(time.Time), "$or": indexFilter("cardIdx", "card", card)}
 	cursor, err1 := findMany(TableStudent, msg, 0)
 	if err1 != nil {
 		return nil, err1
@@ -155,7 +196,27 @@ func GetStudentsByCard(card string) ([]*Student, error) {
 
 func GetStudentsBySID(sid string) ([]*Student, error) {
 	var items = make([]*Student, 0, 5)
-	msg := bson.M{"sid": sid, "deleteAt": new(time.Time)}
+	msg := bson.M{"deleteAt": new(time.Time), "$or": indexFilter("sidIdx", "sid", sid)}
+	cursor, err1 := findMany(TableStudent, msg, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		var node = new(Student)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
+
+// GetStudentsBySecret 获取还没有使用当前密钥加密或者建立索引的学生
+func GetStudentsBySecret() ([]*Student, error) {
+	var items = make([]*Student, 0, 100)
+	msg := secretFilter()
 	cursor, err1 := findMany(TableStudent, msg, 0)
 	if err1 != nil {
 		return nil, err1
@@ -216,6 +277,31 @@ func GetAllStudents() ([]*Student, error) {
 	return items, nil
 }
 
+func GetStudentsByTag(school, tag string) ([]*Student, error) {
+	var items = make([]*Student, 0, 20)
+	msg := bson.M{"school": school, "tags": tag, "deleteAt": new(time.Time)}
+	cursor, err1 := findMany(TableStudent, msg, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		var node = new(Student)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
+
+func GetStudentCountByTag(school, tag string) uint32 {
+	msg := bson.M{"school": school, "tags": tag, "deleteAt": new(time.Time)}
+	num, _ := getCountBy(TableStudent, msg)
+	return uint32(num)
+}
+
 func GetStudentsByKeyword(school, key string) ([]*Student, error) {
 	def := new(time.Time)
 	regex := bson.M{"$regex": key}
@@ -241,7 +327,7 @@ func GetStudentsByKeyword(school, key string) ([]*Student, error) {
 func GetStudentsByCustodian(school, phone string) ([]*Student, error) {
 	var items = make([]*Student, 0, 10)
 	//msg := bson.M{"school":school, "custodians.phone": phone}
-	msg := bson.M{"school": school, "deleteAt": new(time.Time), "custodians": bson.M{"$elemMatch": bson.M{"phones": bson.M{"$elemMatch": bson.M{"$eq": phone}}}}}
+	msg := bson.M{"school": school, "deleteAt": new(time.Time), "$or": custodianFilter(phone)}
 	cursor, err1 := findMany(TableStudent, msg, 0)
 	if err1 != nil {
 		return nil, err1
@@ -261,7 +347,7 @@ func GetStudentsByCustodian(school, phone string) ([]*Student, error) {
 func GetStudentsByCustodian2(phone string) ([]*Student, error) {
 	var items = make([]*Student, 0, 10)
 	//msg := bson.M{"school":school, "custodians.phone": phone}
-	msg := bson.M{"deleteAt": new(time.Time), "custodians": bson.M{"$elemMatch": bson.M{"phones": bson.M{"$elemMatch": bson.M{"$eq": phone}}}}}
+	msg := bson.M{"deleteAt": new(time.Time), "$or": custodianFilter(phone)}
 	cursor, err1 := findMany(TableStudent, msg, 0)
 	if err1 != nil {
 		return nil, err1
@@ -278,6 +364,33 @@ func GetStudentsByCustodian2(phone string) ([]*Student, error) {
 	return items, nil
 }
 
+// GetStudentsByCustodianCard 监护人身份证号相同的学生
+func GetStudentsByCustodianCard(card string) ([]*Student, error) {
+	var items = make([]*Student, 0, 5)
+	msg := bson.M{"deleteAt": new(time.Time), "$or": bson.A{bson.M{"identityIdx": bson.M{"$in": blindIndexes(card)}},
+		bson.M{"custodians.identity": card}}}
+	cursor, err1 := findMany(TableStudent, msg, 0)
+	if err1 != nil {
+		return nil, err1
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		var node = new(Student)
+		if err := cursor.Decode(node); err != nil {
+			return nil, err
+		} else {
+			items = append(items, node)
+		}
+	}
+	return items, nil
+}
+
+// custodianFilter 同时匹配盲索引和未迁移的明文手机号
+func custodianFilter(phone string) bson.A {
+	return bson.A{bson.M{"phoneIdx": bson.M{"$in": blindIndexes(phone)}},
+		bson.M{"custodians": bson.M{"$elemMatch": bson.M{"phones": bson.M{"$elemMatch": bson.M{"$eq": phone}}}}}}
+}
+
 func GetStudentsByEnrol(school string, year int) ([]*Student, error) {
 	var items = make([]*Student, 0, 10)
 	msg := bson.M{"school": school, "deleteAt": new(time.Time), "enrol.year": year}
@@ -361,20 +474,46 @@ func GetAllStudentsByStatus(st uint32) ([]*Student, error) {
 }
 
 func UpdateStudentBase(uid, name, sn, card, sid, operator string, sex uint8, arr []proxy.CustodianInfo) error {
-	msg := bson.M{"name": name, "sn": sn, "card": card, "sid": sid, "sex": sex, "custodians": arr,
-		"operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableStudent, uid, msg)
+	custodians, phones := encryptCustodians(arr)
+	msg := bson.M{"name": name, "sn": sn, "card": encryptText(card), "cardIdx": blindIndex(card),
+		"sid": encryptText(sid), "sidIdx": blindIndex(sid), "sex": sex, "custodians": custodians, "phoneIdx": phones,
+		"identityIdx": identityIndexes(arr), "operator": operator, "updatedAt": time.Now()}
+	plains := []string{card, sid}
+	for _, item := range arr {
+		plains = append(append(plains, item.Identity), item.Phones...)
+	}
+	_, err := updateOne(TableStudent, uid, stampSecret(msg, plains...))
 	return err
 }
 
+// UpdateStudentCustodians 其他加密字段使用当前密钥一起重新加密，保证整条数据的密钥版本一致
 func UpdateStudentCustodians(uid, operator string, arr []proxy.CustodianInfo) error {
-	msg := bson.M{"custodians": arr, "operator": operator, "updatedAt": time.Now()}
-	_, err := updateOne(TableStudent, uid, msg)
-	return err
+	db, err := GetStudent(uid)
+	if err != nil {
+		return err
+	}
+	if db.Locked {
+		return ErrSecretLocked
+	}
+	return UpdateStudentBase(uid, db.Name, db.SN, db.IDCard, db.SID, operator, db.Sex, arr)
 }
 
+// UpdateStudentInfo 其他加密字段使用当前密钥一起重新加密，保证整条数据的密钥版本一致
 func UpdateStudentInfo(uid, name, sn, card, operator string, sex uint8) error {
-	msg := bson.M{"name": name, "sn": sn, "card": card, "sex": sex, "operator": operator, "updatedAt": time.Now()}
+	db, err := GetStudent(uid)
+	if err != nil {
+		return err
+	}
+	if db.Locked {
+		return ErrSecretLocked
+	}
+	return UpdateStudentBase(uid, name, sn, card, db.SID, operator, sex, db.Custodians)
+}
+
+// AnonymizeStudent 清除学生的个人信息，保留年级、性别、入学年份等统计需要的字段
+func AnonymizeStudent(uid, name, operator string) error {
+	msg := bson.M{"name": name, "sn": "", "card": "", "cardIdx": "", "sid": "", "sidIdx": "", "entity": "",
+		"custodians": make([]proxy.CustodianInfo, 0, 1), "phoneIdx": make([]string, 0, 1), "identityIdx": make([]string, 0, 1), "operator": operator, "updatedAt": time.Now()}
 	_, err := updateOne(TableStudent, uid, msg)
 	return err
 }
@@ -418,9 +557,13 @@ func AppendStudentCustodian(uid string, info proxy.CustodianInfo) error {
 	if len(uid) < 1 {
 		return errors.New("the uid is empty")
 	}
-	msg := bson.M{"custodians": info}
+	custodians, _ := encryptCustodians([]proxy.CustodianInfo{info})
+	msg := bson.M{"custodians": custodians[0]}
 	_, err := appendElement(TableStudent, uid, msg)
-	return err
+	if err != nil {
+		return err
+	}
+	return updateStudentPhoneIndex(uid)
 }
 
 func SubtractStudentCustodian(uid string, name string) error {
@@ -429,6 +572,35 @@ func SubtractStudentCustodian(uid string, name string) error {
 	}
 	msg := bson.M{"custodians": bson.M{"name": name}}
 	_, err := removeElement(TableStudent, uid, msg)
+	if err != nil {
+		return err
+	}
+	return updateStudentPhoneIndex(uid)
+}
+
+func updateStudentPhoneIndex(uid string) error {
+	db, err := GetStudent(uid)
+	if err != nil {
+		return err
+	}
+	if db.Locked {
+		return ErrSecretLocked
+	}
+	_, phones := encryptCustodians(db.Custodians)
+	_, err = updateOne(TableStudent, uid, bson.M{"phoneIdx": phones, "identityIdx": identityIndexes(db.Custodians)})
+	return err
+}
+
+// UpdateStudentSecret 使用当前密钥重新加密并建立盲索引，用于迁移旧数据和密钥轮换，有无法解密的字段时跳过
+func UpdateStudentSecret(info *Student) error {
+	if info.Locked {
+		return ErrSecretLocked
+	}
+	custodians, phones := encryptCustodians(info.Custodians)
+	msg := bson.M{"card": encryptText(info.IDCard), "cardIdx": blindIndex(info.IDCard),
+		"sid": encryptText(info.SID), "sidIdx": blindIndex(info.SID), "custodians": custodians, "phoneIdx": phones,
+		"identityIdx": identityIndexes(info.Custodians), "secret": secretCtx.current, "idxKey": secretCtx.indexKey}
+	_, err := updateOne(TableStudent, info.UID.Hex(), msg)
 	return err
 }
 
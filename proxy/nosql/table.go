@@ -13,4 +13,23 @@ const (
 	TableApply     = "applies"
 	TableTimes     = "timetables"
 	TableSchedules = "schedules"
+	TableFamily    = "families"
+	TableAttend    = "attendances"
+	TableLeave     = "leaves"
+	TableAward     = "awards"
+	TableEvent     = "student_events"
+	TableBinding   = "bindings"
+	TableErasure   = "erasures"
+	TableExam      = "exams"
+	TableScore     = "scores"
+	TableConduct   = "conducts"
+	TableRollover  = "rollovers"
+	TableAssign    = "assignments"
+	TableClassRole = "class_roles"
+	TableOfficer   = "officers"
+	TableDuty      = "duties"
+	TableSeating   = "seatings"
+	TableMember    = "memberships"
+	TableSnapshot  = "roster_snapshots"
+	TableEmploy    = "employments"
 )
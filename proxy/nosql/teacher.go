@@ -156,6 +156,18 @@ func UpdateTeacherBase2(uid, name, operator string) error {
 	return err
 }
 
+func UpdateTeacherEntity(uid, entity, operator string) error {
+	msg := bson.M{"entity": entity, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableTeacher, uid, msg)
+	return err
+}
+
+func UpdateTeacherTags(uid, operator string, tags []string) error {
+	msg := bson.M{"tags": tags, "operator": operator, "updatedAt": time.Now()}
+	_, err := updateOne(TableTeacher, uid, msg)
+	return err
+}
+
 func UpdateTeacherSubjects(uid, operator string, array []string) error {
 	msg := bson.M{"subjects": array, "operator": operator, "updatedAt": time.Now()}
 	_, err := updateOne(TableTeacher, uid, msg)